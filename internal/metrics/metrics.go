@@ -0,0 +1,41 @@
+// Package metrics 在 client_golang 之上提供抓取时计算的带 label 指标
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Emit 输出一个样本，labelValues 与注册时的 labels 一一对应
+type Emit func(value float64, labelValues ...string)
+
+type funcCollector struct {
+	desc    *prometheus.Desc
+	typ     prometheus.ValueType
+	collect func(emit Emit)
+}
+
+// NewGaugeFunc 每次抓取时调用 collect 生成 gauge 样本，适合从已有状态派生的指标
+func NewGaugeFunc(name string, help string, labels []string, collect func(emit Emit)) prometheus.Collector {
+	return &funcCollector{
+		desc:    prometheus.NewDesc(name, help, labels, nil),
+		typ:     prometheus.GaugeValue,
+		collect: collect,
+	}
+}
+
+// NewCounterFunc 同 NewGaugeFunc，样本为单调递增的累计值
+func NewCounterFunc(name string, help string, labels []string, collect func(emit Emit)) prometheus.Collector {
+	return &funcCollector{
+		desc:    prometheus.NewDesc(name, help, labels, nil),
+		typ:     prometheus.CounterValue,
+		collect: collect,
+	}
+}
+
+func (c *funcCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *funcCollector) Collect(ch chan<- prometheus.Metric) {
+	c.collect(func(value float64, labelValues ...string) {
+		ch <- prometheus.MustNewConstMetric(c.desc, c.typ, value, labelValues...)
+	})
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestGaugeFunc(t *testing.T) {
+	states := map[string]int{"running": 2, "failed": 1}
+	gauge := NewGaugeFunc("plugins", "Plugins by state.", []string{"state"}, func(emit Emit) {
+		for state, count := range states {
+			emit(float64(count), state)
+		}
+	})
+	want := `
+# HELP plugins Plugins by state.
+# TYPE plugins gauge
+plugins{state="failed"} 1
+plugins{state="running"} 2
+`
+	if err := testutil.CollectAndCompare(gauge, strings.NewReader(want)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCounterFunc(t *testing.T) {
+	counter := NewCounterFunc("tasks_total", "Task outcomes.", []string{"result"}, func(emit Emit) {
+		emit(3, "processed")
+		emit(1, `quoted "\`)
+	})
+	want := `
+# HELP tasks_total Task outcomes.
+# TYPE tasks_total counter
+tasks_total{result="processed"} 3
+tasks_total{result="quoted \"\\"} 1
+`
+	if err := testutil.CollectAndCompare(counter, strings.NewReader(want)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNoLabels(t *testing.T) {
+	gauge := NewGaugeFunc("agents", "Registered agents.", nil, func(emit Emit) { emit(4) })
+	if got := testutil.ToFloat64(gauge); got != 4 {
+		t.Fatalf("agents = %v, want 4", got)
+	}
+}
@@ -0,0 +1,189 @@
+// Package placement 为待调度的插件选择 agent，各版本的 manager 把自己的 agent 转成 Agent 后调用
+package placement
+
+import (
+	"errors"
+	"sort"
+)
+
+var ErrNoAgent = errors.New("placement: no agent fits")
+
+// Agent 候选 agent 的快照
+type Agent struct {
+	ID string
+	// 已分配的插件数
+	Plugins int
+	// 容量，cpu 为核数，memory 为字节，为 0 表示未上报
+	CPU    float64
+	Memory float64
+	Labels map[string]string
+}
+
+// Request 待调度插件的资源需求和约束
+type Request struct {
+	InstanceID string
+	AppID      string
+	// 预计占用，cpu 为核数，memory 为字节
+	CPU    float64
+	Memory float64
+	// 必须满足的 agent 标签
+	Selector map[string]string
+	// 尽量满足的 agent 标签，满足越多越优先
+	Preferred map[string]string
+}
+
+// Policy 从候选 agent 中选出插件要落的 agent
+type Policy interface {
+	Select(req Request, agents []Agent) (Agent, error)
+}
+
+// UsageSource 提供 agent 当前的资源使用量，由 metric.Manager 实现
+type UsageSource interface {
+	AgentUsage(agentID string) (cpu float64, memory float64, ok bool)
+}
+
+// AllocationSource 提供 agent 上已分配给插件的资源，用于按容量装箱
+type AllocationSource interface {
+	Allocated(agentID string) (cpu float64, memory float64)
+}
+
+// selectMin 选出 score 最小的 agent，score 相同时取 agentID 小的，保证结果稳定
+func selectMin(agents []Agent, score func(a Agent) (float64, bool)) (Agent, error) {
+	var (
+		best      Agent
+		bestScore float64
+		found     bool
+	)
+	for _, a := range agents {
+		s, ok := score(a)
+		if !ok {
+			continue
+		}
+		if !found || s < bestScore || (s == bestScore && a.ID < best.ID) {
+			best, bestScore, found = a, s, true
+		}
+	}
+	if !found {
+		return Agent{}, ErrNoAgent
+	}
+	return best, nil
+}
+
+// ReservationSource 提供 agent 上尚未落到注册表的预占，由 Reservations 实现
+type ReservationSource interface {
+	Reserved(agentID string) (cpu float64, memory float64, count int)
+}
+
+// FewestPlugins 哪个 agent 插件少，就漂哪个。Reservations 不为空时预调度中的插件也计入
+type FewestPlugins struct {
+	Reservations ReservationSource
+}
+
+func (p FewestPlugins) Select(req Request, agents []Agent) (Agent, error) {
+	return selectMin(agents, func(a Agent) (float64, bool) {
+		count := a.Plugins
+		if p.Reservations != nil {
+			_, _, reserved := p.Reservations.Reserved(a.ID)
+			count += reserved
+		}
+		return float64(count), true
+	})
+}
+
+// LeastUsage 选 cpu/memory 使用率加权和最低的 agent，
+// 没有上报容量的 agent 按使用量绝对值比较，没有 metric 的 agent 视为空闲
+type LeastUsage struct {
+	Usage        UsageSource
+	CPUWeight    float64
+	MemoryWeight float64
+}
+
+func (p LeastUsage) Select(req Request, agents []Agent) (Agent, error) {
+	cpuWeight, memoryWeight := p.CPUWeight, p.MemoryWeight
+	if cpuWeight == 0 && memoryWeight == 0 {
+		cpuWeight, memoryWeight = 1, 1
+	}
+	return selectMin(agents, func(a Agent) (float64, bool) {
+		cpu, memory, ok := p.Usage.AgentUsage(a.ID)
+		if !ok {
+			return 0, true
+		}
+		if a.CPU > 0 {
+			cpu /= a.CPU
+		}
+		if a.Memory > 0 {
+			memory /= a.Memory
+		}
+		return cpuWeight*cpu + memoryWeight*memory, true
+	})
+}
+
+// BinPack 按容量装箱：只考虑剩余容量放得下的 agent，选放入后剩余最少的，
+// 尽量把插件集中在少数 agent 上。未设置容量的 agent 不参与
+type BinPack struct {
+	Allocation AllocationSource
+}
+
+func (p BinPack) Select(req Request, agents []Agent) (Agent, error) {
+	return selectMin(agents, func(a Agent) (float64, bool) {
+		if a.CPU <= 0 || a.Memory <= 0 {
+			return 0, false
+		}
+		cpu, memory := p.Allocation.Allocated(a.ID)
+		freeCPU := a.CPU - cpu - req.CPU
+		freeMemory := a.Memory - memory - req.Memory
+		if freeCPU < 0 || freeMemory < 0 {
+			return 0, false
+		}
+		return freeCPU/a.CPU + freeMemory/a.Memory, true
+	})
+}
+
+// Affinity 先按 Selector 过滤，再按满足 Preferred 的数量从多到少分组，
+// 依次交给 Next 在组内选择，组内放不下时退到下一组。Next 为空时使用 FewestPlugins
+type Affinity struct {
+	Next Policy
+}
+
+func (p Affinity) Select(req Request, agents []Agent) (Agent, error) {
+	groups := make(map[int][]Agent)
+	var scores []int
+	for _, a := range agents {
+		if !matchAll(a, req.Selector) {
+			continue
+		}
+		score := matchCount(a, req.Preferred)
+		if _, ok := groups[score]; !ok {
+			scores = append(scores, score)
+		}
+		groups[score] = append(groups[score], a)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(scores)))
+
+	next := p.Next
+	if next == nil {
+		next = FewestPlugins{}
+	}
+	for _, score := range scores {
+		a, err := next.Select(req, groups[score])
+		if errors.Is(err, ErrNoAgent) {
+			continue
+		}
+		return a, err
+	}
+	return Agent{}, ErrNoAgent
+}
+
+func matchAll(a Agent, labels map[string]string) bool {
+	return matchCount(a, labels) == len(labels)
+}
+
+func matchCount(a Agent, labels map[string]string) int {
+	n := 0
+	for k, v := range labels {
+		if got, ok := a.Labels[k]; ok && got == v {
+			n++
+		}
+	}
+	return n
+}
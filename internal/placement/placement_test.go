@@ -0,0 +1,156 @@
+package placement
+
+import (
+	"errors"
+	"testing"
+)
+
+type agentSpec struct {
+	id      string
+	cpu     float64
+	memory  float64
+	labels  map[string]string
+	plugins int
+}
+
+func agents(specs ...agentSpec) []Agent {
+	agents := make([]Agent, len(specs))
+	for i, s := range specs {
+		agents[i] = Agent{ID: s.id, Plugins: s.plugins, CPU: s.cpu, Memory: s.memory, Labels: s.labels}
+	}
+	return agents
+}
+
+type usage map[string][2]float64
+
+func (u usage) AgentUsage(agentID string) (float64, float64, bool) {
+	v, ok := u[agentID]
+	return v[0], v[1], ok
+}
+
+type allocation map[string][2]float64
+
+func (a allocation) Allocated(agentID string) (float64, float64) {
+	v := a[agentID]
+	return v[0], v[1]
+}
+
+func TestPolicies(t *testing.T) {
+	const gib = 1 << 30
+	tests := []struct {
+		name    string
+		policy  Policy
+		req     Request
+		agents  []agentSpec
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "fewest plugins empty",
+			policy:  FewestPlugins{},
+			wantErr: ErrNoAgent,
+		},
+		{
+			name:   "fewest plugins",
+			policy: FewestPlugins{},
+			agents: []agentSpec{{id: "a1", plugins: 2}, {id: "a2", plugins: 1}, {id: "a3", plugins: 3}},
+			want:   "a2",
+		},
+		{
+			name:   "fewest plugins tie breaks by id",
+			policy: FewestPlugins{},
+			agents: []agentSpec{{id: "b", plugins: 1}, {id: "a", plugins: 1}},
+			want:   "a",
+		},
+		{
+			name:   "least usage by ratio",
+			policy: LeastUsage{Usage: usage{"a1": {2, gib}, "a2": {2, gib}}},
+			agents: []agentSpec{{id: "a1", cpu: 4, memory: 4 * gib}, {id: "a2", cpu: 8, memory: 8 * gib}},
+			want:   "a2",
+		},
+		{
+			name:   "least usage treats missing metric as idle",
+			policy: LeastUsage{Usage: usage{"a1": {0.1, 0}}},
+			agents: []agentSpec{{id: "a1", cpu: 4, memory: gib}, {id: "a2", cpu: 4, memory: gib}},
+			want:   "a2",
+		},
+		{
+			name:   "least usage weights",
+			policy: LeastUsage{Usage: usage{"a1": {3, 0}, "a2": {0, 3 * gib}}, CPUWeight: 0, MemoryWeight: 1},
+			agents: []agentSpec{{id: "a1", cpu: 4, memory: 4 * gib}, {id: "a2", cpu: 4, memory: 4 * gib}},
+			want:   "a1",
+		},
+		{
+			name:   "bin pack prefers fullest agent that fits",
+			policy: BinPack{Allocation: allocation{"a1": {3, gib}, "a2": {1, gib}}},
+			req:    Request{CPU: 1, Memory: gib},
+			agents: []agentSpec{{id: "a1", cpu: 4, memory: 4 * gib}, {id: "a2", cpu: 4, memory: 4 * gib}},
+			want:   "a1",
+		},
+		{
+			name:   "bin pack skips agents without room",
+			policy: BinPack{Allocation: allocation{"a1": {3.5, gib}, "a2": {1, gib}}},
+			req:    Request{CPU: 1, Memory: gib},
+			agents: []agentSpec{{id: "a1", cpu: 4, memory: 4 * gib}, {id: "a2", cpu: 4, memory: 4 * gib}},
+			want:   "a2",
+		},
+		{
+			name:    "bin pack ignores agents without capacity",
+			policy:  BinPack{Allocation: allocation{}},
+			req:     Request{CPU: 1},
+			agents:  []agentSpec{{id: "a1"}},
+			wantErr: ErrNoAgent,
+		},
+		{
+			name:   "affinity selector filters",
+			policy: Affinity{},
+			req:    Request{Selector: map[string]string{"zone": "b"}},
+			agents: []agentSpec{{id: "a1", labels: map[string]string{"zone": "a"}}, {id: "a2", labels: map[string]string{"zone": "b"}, plugins: 5}},
+			want:   "a2",
+		},
+		{
+			name:    "affinity selector matches none",
+			policy:  Affinity{},
+			req:     Request{Selector: map[string]string{"zone": "c"}},
+			agents:  []agentSpec{{id: "a1", labels: map[string]string{"zone": "a"}}},
+			wantErr: ErrNoAgent,
+		},
+		{
+			name:   "affinity prefers more matching labels",
+			policy: Affinity{},
+			req:    Request{Preferred: map[string]string{"zone": "a", "disk": "ssd"}},
+			agents: []agentSpec{
+				{id: "a1", labels: map[string]string{"zone": "a"}},
+				{id: "a2", labels: map[string]string{"zone": "a", "disk": "ssd"}, plugins: 3},
+			},
+			want: "a2",
+		},
+		{
+			name:   "affinity falls back when preferred group is full",
+			policy: Affinity{Next: BinPack{Allocation: allocation{"a2": {4, 0}}}},
+			req:    Request{CPU: 1, Memory: 1, Preferred: map[string]string{"disk": "ssd"}},
+			agents: []agentSpec{
+				{id: "a1", cpu: 4, memory: gib},
+				{id: "a2", cpu: 4, memory: gib, labels: map[string]string{"disk": "ssd"}},
+			},
+			want: "a1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.Select(tt.req, agents(tt.agents...))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.ID != tt.want {
+				t.Fatalf("selected %s, want %s", got.ID, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package placement
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"code/platform/internal/clock"
+)
+
+type reservation struct {
+	agentID  string
+	cpu      float64
+	memory   float64
+	expireAt time.Time
+}
+
+// Reservations 预调度占用：插件已分配到 agent 但还没上报运行时，预计的资源先记在该 agent 上，
+// 避免短时间内大量启动任务都落到同一个 agent。agent 在 ttl 内没有确认的预占自动失效
+type Reservations struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	clock      clock.Clock
+	base       AllocationSource
+	byInstance map[string]reservation // key instanceID
+}
+
+// NewReservations base 为已确认运行的插件占用，可以为空
+func NewReservations(ttl time.Duration, base AllocationSource) *Reservations {
+	return &Reservations{
+		ttl:        ttl,
+		clock:      clock.Real{},
+		base:       base,
+		byInstance: make(map[string]reservation),
+	}
+}
+
+func (r *Reservations) SetClock(c clock.Clock) {
+	r.clock = c
+}
+
+// Reserve 记录插件在 agent 上的预占，同一实例重复预占时覆盖之前的记录
+func (r *Reservations) Reserve(agentID string, req Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.byInstance[req.InstanceID] = reservation{
+		agentID:  agentID,
+		cpu:      req.CPU,
+		memory:   req.Memory,
+		expireAt: r.clock.Now().Add(r.ttl),
+	}
+}
+
+// Confirm agent 上报插件已运行，预占转为实际占用
+func (r *Reservations) Confirm(instanceID string) {
+	r.Release(instanceID)
+}
+
+// Release 启动失败或被取消，释放预占
+func (r *Reservations) Release(instanceID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.byInstance, instanceID)
+}
+
+// Reserved agent 上未过期的预占
+func (r *Reservations) Reserved(agentID string) (cpu float64, memory float64, count int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.clock.Now()
+	for _, res := range r.byInstance {
+		if res.agentID != agentID || !now.Before(res.expireAt) {
+			continue
+		}
+		cpu += res.cpu
+		memory += res.memory
+		count++
+	}
+	return cpu, memory, count
+}
+
+// Allocated 已确认占用加上预占，实现 AllocationSource 供 BinPack 使用
+func (r *Reservations) Allocated(agentID string) (float64, float64) {
+	cpu, memory, _ := r.Reserved(agentID)
+	if r.base != nil {
+		baseCPU, baseMemory := r.base.Allocated(agentID)
+		cpu += baseCPU
+		memory += baseMemory
+	}
+	return cpu, memory
+}
+
+// Usage 在 metric 上报的使用量上叠加预占，metric 还没反映出新插件时也能避开该 agent
+func (r *Reservations) Usage(usage UsageSource) UsageSource {
+	return reservedUsage{usage: usage, reservations: r}
+}
+
+// Expire 清理过期的预占，返回对应的 instanceID，调用方可以重新调度它们
+func (r *Reservations) Expire() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.clock.Now()
+	var expired []string
+	for id, res := range r.byInstance {
+		if !now.Before(res.expireAt) {
+			delete(r.byInstance, id)
+			expired = append(expired, id)
+		}
+	}
+	sort.Strings(expired)
+	return expired
+}
+
+// Run 每隔 interval 清理一次过期的预占，直到 ctx 结束
+func (r *Reservations) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if expired := r.Expire(); len(expired) > 0 {
+				log.Printf("placement: reservations of %v expired without confirmation", expired)
+			}
+		}
+	}
+}
+
+type reservedUsage struct {
+	usage        UsageSource
+	reservations *Reservations
+}
+
+func (u reservedUsage) AgentUsage(agentID string) (float64, float64, bool) {
+	cpu, memory, ok := u.usage.AgentUsage(agentID)
+	reservedCPU, reservedMemory, count := u.reservations.Reserved(agentID)
+	return cpu + reservedCPU, memory + reservedMemory, ok || count > 0
+}
@@ -0,0 +1,88 @@
+package placement
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"code/platform/internal/clock"
+)
+
+func TestReservationsSpreadBurst(t *testing.T) {
+	r := NewReservations(time.Minute, nil)
+	policy := FewestPlugins{Reservations: r}
+	candidates := agents(agentSpec{id: "a1"}, agentSpec{id: "a2"}, agentSpec{id: "a3"})
+
+	// 注册表还没有变化，连续三次选择靠预占分散到三个 agent
+	seen := make(map[string]bool)
+	for _, id := range []string{"i1", "i2", "i3"} {
+		a, err := policy.Select(Request{InstanceID: id}, candidates)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Reserve(a.ID, Request{InstanceID: id})
+		seen[a.ID] = true
+	}
+	if len(seen) != 3 {
+		t.Fatalf("burst landed on %v, want three distinct agents", seen)
+	}
+
+	r.Confirm("i1")
+	r.Release("i2")
+	if _, _, n := r.Reserved("a1"); n != 0 {
+		t.Fatalf("a1 reserved = %d after confirm", n)
+	}
+	if _, _, n := r.Reserved("a3"); n != 1 {
+		t.Fatalf("a3 reserved = %d, want 1", n)
+	}
+}
+
+func TestReservationsExpire(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1000, 0))
+	r := NewReservations(10*time.Second, allocation{"a1": {1, 100}})
+	r.SetClock(fake)
+	r.Reserve("a1", Request{InstanceID: "i1", CPU: 2, Memory: 200})
+
+	if cpu, memory := r.Allocated("a1"); cpu != 3 || memory != 300 {
+		t.Fatalf("allocated = %v, %v, want 3, 300", cpu, memory)
+	}
+	fake.Advance(10 * time.Second)
+	if cpu, _ := r.Allocated("a1"); cpu != 1 {
+		t.Fatalf("allocated after expiry = %v, want 1", cpu)
+	}
+	if got := r.Expire(); len(got) != 1 || got[0] != "i1" {
+		t.Fatalf("expired = %v", got)
+	}
+}
+
+func TestReservationsRunExpires(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1000, 0))
+	r := NewReservations(10*time.Second, nil)
+	r.SetClock(fake)
+	r.Reserve("a1", Request{InstanceID: "i1"})
+	fake.Advance(10 * time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx, time.Millisecond)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	deadline := time.Now().Add(time.Second)
+	for {
+		r.mu.Lock()
+		n := len(r.byInstance)
+		r.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expired reservation not removed by Run")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
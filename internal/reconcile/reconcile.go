@@ -0,0 +1,249 @@
+// Package reconcile 对比期望状态与运行时并下发任务，不依赖具体版本的运行时，
+// v3、v4、v5 的 manager 各自提供 Runtimes 和 Pusher
+package reconcile
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"code/platform/internal/clock"
+)
+
+// Desired 业务状态为启用的插件实例
+type Desired struct {
+	InstanceID string
+	Version    string
+	AppID      string
+}
+
+// Source 期望状态的来源
+type Source interface {
+	Desired(ctx context.Context) ([]Desired, error)
+}
+
+// SourceFunc 函数形式的 Source
+type SourceFunc func(ctx context.Context) ([]Desired, error)
+
+func (f SourceFunc) Desired(ctx context.Context) ([]Desired, error) { return f(ctx) }
+
+// FromVersions 把 instanceID 到 version 的映射转为期望状态，按 instanceID 排序，
+// 保证限流时每轮优先下发的任务稳定
+func FromVersions(versions map[string]string) []Desired {
+	desired := make([]Desired, 0, len(versions))
+	for instanceID, version := range versions {
+		desired = append(desired, Desired{InstanceID: instanceID, Version: version})
+	}
+	sort.Slice(desired, func(i, j int) bool { return desired[i].InstanceID < desired[j].InstanceID })
+	return desired
+}
+
+// Runtime 运行时中的一个插件实例，Pending 表示已在调度中
+type Runtime struct {
+	InstanceID string
+	Version    string
+	Pending    bool
+}
+
+// Runtimes 当前运行时的来源，只返回仍占用 agent 或正在调度的实例
+type Runtimes interface {
+	Runtimes(ctx context.Context) ([]Runtime, error)
+}
+
+// RuntimesFunc 函数形式的 Runtimes
+type RuntimesFunc func(ctx context.Context) ([]Runtime, error)
+
+func (f RuntimesFunc) Runtimes(ctx context.Context) ([]Runtime, error) { return f(ctx) }
+
+type Action string
+
+const (
+	ActionStart   Action = "start"
+	ActionStop    Action = "stop"
+	ActionUpgrade Action = "upgrade"
+)
+
+// Task 对比得出的一个任务
+type Task struct {
+	InstanceID string
+	Version    string
+	Action     Action
+}
+
+// Pusher 接收任务，由各版本转成自己的调度任务
+type Pusher interface {
+	Push(task Task)
+}
+
+// PusherFunc 函数形式的 Pusher
+type PusherFunc func(task Task)
+
+func (f PusherFunc) Push(task Task) { f(task) }
+
+// Result 一次对比下发的任务数量，Deferred 为超过限流留到下一轮的任务
+type Result struct {
+	Started  int
+	Stopped  int
+	Upgraded int
+	Deferred int
+}
+
+// Reconciler 对比期望状态与运行时：少的 push start，多的 push stop，版本不一致的 push upgrade
+type Reconciler struct {
+	source   Source
+	runtimes Runtimes
+	pusher   Pusher
+	limiter  *limiter
+}
+
+// New rate 为每秒最多下发的任务数，burst 为单轮最多下发的任务数
+func New(source Source, runtimes Runtimes, pusher Pusher, rate float64, burst int) *Reconciler {
+	return &Reconciler{
+		source:   source,
+		runtimes: runtimes,
+		pusher:   pusher,
+		limiter:  newLimiter(rate, burst),
+	}
+}
+
+func (r *Reconciler) SetClock(c clock.Clock) {
+	r.limiter.clock = c
+}
+
+// Reconcile 执行一轮对比
+func (r *Reconciler) Reconcile(ctx context.Context) (Result, error) {
+	desired, err := r.source.Desired(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	wanted := make(map[string]Desired, len(desired))
+	for _, d := range desired {
+		wanted[d.InstanceID] = d
+	}
+
+	runtimes, err := r.runtimes.Runtimes(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	running := make(map[string][]Runtime)
+	pending := make(map[string]bool)
+	for _, rt := range runtimes {
+		if rt.Pending {
+			// 已在调度中，不重复下发
+			pending[rt.InstanceID] = true
+			continue
+		}
+		running[rt.InstanceID] = append(running[rt.InstanceID], rt)
+	}
+
+	var tasks []Task
+	for _, d := range desired {
+		if pending[d.InstanceID] {
+			continue
+		}
+		runtimes := running[d.InstanceID]
+		if len(runtimes) == 0 {
+			tasks = append(tasks, Task{InstanceID: d.InstanceID, Version: d.Version, Action: ActionStart})
+			continue
+		}
+		var current bool
+		var stale *Runtime
+		for i := range runtimes {
+			if runtimes[i].Version == d.Version {
+				current = true
+			} else if stale == nil {
+				stale = &runtimes[i]
+			}
+		}
+		switch {
+		case !current:
+			tasks = append(tasks, Task{InstanceID: d.InstanceID, Version: d.Version, Action: ActionUpgrade})
+		case stale != nil:
+			// 新版本已运行，旧版本残留，同一实例一轮只下发一个任务，其余留到下一轮
+			tasks = append(tasks, Task{InstanceID: d.InstanceID, Version: stale.Version, Action: ActionStop})
+		}
+	}
+	var extra []string
+	for instanceID := range running {
+		if _, ok := wanted[instanceID]; !ok {
+			extra = append(extra, instanceID)
+		}
+	}
+	sort.Strings(extra)
+	for _, instanceID := range extra {
+		tasks = append(tasks, Task{InstanceID: instanceID, Version: running[instanceID][0].Version, Action: ActionStop})
+	}
+
+	var res Result
+	for _, task := range tasks {
+		if !r.limiter.allow() {
+			res.Deferred++
+			continue
+		}
+		r.pusher.Push(task)
+		switch task.Action {
+		case ActionStart:
+			res.Started++
+		case ActionStop:
+			res.Stopped++
+		case ActionUpgrade:
+			res.Upgraded++
+		}
+	}
+	return res, nil
+}
+
+// Run 每隔 interval 对比一次，直到 ctx 结束
+func (r *Reconciler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.Reconcile(ctx); err != nil {
+			log.Printf("reconcile: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// limiter 令牌桶
+type limiter struct {
+	mu     sync.Mutex
+	clock  clock.Clock
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	return &limiter{
+		clock:  clock.Real{},
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+func (l *limiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
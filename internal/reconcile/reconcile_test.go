@@ -0,0 +1,136 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"code/platform/internal/clock"
+)
+
+type recorder struct {
+	tasks []string
+}
+
+func (r *recorder) Push(task Task) {
+	r.tasks = append(r.tasks, string(task.Action)+" "+task.InstanceID+"/"+task.Version)
+}
+
+func static(desired ...Desired) Source {
+	return SourceFunc(func(ctx context.Context) ([]Desired, error) { return desired, nil })
+}
+
+func runtimes(runtimes ...Runtime) Runtimes {
+	return RuntimesFunc(func(ctx context.Context) ([]Runtime, error) { return runtimes, nil })
+}
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		name     string
+		desired  []Desired
+		runtimes []Runtime
+		want     []string
+		result   Result
+	}{
+		{
+			name:    "missing instance is started",
+			desired: []Desired{{InstanceID: "i1", Version: "v1"}},
+			want:    []string{"start i1/v1"},
+			result:  Result{Started: 1},
+		},
+		{
+			name:     "extra instance is stopped",
+			runtimes: []Runtime{{InstanceID: "i1", Version: "v1"}},
+			want:     []string{"stop i1/v1"},
+			result:   Result{Stopped: 1},
+		},
+		{
+			name:     "version mismatch is upgraded",
+			desired:  []Desired{{InstanceID: "i1", Version: "v2"}},
+			runtimes: []Runtime{{InstanceID: "i1", Version: "v1"}},
+			want:     []string{"upgrade i1/v2"},
+			result:   Result{Upgraded: 1},
+		},
+		{
+			name:     "leftover old version is stopped",
+			desired:  []Desired{{InstanceID: "i1", Version: "v2"}},
+			runtimes: []Runtime{{InstanceID: "i1", Version: "v1"}, {InstanceID: "i1", Version: "v2"}},
+			want:     []string{"stop i1/v1"},
+			result:   Result{Stopped: 1},
+		},
+		{
+			name:     "pending instance is left alone",
+			desired:  []Desired{{InstanceID: "i1", Version: "v2"}},
+			runtimes: []Runtime{{InstanceID: "i1", Version: "v1", Pending: true}},
+			result:   Result{},
+		},
+		{
+			name:     "in sync",
+			desired:  []Desired{{InstanceID: "i1", Version: "v1"}},
+			runtimes: []Runtime{{InstanceID: "i1", Version: "v1"}},
+			result:   Result{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recorder{}
+			r := New(static(tt.desired...), runtimes(tt.runtimes...), rec, 100, 100)
+			res, err := r.Reconcile(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res != tt.result {
+				t.Errorf("result = %+v, want %+v", res, tt.result)
+			}
+			if !reflect.DeepEqual(rec.tasks, tt.want) {
+				t.Errorf("tasks = %v, want %v", rec.tasks, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcileRateLimit(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1000, 0))
+	desired := FromVersions(map[string]string{"i1": "v1", "i2": "v1", "i3": "v1"})
+	rec := &recorder{}
+	r := New(static(desired...), runtimes(), rec, 1, 2)
+	r.SetClock(fake)
+
+	res, err := r.Reconcile(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Started != 2 || res.Deferred != 1 {
+		t.Fatalf("first round = %+v, want 2 started and 1 deferred", res)
+	}
+	if want := []string{"start i1/v1", "start i2/v1"}; !reflect.DeepEqual(rec.tasks, want) {
+		t.Fatalf("tasks = %v, want %v", rec.tasks, want)
+	}
+
+	// 没有新令牌时整轮都被推迟
+	rec.tasks = nil
+	res, _ = r.Reconcile(context.Background())
+	if res.Started != 0 || res.Deferred != 3 {
+		t.Fatalf("second round = %+v, want everything deferred", res)
+	}
+
+	fake.Advance(time.Second)
+	res, _ = r.Reconcile(context.Background())
+	if res.Started != 1 || res.Deferred != 2 {
+		t.Fatalf("after 1s = %+v, want 1 started", res)
+	}
+}
+
+func TestReconcileErrors(t *testing.T) {
+	boom := errors.New("boom")
+	failing := SourceFunc(func(ctx context.Context) ([]Desired, error) { return nil, boom })
+	if _, err := New(failing, runtimes(), &recorder{}, 1, 1).Reconcile(context.Background()); !errors.Is(err, boom) {
+		t.Errorf("source error = %v, want %v", err, boom)
+	}
+	broken := RuntimesFunc(func(ctx context.Context) ([]Runtime, error) { return nil, boom })
+	if _, err := New(static(), broken, &recorder{}, 1, 1).Reconcile(context.Background()); !errors.Is(err, boom) {
+		t.Errorf("runtimes error = %v, want %v", err, boom)
+	}
+}
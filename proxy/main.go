@@ -6,13 +6,46 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type ZoneInfo struct {
 	ZoneId string `json:"zone_id"`
 }
 
-var zoneConn = make(map[string]net.Conn)
+var (
+	zoneConnMu sync.RWMutex
+	zoneConn   = make(map[string]net.Conn)
+)
+
+var (
+	requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_requests_total",
+		Help: "Proxied requests by instance and kind.",
+	}, []string{"instance", "kind"})
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "proxy_request_duration_seconds",
+		Help:    "Latency of proxied requests by instance.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"instance", "kind"})
+)
+
+func getZoneConn(instanceID string) net.Conn {
+	zoneConnMu.RLock()
+	defer zoneConnMu.RUnlock()
+	return zoneConn[instanceID]
+}
+
+// observe 记录一次请求的数量和耗时
+func observe(instanceID string, kind string, start time.Time) {
+	requests.WithLabelValues(instanceID, kind).Inc()
+	requestDuration.WithLabelValues(instanceID, kind).Observe(time.Since(start).Seconds())
+}
 
 // http => tcp proxy
 // tcp => http   zoneAgent
@@ -30,6 +63,16 @@ func main() {
 	http.HandleFunc("/:instanceID/http", handHttpHandler)
 	// websocket 转 tcp
 	http.HandleFunc("/:instanceID/ws", handleWSHandler)
+	// 指标
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "proxy_zone_connections",
+		Help: "Active zone agent connections.",
+	}, func() float64 {
+		zoneConnMu.RLock()
+		defer zoneConnMu.RUnlock()
+		return float64(len(zoneConn))
+	})
+	http.Handle("/metrics", promhttp.Handler())
 	// 启动 HTTP 服务器
 	fmt.Println("Starting server on port 8082...")
 	err = http.ListenAndServe(":8082", nil)
@@ -55,12 +98,15 @@ func washout(tcpListen net.Listener) error {
 			panic(err)
 		}
 		conn.Write([]byte(zoneInfo.ZoneId))
+		zoneConnMu.Lock()
 		zoneConn[zoneInfo.ZoneId] = conn
+		zoneConnMu.Unlock()
 	}
 }
 
 func handHttpHandler(w http.ResponseWriter, r *http.Request) {
 	instanceId := r.URL.Query().Get("instanceID")
+	defer observe(instanceId, "http", time.Now())
 	// 读取请求体
 	body, err := r.GetBody()
 	if err != nil {
@@ -68,16 +114,18 @@ func handHttpHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	bytes := make([]byte, 1024)
 	// 写入 tcp 连接
-	zoneConn[instanceId].Write()
+	conn := getZoneConn(instanceId)
+	conn.Write()
 
 	for {
-		n, err := zoneConn[instanceId].Read(bytes)
+		n, err := conn.Read(bytes)
 		if err != nil {
 			panic(err)
 		}
 	}
 }
 func handleWSHandler(w http.ResponseWriter, r *http.Request) {
+	defer observe(r.URL.Query().Get("instanceID"), "ws", time.Now())
 	// 将 HTTP 连接升级为 WebSocket 连接
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -6,8 +6,11 @@ import (
 	"net"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // PluginConnection represents a plugin connection
@@ -19,13 +22,47 @@ type PluginConnection struct {
 type ProxyServer struct {
 	plugins      map[string]*PluginConnection
 	pluginsMutex sync.Mutex
+
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	wsSessions      *prometheus.GaugeVec
 }
 
 // NewProxyServer creates a new ProxyServer
 func NewProxyServer() *ProxyServer {
-	return &ProxyServer{
-		plugins: make(map[string]*PluginConnection),
+	ps := &ProxyServer{
+		plugins:  make(map[string]*PluginConnection),
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "proxy_requests_total",
+			Help: "Proxied requests by plugin, kind and result.",
+		}, []string{"plugin", "kind", "result"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "proxy_request_duration_seconds",
+			Help:    "Latency of proxied HTTP requests.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"plugin"}),
+		wsSessions: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "proxy_websocket_sessions",
+			Help: "Active WebSocket sessions by plugin.",
+		}, []string{"plugin"}),
 	}
+	connections := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "proxy_plugin_connections",
+		Help: "Active plugin connections.",
+	}, func() float64 {
+		ps.pluginsMutex.Lock()
+		defer ps.pluginsMutex.Unlock()
+		return float64(len(ps.plugins))
+	})
+	ps.registry.MustRegister(ps.requests, ps.requestDuration, ps.wsSessions, connections)
+	return ps
+}
+
+// HandleMetrics serves proxy metrics in Prometheus text format
+func (ps *ProxyServer) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	promhttp.HandlerFor(ps.registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
 }
 
 // HandlePluginConnection handles plugin connections
@@ -59,11 +96,16 @@ func (ps *ProxyServer) HandleHTTPProxy(w http.ResponseWriter, r *http.Request) {
 	// For simplicity, we'll just use the first available plugin
 	for pluginID, pluginConn := range ps.plugins {
 		log.Printf("Forwarding request to plugin: %s", pluginID)
+		start := time.Now()
+		defer func() {
+			ps.requestDuration.WithLabelValues(pluginID).Observe(time.Since(start).Seconds())
+		}()
 
 		// Forward the HTTP request to the plugin
 		err := r.Write(pluginConn.Conn)
 		if err != nil {
 			log.Printf("Error forwarding request to plugin: %s", err)
+			ps.requests.WithLabelValues(pluginID, "http", "error").Inc()
 			http.Error(w, "Error forwarding request to plugin", http.StatusInternalServerError)
 			return
 		}
@@ -72,11 +114,14 @@ func (ps *ProxyServer) HandleHTTPProxy(w http.ResponseWriter, r *http.Request) {
 		_, err = io.Copy(w, pluginConn.Conn)
 		if err != nil {
 			log.Printf("Error reading response from plugin: %s", err)
+			ps.requests.WithLabelValues(pluginID, "http", "error").Inc()
 			return
 		}
+		ps.requests.WithLabelValues(pluginID, "http", "ok").Inc()
 		return
 	}
 
+	ps.requests.WithLabelValues("", "http", "unavailable").Inc()
 	http.Error(w, "No plugin available", http.StatusServiceUnavailable)
 }
 
@@ -100,10 +145,13 @@ func (ps *ProxyServer) HandleWebSocketProxy(w http.ResponseWriter, r *http.Reque
 	// For simplicity, we'll just use the first available plugin
 	for pluginID, pluginConn := range ps.plugins {
 		log.Printf("Forwarding WebSocket connection to plugin: %s", pluginID)
+		ps.requests.WithLabelValues(pluginID, "ws", "ok").Inc()
+		ps.wsSessions.WithLabelValues(pluginID).Inc()
 
 		// Forward the WebSocket connection to the plugin
 		go func() {
 			defer conn.Close()
+			defer ps.wsSessions.WithLabelValues(pluginID).Dec()
 			// defer pluginConn.Conn.Close()
 
 			// Copy data from WebSocket to plugin connection
@@ -140,6 +188,7 @@ func (ps *ProxyServer) HandleWebSocketProxy(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	ps.requests.WithLabelValues("", "ws", "unavailable").Inc()
 	http.Error(w, "No plugin available", http.StatusServiceUnavailable)
 }
 
@@ -173,6 +222,9 @@ func main() {
 	// Listen for WebSocket proxy requests
 	http.HandleFunc("/ws", proxyServer.HandleWebSocketProxy)
 
+	// Expose proxy metrics
+	http.HandleFunc("/metrics", proxyServer.HandleMetrics)
+
 	log.Println("Listening for proxy requests on :8080")
 	err := http.ListenAndServe(":8080", nil)
 	if err != nil {
@@ -1,7 +1,26 @@
 package manager
 
 import (
+	"context"
+	"log"
 	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"code/platform/internal/metrics"
+	"code/platform/internal/placement"
+	"code/platform/internal/reconcile"
+)
+
+const (
+	// Monitor2 每秒和单轮最多下发的任务数，避免大量插件同时漂移时打满调度队列
+	reconcileRate  = 10
+	reconcileBurst = 50
+	// 每个 agent 待拉取的任务上限，满了视为推送失败
+	agentQueueSize = 100
+	// 推送失败的任务重新入队的次数，超过后丢弃，等 Monitor2 下一轮重新下发
+	maxRetry = 3
 )
 
 type PluginRuntime struct {
@@ -10,6 +29,8 @@ type PluginRuntime struct {
 	version    string
 	agentID    string
 	agentIP    string
+	// 推送到 agent 的时间，unix 秒，pushed 超时未上报 running 的运行时会被删除
+	pushedAt int
 }
 
 type PluginRuntimeMetric struct {
@@ -55,9 +76,28 @@ type Manager struct {
 	// agent 预调度的Plugin数量
 	agentPreSchedulePluginsCount sync.Map // map[string]int // key agentID,val plugin count
 	// 插件运行时
-	pluginRuntimes sync.Map // map[string]*PluginRuntime // key instanceID + version
+	pluginRuntimes sync.Map // map[string]PluginRuntime // key instanceID
 	// 插件运行时metric
-	pluginRuntimeMetric sync.Map //map[string]*PluginRuntimeMetric // key instanceID + version
+	pluginRuntimeMetric sync.Map // map[string]PluginRuntimeMetric // key instanceID
+	// 插件 metric 上报通知，Monitor1 据此重置超时
+	metricReports chan string
+	// 选择 agent 的策略
+	policy placement.Policy
+}
+
+func NewManager() *Manager {
+	m := &Manager{
+		taskQueue:     make(chan *Task, 100),
+		agentQueue:    make(map[string]chan *Task),
+		metricReports: make(chan string, 100),
+	}
+	m.policy = placement.FewestPlugins{Reservations: preScheduled{m}}
+	return m
+}
+
+// SetPolicy 替换选择 agent 的策略，默认选运行中和预调度插件数之和最少的
+func (m *Manager) SetPolicy(p placement.Policy) {
+	m.policy = p
 }
 
 // push 任务
@@ -69,7 +109,14 @@ func (m *Manager) ReportRunningPlugins(agentID string, runningPlugins map[string
 	if _, ok := m.agents.Load(agentID); !ok { // 不存在，直接返回
 		return
 	}
-	// runtime status 更新
+	// runtime status 更新，已推送到该 agent 的插件上报后转为 running
+	for instanceID := range runningPlugins {
+		if val, ok := m.pluginRuntimes.Load(instanceID); ok {
+			if pod := val.(PluginRuntime); pod.agentID == agentID && pod.status == "pushed" {
+				m.UpdateRuntimeStatus(instanceID, "running")
+			}
+		}
+	}
 
 	// 这部分，放agent自己处理可能更好些
 	// 比runtime多的，push stop task
@@ -80,21 +127,114 @@ func (m *Manager) ReportMetric(agentID string, agentMetric AgentMetric, runningP
 		return
 	}
 	// agent metric 更新
+	m.agentMetrics.Store(agentID, agentMetric)
 
-	// runtime metric 更新
+	// runtime metric 更新，key 为 instanceID
+	for instanceID, metric := range runningPluginMetrics {
+		metric.instanceID = instanceID
+		m.pluginRuntimeMetric.Store(instanceID, metric)
+		select {
+		case m.metricReports <- instanceID:
+		default:
+			// Monitor1 处理不过来时丢弃通知，超时触发时会按最近一次上报时间重新计算
+		}
+	}
 }
 
 // 注册agent
 func (m *Manager) RegisterAgent(agentID string, agentIP string) {
+	m.agentQueueRW.Lock()
+	if _, ok := m.agentQueue[agentID]; !ok {
+		m.agentQueue[agentID] = make(chan *Task, agentQueueSize)
+	}
+	m.agentQueueRW.Unlock()
 	m.agents.Store(agentID, Agent{
 		agentID: agentID,
 		agentIP: agentIP,
 	})
 }
 
-// 注销agent
+// 注销agent，还没被拉取的启动和升级任务改为启动任务重新调度，停止任务直接丢弃
 func (m *Manager) UnRegisterAgent(agentID string) {
 	m.agents.Delete(agentID)
+	m.agentQueueRW.Lock()
+	queue, ok := m.agentQueue[agentID]
+	delete(m.agentQueue, agentID)
+	m.agentQueueRW.Unlock()
+	m.agentPreSchedulePluginsCount.Delete(agentID)
+	if !ok {
+		return
+	}
+	for {
+		select {
+		case task := <-queue:
+			if task.Action == "stop" {
+				continue
+			}
+			if val, ok := m.pluginRuntimes.Load(task.InstanceID); ok && val.(PluginRuntime).agentID == agentID {
+				m.pluginRuntimes.CompareAndDelete(task.InstanceID, val)
+			}
+			m.requeue(&Task{InstanceID: task.InstanceID, Version: task.Version, Action: "start", Retry: task.Retry})
+		default:
+			return
+		}
+	}
+}
+
+// PullTasks 取走 agent 队列中的任务，队列为空时等待到有任务或 ctx 结束，agent 未注册时返回 false
+func (m *Manager) PullTasks(ctx context.Context, agentID string) ([]*Task, bool) {
+	m.agentQueueRW.RLock()
+	queue, ok := m.agentQueue[agentID]
+	m.agentQueueRW.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	var tasks []*Task
+	select {
+	case task := <-queue:
+		tasks = append(tasks, task)
+	case <-ctx.Done():
+		return nil, true
+	}
+	for {
+		select {
+		case task := <-queue:
+			tasks = append(tasks, task)
+		default:
+			return tasks, true
+		}
+	}
+}
+
+// pushToAgent 把任务放进 agent 队列，agent 不存在或队列已满时返回 false
+func (m *Manager) pushToAgent(agentID string, task *Task) bool {
+	m.agentQueueRW.RLock()
+	defer m.agentQueueRW.RUnlock()
+	queue, ok := m.agentQueue[agentID]
+	if !ok {
+		return false
+	}
+	select {
+	case queue <- task:
+		return true
+	default:
+		return false
+	}
+}
+
+// requeue 推送失败的任务放回调度队列尾部，不阻塞调度循环
+func (m *Manager) requeue(task *Task) {
+	if task.Retry >= maxRetry {
+		log.Printf("manager: drop %s task of %s after %d retries", task.Action, task.InstanceID, task.Retry)
+		return
+	}
+	retry := *task
+	retry.Retry++
+	select {
+	case m.taskQueue <- &retry:
+	default:
+		log.Printf("manager: task queue full, drop %s task of %s", task.Action, task.InstanceID)
+	}
 }
 
 // 调度
@@ -102,60 +242,322 @@ func (m *Manager) Schedule() {
 	for {
 		select {
 		case task := <-m.taskQueue:
-			if task.Action == "start" { // 启动
-				if val, ok := m.pluginRuntimes.LoadOrStore(task.InstanceID, PluginRuntime{
-					instanceID: task.InstanceID,
-					version:    task.Version,
-					status:     "pending",
-				}); ok {
-					pod := val.(PluginRuntime)
-					if pod.status == "running" {
-						continue
-					}
-					if pod.status == "pending" {
-						continue
-					}
-					if pod.status == "pushed" {
-						continue
-					}
-				}
-				// 计算最合适的 agent（哪个插件少，就漂哪个）
-
-				// push to agent
-				// pod.agentID = agentID
-				// pod.agentIP = agentIP
-				// pod.status = "pushed"
-				// m.pluginRuntimes.CompareAndSwap(task.InstanceID, val, pod)
-				// 失败推送至队列尾部
-			} else { //停止
-				m.pluginRuntimes.Delete(task.InstanceID)
-
-				// push to agent
+			m.schedule(task)
+		}
+	}
+}
+
+// schedule 处理一个任务，推送失败时放回调度队列
+func (m *Manager) schedule(task *Task) {
+	if task.Action == "start" { // 启动
+		pending := PluginRuntime{
+			instanceID: task.InstanceID,
+			version:    task.Version,
+			status:     "pending",
+		}
+		if val, ok := m.pluginRuntimes.LoadOrStore(task.InstanceID, pending); ok {
+			pod := val.(PluginRuntime)
+			if pod.status == "running" {
+				return
+			}
+			if pod.status == "pending" {
+				return
+			}
+			if pod.status == "pushed" {
+				return
+			}
+		}
+		// 计算最合适的 agent（哪个插件少，就漂哪个）
+		agent, ok := m.pickAgent(placement.Request{InstanceID: task.InstanceID})
+		if !ok {
+			// 没有可用的 agent，等 Monitor2 下一轮重新下发
+			m.pluginRuntimes.CompareAndDelete(task.InstanceID, pending)
+			return
+		}
+		pod := pending
+		pod.agentID = agent.agentID
+		pod.agentIP = agent.agentIP
+		pod.status = "pushed"
+		pod.pushedAt = int(time.Now().Unix())
+		if !m.pluginRuntimes.CompareAndSwap(task.InstanceID, pending, pod) {
+			return
+		}
+		m.addPreSchedule(agent.agentID, 1)
+		if !m.pushToAgent(agent.agentID, task) {
+			// 失败推送至队列尾部，重新选择 agent
+			if m.pluginRuntimes.CompareAndDelete(task.InstanceID, pod) {
+				m.addPreSchedule(agent.agentID, -1)
 			}
+			m.requeue(task)
+		}
+	} else if task.Action == "upgrade" { // 升级，在原 agent 上替换版本
+		val, ok := m.pluginRuntimes.Load(task.InstanceID)
+		if !ok {
+			// 运行时已不存在，等 Monitor2 下一轮下发 start
+			return
+		}
+		pod := val.(PluginRuntime)
+		if pod.status != "running" || pod.version == task.Version {
+			return
+		}
+		upgrading := pod
+		upgrading.version = task.Version
+		upgrading.status = "pushed"
+		upgrading.pushedAt = int(time.Now().Unix())
+		if !m.pluginRuntimes.CompareAndSwap(task.InstanceID, pod, upgrading) {
+			return
+		}
+		m.addPreSchedule(pod.agentID, 1)
+		if !m.pushToAgent(pod.agentID, task) {
+			if m.pluginRuntimes.CompareAndSwap(task.InstanceID, upgrading, pod) {
+				m.addPreSchedule(pod.agentID, -1)
+			}
+			m.requeue(task)
+		}
+	} else { //停止
+		val, ok := m.pluginRuntimes.LoadAndDelete(task.InstanceID)
+		if !ok {
+			return
+		}
+		pod := val.(PluginRuntime)
+		if pod.status == "pushed" {
+			m.addPreSchedule(pod.agentID, -1)
+		}
+		// agent 已注销时插件随之停止，不需要重试
+		if !m.pushToAgent(pod.agentID, task) {
+			log.Printf("manager: push stop task of %s to agent %s failed", task.InstanceID, pod.agentID)
+		}
+	}
+}
+
+// pickAgent 由 policy 在已注册的 agent 中选择，插件数为运行中的插件
+func (m *Manager) pickAgent(req placement.Request) (Agent, bool) {
+	running := make(map[string]int)
+	m.pluginRuntimes.Range(func(key, value any) bool {
+		if pod := value.(PluginRuntime); pod.status == "running" {
+			running[pod.agentID]++
 		}
+		return true
+	})
+	agents := make(map[string]Agent)
+	var candidates []placement.Agent
+	m.agents.Range(func(key, value any) bool {
+		agent := value.(Agent)
+		agents[agent.agentID] = agent
+		candidates = append(candidates, placement.Agent{ID: agent.agentID, Plugins: running[agent.agentID]})
+		return true
+	})
+	target, err := m.policy.Select(req, candidates)
+	if err != nil {
+		return Agent{}, false
 	}
+	return agents[target.ID], true
 }
 
-// 更新运行时状态
+// preScheduled 以预调度的插件数量作为 placement 的预占
+type preScheduled struct {
+	m *Manager
+}
+
+func (p preScheduled) Reserved(agentID string) (float64, float64, int) {
+	if val, ok := p.m.agentPreSchedulePluginsCount.Load(agentID); ok {
+		return 0, 0, val.(int)
+	}
+	return 0, 0, 0
+}
+
+// 调整 agent 预调度的插件数量
+func (m *Manager) addPreSchedule(agentID string, delta int) {
+	for {
+		val, ok := m.agentPreSchedulePluginsCount.LoadOrStore(agentID, delta)
+		if !ok {
+			return
+		}
+		count := val.(int) + delta
+		if count < 0 {
+			count = 0
+		}
+		if m.agentPreSchedulePluginsCount.CompareAndSwap(agentID, val, count) {
+			return
+		}
+	}
+}
+
+// 更新运行时状态，离开 pushed 的插件不再计入预调度数量
 func (m *Manager) UpdateRuntimeStatus(instanceID string, status string) {
 	if val, ok := m.pluginRuntimes.Load(instanceID); ok {
 		pod := val.(PluginRuntime)
+		prev := pod.status
 		pod.status = status
-		m.pluginRuntimes.CompareAndSwap(instanceID, val, pod)
+		if m.pluginRuntimes.CompareAndSwap(instanceID, val, pod) && prev == "pushed" && status != "pushed" {
+			m.addPreSchedule(pod.agentID, -1)
+		}
 	}
 }
 
-// 监控runtime metric 的插件运行时的lasttimestamp，超过一定时间没有心跳，就认为插件挂了，直接删除内存runtime
-func (m *Manager) Monitor1() {
+// 监控runtime metric 的插件运行时的lasttimestamp，超过一定时间没有心跳，就认为插件挂了，直接删除内存runtime。
+// 每个插件一个超时定时器，上报时重置，不轮询；ctx 结束时退出
+func (m *Manager) Monitor1(ctx context.Context, timeout time.Duration) {
+	timers := make(map[string]*time.Timer)
+	expired := make(chan string)
+	// 定期补齐定时器：上报通知可能因 Monitor1 处理不过来被丢弃，已推送但没有 metric 的插件也不会有定时器
+	resync := time.NewTicker(timeout / 2)
+	defer resync.Stop()
+	defer func() {
+		for _, timer := range timers {
+			timer.Stop()
+		}
+	}()
+	arm := func(instanceID string, d time.Duration) {
+		if timer, ok := timers[instanceID]; ok {
+			timer.Stop()
+		}
+		timers[instanceID] = time.AfterFunc(d, func() {
+			select {
+			case expired <- instanceID:
+			case <-ctx.Done():
+			}
+		})
+	}
+
+	// 启动前已经上报过的插件
+	m.pluginRuntimeMetric.Range(func(key, val any) bool {
+		arm(key.(string), m.remaining(val.(PluginRuntimeMetric), timeout))
+		return true
+	})
 	for {
-		// 直接删除内存runtime
+		select {
+		case <-ctx.Done():
+			return
+		case <-resync.C:
+			m.expirePushed(timeout)
+			m.pluginRuntimes.Range(func(key, _ any) bool {
+				instanceID := key.(string)
+				if _, ok := timers[instanceID]; ok {
+					return true
+				}
+				if val, ok := m.pluginRuntimeMetric.Load(instanceID); ok {
+					arm(instanceID, m.remaining(val.(PluginRuntimeMetric), timeout))
+				}
+				return true
+			})
+		case instanceID := <-m.metricReports:
+			if val, ok := m.pluginRuntimeMetric.Load(instanceID); ok {
+				arm(instanceID, m.remaining(val.(PluginRuntimeMetric), timeout))
+			}
+		case instanceID := <-expired:
+			// 定时器可能已被重置或通知被丢弃，按最近一次上报时间重新判断
+			val, ok := m.pluginRuntimeMetric.Load(instanceID)
+			if !ok {
+				delete(timers, instanceID)
+				continue
+			}
+			if d := m.remaining(val.(PluginRuntimeMetric), timeout); d > 0 {
+				arm(instanceID, d)
+				continue
+			}
+			delete(timers, instanceID)
+			m.removeRuntime(instanceID, val)
+		}
 	}
 }
 
-// 监控当前运行时与业务状态的一致性
-func (m *Manager) Monitor2() {
-	for {
-		// 获取当前业务状态为启用的插件列表，与当前运行时列表做对比
-		// 少的部分push add task，多的部分push stop task
+// remaining 距离超时还剩的时间，cpuTime、memoryTime 为 unix 秒
+func (m *Manager) remaining(metric PluginRuntimeMetric, timeout time.Duration) time.Duration {
+	last := metric.cpuTime
+	if metric.memoryTime > last {
+		last = metric.memoryTime
+	}
+	return time.Unix(int64(last), 0).Add(timeout).Sub(time.Now())
+}
+
+// removeRuntime 删除超时插件的运行时和 metric，期间有新的上报时保留
+func (m *Manager) removeRuntime(instanceID string, metric any) {
+	if !m.pluginRuntimeMetric.CompareAndDelete(instanceID, metric) {
+		return
 	}
+	if val, ok := m.pluginRuntimes.LoadAndDelete(instanceID); ok {
+		if pod := val.(PluginRuntime); pod.status == "pushed" {
+			m.addPreSchedule(pod.agentID, -1)
+		}
+	}
+}
+
+// expirePushed 删除推送后超过 timeout 仍未上报 running 的运行时，释放预调度数量，由 Monitor2 重新下发
+func (m *Manager) expirePushed(timeout time.Duration) {
+	now := time.Now()
+	m.pluginRuntimes.Range(func(key, val any) bool {
+		pod := val.(PluginRuntime)
+		if pod.status != "pushed" || now.Before(time.Unix(int64(pod.pushedAt), 0).Add(timeout)) {
+			return true
+		}
+		if m.pluginRuntimes.CompareAndDelete(key, val) {
+			log.Printf("manager: %s pushed to agent %s not reported running in %s", pod.instanceID, pod.agentID, timeout)
+			m.addPreSchedule(pod.agentID, -1)
+		}
+		return true
+	})
+}
+
+// 业务状态为启用的插件列表，key instanceID，val version
+type DesiredSource func() (map[string]string, error)
+
+// 监控当前运行时与业务状态的一致性：少的部分push start task，多的部分push stop task，
+// 版本不一致的push upgrade task，下发受 reconcileRate 限流，直到 ctx 结束
+func (m *Manager) Monitor2(ctx context.Context, source DesiredSource, interval time.Duration) {
+	m.newReconciler(source).Run(ctx, interval)
+}
+
+func (m *Manager) newReconciler(source DesiredSource) *reconcile.Reconciler {
+	desired := reconcile.SourceFunc(func(ctx context.Context) ([]reconcile.Desired, error) {
+		plugins, err := source()
+		if err != nil {
+			return nil, err
+		}
+		return reconcile.FromVersions(plugins), nil
+	})
+	pusher := reconcile.PusherFunc(func(task reconcile.Task) {
+		m.PushTask(&Task{InstanceID: task.InstanceID, Version: task.Version, Action: string(task.Action)})
+	})
+	return reconcile.New(desired, reconcile.RuntimesFunc(m.runtimes), pusher, reconcileRate, reconcileBurst)
+}
+
+// runtimes 内存中的插件运行时，pending 和 pushed 视为调度中
+func (m *Manager) runtimes(ctx context.Context) ([]reconcile.Runtime, error) {
+	var runtimes []reconcile.Runtime
+	m.pluginRuntimes.Range(func(key, value any) bool {
+		pod := value.(PluginRuntime)
+		runtimes = append(runtimes, reconcile.Runtime{
+			InstanceID: pod.instanceID,
+			Version:    pod.version,
+			Pending:    pod.status == "pending" || pod.status == "pushed",
+		})
+		return true
+	})
+	return runtimes, nil
+}
+
+// 注册调度队列、agent 数量和插件运行时状态指标
+func (m *Manager) RegisterMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(metrics.NewGaugeFunc("manager_task_queue_depth", "Tasks waiting in the schedule queue.", nil, func(emit metrics.Emit) {
+		emit(float64(len(m.taskQueue)))
+	}))
+	reg.MustRegister(metrics.NewGaugeFunc("manager_agents", "Registered agents.", nil, func(emit metrics.Emit) {
+		count := 0
+		m.agents.Range(func(key, value any) bool {
+			count++
+			return true
+		})
+		emit(float64(count))
+	}))
+	reg.MustRegister(metrics.NewGaugeFunc("manager_plugin_runtimes", "Plugin runtimes by status.", []string{"status"}, func(emit metrics.Emit) {
+		counts := make(map[string]int)
+		m.pluginRuntimes.Range(func(key, value any) bool {
+			counts[value.(PluginRuntime).status]++
+			return true
+		})
+		for status, count := range counts {
+			emit(float64(count), status)
+		}
+	}))
 }
@@ -0,0 +1,307 @@
+package manager
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"code/platform/internal/placement"
+)
+
+func TestReconcilePushesTasks(t *testing.T) {
+	m := NewManager()
+	m.pluginRuntimes.Store("i1", PluginRuntime{instanceID: "i1", version: "v1", status: "running"})
+	m.pluginRuntimes.Store("i2", PluginRuntime{instanceID: "i2", version: "v1", status: "running"})
+	m.pluginRuntimes.Store("i3", PluginRuntime{instanceID: "i3", version: "v1", status: "pushed"})
+	source := func() (map[string]string, error) {
+		return map[string]string{"i1": "v2", "i3": "v2", "i4": "v1"}, nil
+	}
+
+	res, err := m.newReconciler(source).Reconcile(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Started != 1 || res.Stopped != 1 || res.Upgraded != 1 {
+		t.Fatalf("result = %+v, want one start, stop and upgrade", res)
+	}
+	got := make(map[string]Task)
+	for len(m.taskQueue) > 0 {
+		task := <-m.taskQueue
+		got[task.InstanceID] = *task
+	}
+	want := map[string]Task{
+		"i1": {InstanceID: "i1", Version: "v2", Action: "upgrade"},
+		"i2": {InstanceID: "i2", Version: "v1", Action: "stop"},
+		"i4": {InstanceID: "i4", Version: "v1", Action: "start"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("tasks = %+v, want %+v", got, want)
+	}
+	for id, task := range want {
+		if got[id] != task {
+			t.Errorf("task %s = %+v, want %+v", id, got[id], task)
+		}
+	}
+}
+
+func TestMonitor1RemovesSilentPlugins(t *testing.T) {
+	m := NewManager()
+	m.RegisterAgent("a1", "10.0.0.1")
+	now := int(time.Now().Unix())
+	for _, id := range []string{"i1", "i2", "i3"} {
+		m.pluginRuntimes.Store(id, PluginRuntime{instanceID: id, version: "v1", agentID: "a1", status: "running"})
+	}
+	// i1 启动前已超时，i2 刚上报过
+	m.pluginRuntimeMetric.Store("i1", PluginRuntimeMetric{instanceID: "i1", cpuTime: now - 60, memoryTime: now - 60})
+	m.pluginRuntimeMetric.Store("i2", PluginRuntimeMetric{instanceID: "i2", cpuTime: now, memoryTime: now})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Monitor1(ctx, 10*time.Second)
+		close(done)
+	}()
+
+	// i3 启动后上报了一次过期的 metric
+	m.ReportMetric("a1", AgentMetric{}, map[string]PluginRuntimeMetric{"i3": {cpuTime: now - 60, memoryTime: now - 60}})
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, ok1 := m.pluginRuntimes.Load("i1")
+		_, ok3 := m.pluginRuntimes.Load("i3")
+		if !ok1 && !ok3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stale runtimes not removed: i1 %v, i3 %v", ok1, ok3)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, ok := m.pluginRuntimes.Load("i2"); !ok {
+		t.Fatal("fresh runtime i2 removed")
+	}
+	if _, ok := m.pluginRuntimeMetric.Load("i1"); ok {
+		t.Fatal("metric of removed runtime i1 kept")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Monitor1 did not exit after ctx was cancelled")
+	}
+}
+
+func TestMonitor1ArmsUnnotifiedPlugins(t *testing.T) {
+	m := NewManager()
+	m.RegisterAgent("a1", "10.0.0.1")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Monitor1(ctx, 2*time.Second)
+	// 通知被消费说明 Monitor1 已经过了启动时的扫描
+	m.metricReports <- "unknown"
+	for len(m.metricReports) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// 上报通知被丢弃，只能靠 resync 发现
+	now := int(time.Now().Unix())
+	m.pluginRuntimes.Store("i1", PluginRuntime{instanceID: "i1", version: "v1", agentID: "a1", status: "running"})
+	m.pluginRuntimeMetric.Store("i1", PluginRuntimeMetric{instanceID: "i1", cpuTime: now - 60, memoryTime: now - 60})
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if _, ok := m.pluginRuntimes.Load("i1"); !ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stale runtime without a report notification not removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestScheduleDeliversToAgentQueue(t *testing.T) {
+	m := NewManager()
+	m.RegisterAgent("a1", "10.0.0.1")
+	m.schedule(&Task{InstanceID: "i1", Version: "v1", Action: "start"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	tasks, ok := m.PullTasks(ctx, "a1")
+	if !ok || len(tasks) != 1 || tasks[0].InstanceID != "i1" || tasks[0].Action != "start" {
+		t.Fatalf("pulled %v, %v, want start i1", tasks, ok)
+	}
+	if val, _ := m.pluginRuntimes.Load("i1"); val.(PluginRuntime).agentID != "a1" {
+		t.Fatalf("runtime = %+v, want assigned to a1", val)
+	}
+
+	m.schedule(&Task{InstanceID: "i1", Version: "v1", Action: "stop"})
+	if tasks, _ := m.PullTasks(ctx, "a1"); len(tasks) != 1 || tasks[0].Action != "stop" {
+		t.Fatalf("pulled %v, want stop i1", tasks)
+	}
+	if _, ok := m.PullTasks(ctx, "a2"); ok {
+		t.Fatal("pulled from unregistered agent")
+	}
+}
+
+func TestScheduleRequeuesWhenAgentQueueFull(t *testing.T) {
+	m := NewManager()
+	m.RegisterAgent("a1", "10.0.0.1")
+	for i := 0; i < agentQueueSize; i++ {
+		m.agentQueue["a1"] <- &Task{Action: "stop"}
+	}
+	m.schedule(&Task{InstanceID: "i1", Version: "v1", Action: "start"})
+
+	if _, ok := m.pluginRuntimes.Load("i1"); ok {
+		t.Fatal("runtime kept after push failed")
+	}
+	if val, _ := m.agentPreSchedulePluginsCount.Load("a1"); val.(int) != 0 {
+		t.Fatalf("pre-scheduled = %v, want 0", val)
+	}
+	if task := <-m.taskQueue; task.InstanceID != "i1" || task.Retry != 1 {
+		t.Fatalf("requeued %+v, want i1 retry 1", task)
+	}
+	m.requeue(&Task{InstanceID: "i1", Action: "start", Retry: maxRetry})
+	if len(m.taskQueue) != 0 {
+		t.Fatal("requeued beyond maxRetry")
+	}
+}
+
+func TestUnRegisterAgentRequeuesUnpulledTasks(t *testing.T) {
+	m := NewManager()
+	m.RegisterAgent("a1", "10.0.0.1")
+	m.schedule(&Task{InstanceID: "i1", Version: "v1", Action: "start"})
+	m.pluginRuntimes.Store("i2", PluginRuntime{instanceID: "i2", version: "v1", agentID: "a1", status: "running"})
+	m.schedule(&Task{InstanceID: "i2", Version: "v1", Action: "stop"})
+
+	m.UnRegisterAgent("a1")
+	if _, ok := m.pluginRuntimes.Load("i1"); ok {
+		t.Fatal("runtime of unregistered agent kept")
+	}
+	if len(m.taskQueue) != 1 {
+		t.Fatalf("requeued %d tasks, want only the start", len(m.taskQueue))
+	}
+	if task := <-m.taskQueue; task.InstanceID != "i1" || task.Action != "start" {
+		t.Fatalf("requeued %+v, want start i1", task)
+	}
+
+	// 重新调度到新注册的 agent
+	m.RegisterAgent("a2", "10.0.0.2")
+	m.schedule(&Task{InstanceID: "i1", Version: "v1", Action: "start"})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if tasks, _ := m.PullTasks(ctx, "a2"); len(tasks) != 1 || tasks[0].InstanceID != "i1" {
+		t.Fatalf("pulled %v from a2, want start i1", tasks)
+	}
+}
+
+func TestPickAgentCountsRunningAndPreScheduled(t *testing.T) {
+	m := NewManager()
+	for _, id := range []string{"a1", "a2", "a3"} {
+		m.RegisterAgent(id, "")
+	}
+	m.pluginRuntimes.Store("i0", PluginRuntime{instanceID: "i0", version: "v1", agentID: "a1", status: "running"})
+	m.addPreSchedule("a2", 1)
+
+	tests := []struct {
+		instanceID string
+		want       string
+	}{
+		{"i1", "a3"},
+		// 三个 agent 各有一个，按 agentID 取最小
+		{"i2", "a1"},
+		{"i3", "a2"},
+	}
+	for _, tt := range tests {
+		m.schedule(&Task{InstanceID: tt.instanceID, Version: "v1", Action: "start"})
+		val, ok := m.pluginRuntimes.Load(tt.instanceID)
+		if !ok || val.(PluginRuntime).agentID != tt.want {
+			t.Fatalf("%s placed on %+v, want %s", tt.instanceID, val, tt.want)
+		}
+	}
+
+	m.SetPolicy(placement.BinPack{})
+	m.schedule(&Task{InstanceID: "i4", Version: "v1", Action: "start"})
+	if _, ok := m.pluginRuntimes.Load("i4"); ok {
+		t.Fatal("i4 placed although no agent reports capacity")
+	}
+}
+
+func preScheduledCount(m *Manager, agentID string) int {
+	_, _, count := preScheduled{m}.Reserved(agentID)
+	return count
+}
+
+func TestReportRunningPluginsConfirmsPushed(t *testing.T) {
+	m := NewManager()
+	m.RegisterAgent("a1", "10.0.0.1")
+	m.RegisterAgent("a2", "10.0.0.2")
+	m.schedule(&Task{InstanceID: "i1", Version: "v1", Action: "start"})
+	if val, _ := m.pluginRuntimes.Load("i1"); val.(PluginRuntime).agentID != "a1" {
+		t.Fatalf("runtime = %+v, want assigned to a1", val)
+	}
+	if n := preScheduledCount(m, "a1"); n != 1 {
+		t.Fatalf("pre-scheduled = %d, want 1 after push", n)
+	}
+
+	// 其他 agent 的上报不能确认
+	m.ReportRunningPlugins("a2", map[string]struct{}{"i1": {}})
+	if val, _ := m.pluginRuntimes.Load("i1"); val.(PluginRuntime).status != "pushed" {
+		t.Fatalf("runtime = %+v, confirmed by a2", val)
+	}
+	m.ReportRunningPlugins("a1", map[string]struct{}{"i1": {}})
+	if val, _ := m.pluginRuntimes.Load("i1"); val.(PluginRuntime).status != "running" {
+		t.Fatalf("runtime = %+v, want running", val)
+	}
+	if n := preScheduledCount(m, "a1"); n != 0 {
+		t.Fatalf("pre-scheduled = %d, want 0 after report", n)
+	}
+}
+
+func TestExpirePushed(t *testing.T) {
+	m := NewManager()
+	m.RegisterAgent("a1", "10.0.0.1")
+	now := int(time.Now().Unix())
+	m.pluginRuntimes.Store("i1", PluginRuntime{instanceID: "i1", version: "v1", agentID: "a1", status: "pushed", pushedAt: now - 60})
+	m.pluginRuntimes.Store("i2", PluginRuntime{instanceID: "i2", version: "v1", agentID: "a1", status: "pushed", pushedAt: now})
+	m.pluginRuntimes.Store("i3", PluginRuntime{instanceID: "i3", version: "v1", agentID: "a1", status: "running", pushedAt: now - 60})
+	m.addPreSchedule("a1", 2)
+
+	m.expirePushed(10 * time.Second)
+	for id, want := range map[string]bool{"i1": false, "i2": true, "i3": true} {
+		if _, ok := m.pluginRuntimes.Load(id); ok != want {
+			t.Errorf("runtime %s kept = %v, want %v", id, ok, want)
+		}
+	}
+	if n := preScheduledCount(m, "a1"); n != 1 {
+		t.Fatalf("pre-scheduled = %d, want 1", n)
+	}
+}
+
+func TestRegisterMetrics(t *testing.T) {
+	m := NewManager()
+	m.RegisterAgent("a1", "10.0.0.1")
+	m.pluginRuntimes.Store("i1", PluginRuntime{instanceID: "i1", agentID: "a1", status: "running"})
+	m.pluginRuntimes.Store("i2", PluginRuntime{instanceID: "i2", agentID: "a1", status: "running"})
+	m.pluginRuntimes.Store("i3", PluginRuntime{instanceID: "i3", agentID: "a1", status: "pushed"})
+
+	reg := prometheus.NewRegistry()
+	m.RegisterMetrics(reg)
+	want := `
+# HELP manager_agents Registered agents.
+# TYPE manager_agents gauge
+manager_agents 1
+# HELP manager_plugin_runtimes Plugin runtimes by status.
+# TYPE manager_plugin_runtimes gauge
+manager_plugin_runtimes{status="pushed"} 1
+manager_plugin_runtimes{status="running"} 2
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "manager_agents", "manager_plugin_runtimes"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,87 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrKindMismatch       = errors.New("codec: kind mismatch")
+	ErrUnsupportedVersion = errors.New("codec: unsupported schema version")
+)
+
+// envelope 持久化记录的外层，带上类型和 schema 版本，读取旧版本时逐级迁移
+type envelope struct {
+	Kind    string          `json:"kind"`
+	Version int             `json:"version"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Migration 把 from 版本的数据迁移到 from+1 版本
+type Migration func(data json.RawMessage) (json.RawMessage, error)
+
+// Codec 某一类记录的编解码
+type Codec struct {
+	kind       string
+	version    int
+	migrations map[int]Migration // key 为迁移前的版本
+}
+
+// New version 为当前 schema 版本，从 1 开始；0 表示没有外层的历史数据
+func New(kind string, version int) *Codec {
+	return &Codec{
+		kind:       kind,
+		version:    version,
+		migrations: make(map[int]Migration),
+	}
+}
+
+// Register 注册 from -> from+1 的迁移
+func (c *Codec) Register(from int, m Migration) *Codec {
+	c.migrations[from] = m
+	return c
+}
+
+func (c *Codec) Kind() string { return c.kind }
+
+func (c *Codec) Version() int { return c.version }
+
+// Encode 按当前版本编码
+func (c *Codec) Encode(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelope{Kind: c.kind, Version: c.version, Data: data})
+}
+
+// Decode 解码到 v，旧版本数据先迁移到当前版本
+func (c *Codec) Decode(raw []byte, v any) error {
+	var env envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return err
+	}
+	if env.Kind == "" {
+		// 没有外层的历史数据
+		env = envelope{Kind: c.kind, Version: 0, Data: raw}
+	}
+	if env.Kind != c.kind {
+		return fmt.Errorf("%w: want %s, got %s", ErrKindMismatch, c.kind, env.Kind)
+	}
+	if env.Version > c.version {
+		return fmt.Errorf("%w: %s v%d, newest known v%d", ErrUnsupportedVersion, c.kind, env.Version, c.version)
+	}
+	data := env.Data
+	for version := env.Version; version < c.version; version++ {
+		m, ok := c.migrations[version]
+		if !ok {
+			return fmt.Errorf("%w: %s has no migration from v%d", ErrUnsupportedVersion, c.kind, version)
+		}
+		var err error
+		if data, err = m(data); err != nil {
+			return fmt.Errorf("codec: migrate %s v%d: %w", c.kind, version, err)
+		}
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,100 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+type record struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestRoundTrip(t *testing.T) {
+	c := New("record", 1)
+	raw, err := c.Encode(record{Name: "a", Count: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var env envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		t.Fatal(err)
+	}
+	if env.Kind != "record" || env.Version != 1 {
+		t.Fatalf("envelope = %s v%d, want record v1", env.Kind, env.Version)
+	}
+	var got record
+	if err := c.Decode(raw, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != (record{Name: "a", Count: 3}) {
+		t.Fatalf("decoded = %+v", got)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	// v0 没有外层，name 字段叫 title；v1 改名为 name；v2 增加 count
+	c := New("record", 2).
+		Register(0, func(data json.RawMessage) (json.RawMessage, error) {
+			var v0 struct {
+				Title string `json:"title"`
+			}
+			if err := json.Unmarshal(data, &v0); err != nil {
+				return nil, err
+			}
+			return json.Marshal(map[string]string{"name": v0.Title})
+		}).
+		Register(1, func(data json.RawMessage) (json.RawMessage, error) {
+			var v1 map[string]any
+			if err := json.Unmarshal(data, &v1); err != nil {
+				return nil, err
+			}
+			v1["count"] = 1
+			return json.Marshal(v1)
+		})
+
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{"legacy without envelope", `{"title":"a"}`},
+		{"v1 envelope", `{"kind":"record","version":1,"data":{"name":"a"}}`},
+		{"current", `{"kind":"record","version":2,"data":{"name":"a","count":1}}`},
+	}
+	for _, tt := range tests {
+		var got record
+		if err := c.Decode([]byte(tt.raw), &got); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != (record{Name: "a", Count: 1}) {
+			t.Errorf("%s: decoded = %+v", tt.name, got)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	boom := errors.New("boom")
+	c := New("record", 2).Register(1, func(json.RawMessage) (json.RawMessage, error) { return nil, boom })
+	tests := []struct {
+		name string
+		raw  string
+		want error
+	}{
+		{"other kind", `{"kind":"other","version":1,"data":{}}`, ErrKindMismatch},
+		{"newer version", `{"kind":"record","version":3,"data":{}}`, ErrUnsupportedVersion},
+		{"missing migration", `{}`, ErrUnsupportedVersion},
+		{"failed migration", `{"kind":"record","version":1,"data":{}}`, boom},
+	}
+	for _, tt := range tests {
+		var got record
+		if err := c.Decode([]byte(tt.raw), &got); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	var got record
+	if err := c.Decode([]byte("not json"), &got); err == nil {
+		t.Error("invalid json decoded without error")
+	}
+}
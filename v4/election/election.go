@@ -0,0 +1,216 @@
+package election
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"code/platform/v4/store"
+)
+
+var ErrNoLeader = errors.New("election: no leader")
+
+// Election 基于租约和 CAS 的选主：key 不存在时带租约写入自己的 id 即当选，
+// 租约过期或主动放弃后 key 被删除，watch 到删除的候选者重新竞选，
+// 因此 leader 异常退出后最迟约一个 ttl 完成切换
+type Election struct {
+	store store.Store
+	key   string
+	id    string
+	ttl   time.Duration
+
+	mu     sync.Mutex
+	leader bool
+}
+
+func New(s store.Store, key, id string, ttl time.Duration) *Election {
+	return &Election{store: s, key: key, id: id, ttl: ttl}
+}
+
+func (e *Election) ID() string {
+	return e.id
+}
+
+// IsLeader 当前实例是否为 leader
+func (e *Election) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+// Leader 返回当前 leader 的 id
+func (e *Election) Leader(ctx context.Context) (string, error) {
+	kv, err := e.store.Get(ctx, e.key)
+	if errors.Is(err, store.ErrNotFound) {
+		return "", ErrNoLeader
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(kv.Value), nil
+}
+
+// Run 循环竞选，当选后调用 lead，lead 的 ctx 在失去领导权时取消。
+// lead 返回后主动放弃领导权并重新竞选，Run 阻塞直到 ctx 结束
+func (e *Election) Run(ctx context.Context, lead func(ctx context.Context)) {
+	for ctx.Err() == nil {
+		lease, rev, err := e.campaign(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("election %s: campaign: %v", e.key, err)
+				sleep(ctx, e.ttl/3)
+			}
+			continue
+		}
+
+		e.setLeader(true)
+		leaderCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			lead(leaderCtx)
+		}()
+		e.hold(leaderCtx, lease, rev, done)
+		cancel()
+		<-done
+		e.setLeader(false)
+
+		// 放弃领导权，使用新的 ctx 保证 ctx 结束后仍能撤销租约
+		revokeCtx, cancelRevoke := context.WithTimeout(context.Background(), e.ttl)
+		e.store.Revoke(revokeCtx, lease)
+		cancelRevoke()
+	}
+}
+
+// campaign 阻塞直到当选，返回持有的租约和写入的 revision
+func (e *Election) campaign(ctx context.Context) (store.LeaseID, int64, error) {
+	for {
+		lease, err := e.store.Grant(ctx, e.ttl)
+		if err != nil {
+			return 0, 0, err
+		}
+		rev, err := e.store.CompareAndSwap(ctx, e.key, []byte(e.id), 0, lease)
+		if err == nil {
+			return lease, rev, nil
+		}
+		e.store.Revoke(ctx, lease)
+		if !errors.Is(err, store.ErrConflict) {
+			return 0, 0, err
+		}
+		if err := e.waitVacant(ctx); err != nil {
+			return 0, 0, err
+		}
+	}
+}
+
+// waitVacant 等待 leader key 被删除
+func (e *Election) waitVacant(ctx context.Context) error {
+	for {
+		_, ok, rev, err := e.get(ctx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		if deleted(ctx, e.store, e.key, rev) {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// watch 立即中断（存储异常）时不要空转
+		sleep(ctx, e.ttl/3)
+	}
+}
+
+// hold 续约并监听 leader key，租约丢失、key 被删除或改写、lead 返回时退出
+func (e *Election) hold(ctx context.Context, lease store.LeaseID, rev int64, done <-chan struct{}) {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lost := make(chan struct{})
+	go func() {
+		defer close(lost)
+		from := rev
+		for !deleted(wctx, e.store, e.key, from) && wctx.Err() == nil {
+			// watch 中断，确认 key 仍是自己写入的，再从读取时的 revision 继续监听
+			kv, ok, current, err := e.get(wctx)
+			if err != nil || !ok || kv.ModRevision != rev {
+				return
+			}
+			from = current
+			sleep(wctx, e.ttl/3)
+		}
+	}()
+
+	lastRenew := time.Now()
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-done:
+			return
+		case <-lost:
+			if ctx.Err() == nil {
+				log.Printf("election %s: leader key lost", e.key)
+			}
+			return
+		case <-ticker.C:
+			err := e.store.KeepAlive(ctx, lease)
+			if err == nil {
+				lastRenew = time.Now()
+				continue
+			}
+			// 存储暂时不可用时继续尝试。本地计时晚于服务端租约的起点，
+			// 留出余量在服务端租约过期前退位，避免两个 leader 同时存在
+			if errors.Is(err, store.ErrLeaseNotFound) || time.Since(lastRenew) >= e.ttl*2/3 {
+				log.Printf("election %s: keepalive: %v", e.key, err)
+				return
+			}
+		}
+	}
+}
+
+func (e *Election) setLeader(leader bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leader = leader
+}
+
+// get 读取 leader key，同时返回读取时的存储 revision。
+// 之后从该 revision 开始 watch，而不是 key 的 ModRevision：leader 长期不变时
+// 它的 ModRevision 可能早已被压缩，watch 会立即中断导致空转
+func (e *Election) get(ctx context.Context) (store.KeyValue, bool, int64, error) {
+	kvs, rev, err := e.store.List(ctx, e.key)
+	if err != nil {
+		return store.KeyValue{}, false, 0, err
+	}
+	for _, kv := range kvs {
+		// List 按前缀匹配，只看 key 本身
+		if kv.Key == e.key {
+			return kv, true, rev, nil
+		}
+	}
+	return store.KeyValue{}, false, rev, nil
+}
+
+// deleted 从 rev 之后监听 key，被删除或改写时返回 true；watch 中断时返回 false
+func deleted(ctx context.Context, s store.Store, key string, rev int64) bool {
+	for ev := range s.Watch(ctx, key, rev) {
+		if ev.KV.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
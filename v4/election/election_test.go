@@ -0,0 +1,260 @@
+package election
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"code/platform/v4/store"
+)
+
+const ttl = time.Second
+
+// countingStore 记录 Watch 调用次数，用于发现空转
+type countingStore struct {
+	store.Store
+	watches atomic.Int64
+}
+
+func (s *countingStore) Watch(ctx context.Context, prefix string, rev int64) <-chan store.Event {
+	s.watches.Add(1)
+	return s.Store.Watch(ctx, prefix, rev)
+}
+
+type candidate struct {
+	e      *Election
+	cancel context.CancelFunc
+	done   chan struct{}
+	// 每次当选时写入 lead 的 ctx
+	leading chan context.Context
+}
+
+func start(s store.Store, id string) *candidate {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &candidate{
+		e:       New(s, "/election/test", id, ttl),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		leading: make(chan context.Context, 1),
+	}
+	go func() {
+		defer close(c.done)
+		c.e.Run(ctx, func(ctx context.Context) {
+			c.leading <- ctx
+			<-ctx.Done()
+		})
+	}()
+	return c
+}
+
+func (c *candidate) stop() {
+	c.cancel()
+	<-c.done
+}
+
+func waitLeading(t *testing.T, c *candidate) context.Context {
+	t.Helper()
+	select {
+	case ctx := <-c.leading:
+		return ctx
+	case <-time.After(5 * ttl):
+		t.Fatalf("%s did not become leader", c.e.ID())
+		return nil
+	}
+}
+
+func notLeading(t *testing.T, c *candidate) {
+	t.Helper()
+	select {
+	case <-c.leading:
+		t.Fatalf("%s became leader while another candidate holds the key", c.e.ID())
+	case <-time.After(ttl / 2):
+	}
+}
+
+func TestSingleCandidate(t *testing.T) {
+	s := store.NewMemoryStore()
+	c := start(s, "m1")
+	waitLeading(t, c)
+	if !c.e.IsLeader() {
+		t.Fatal("IsLeader = false while leading")
+	}
+	if leader, err := c.e.Leader(context.Background()); err != nil || leader != "m1" {
+		t.Fatalf("Leader = %q, %v, want m1", leader, err)
+	}
+
+	c.stop()
+	if c.e.IsLeader() {
+		t.Fatal("IsLeader = true after Run returned")
+	}
+	if _, err := c.e.Leader(context.Background()); !errors.Is(err, ErrNoLeader) {
+		t.Fatalf("Leader after stop: err = %v, want ErrNoLeader", err)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	s := store.NewMemoryStore()
+	c1 := start(s, "m1")
+	defer c1.stop()
+	waitLeading(t, c1)
+
+	c2 := start(s, "m2")
+	defer c2.stop()
+	notLeading(t, c2)
+
+	// leader 退出时撤销租约，follower 立即接管
+	c1.stop()
+	waitLeading(t, c2)
+	if leader, _ := c2.e.Leader(context.Background()); leader != "m2" {
+		t.Fatalf("Leader = %q, want m2", leader)
+	}
+}
+
+func TestLeaderKeyLost(t *testing.T) {
+	s := store.NewMemoryStore()
+	c := start(s, "m1")
+	defer c.stop()
+	ctx := waitLeading(t, c)
+
+	kv, err := s.Get(context.Background(), "/election/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 租约被撤销，模拟 leader 与存储失联超过 ttl
+	s.Revoke(context.Background(), kv.Lease)
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * ttl):
+		t.Fatal("lead ctx not cancelled after the leader key was lost")
+	}
+	// 随后重新竞选
+	waitLeading(t, c)
+}
+
+func TestOnlyOneLeader(t *testing.T) {
+	s := store.NewMemoryStore()
+	var (
+		mu      sync.Mutex
+		leaders int
+		max     int
+		terms   atomic.Int32
+	)
+	var candidates []*candidate
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		c := &candidate{e: New(s, "/election/test", fmt.Sprintf("m%d", i), ttl), cancel: cancel, done: make(chan struct{})}
+		go func() {
+			defer close(c.done)
+			c.e.Run(ctx, func(ctx context.Context) {
+				mu.Lock()
+				leaders++
+				if leaders > max {
+					max = leaders
+				}
+				mu.Unlock()
+				terms.Add(1)
+				// 每个任期很短，制造频繁切换
+				select {
+				case <-ctx.Done():
+				case <-time.After(20 * time.Millisecond):
+				}
+				mu.Lock()
+				leaders--
+				mu.Unlock()
+			})
+		}()
+		candidates = append(candidates, c)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for terms.Load() < 10 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, c := range candidates {
+		c.stop()
+	}
+	if terms.Load() < 10 {
+		t.Fatalf("only %d terms in 5s", terms.Load())
+	}
+	if max != 1 {
+		t.Fatalf("%d leaders at the same time", max)
+	}
+}
+
+func TestWaitAfterCompaction(t *testing.T) {
+	mem := store.NewMemoryStore()
+	s := &countingStore{Store: mem}
+	c1 := start(s, "m1")
+	defer c1.stop()
+	waitLeading(t, c1)
+
+	// leader key 的 ModRevision 落到历史范围之外
+	for i := 0; i < 2000; i++ {
+		mem.Put(context.Background(), fmt.Sprintf("/other/%d", i), nil, store.NoLease)
+	}
+	before := s.watches.Load()
+	c2 := start(s, "m2")
+	defer c2.stop()
+	notLeading(t, c2)
+
+	// 等待期间 follower 只 watch 一次，leader 持有期间不需要重新 watch
+	if n := s.watches.Load() - before; n > 1 {
+		t.Fatalf("watch called %d times while waiting, want 1", n)
+	}
+	c1.stop()
+	waitLeading(t, c2)
+}
+
+// brokenStore watch 立即中断、续约总是失败，模拟存储异常
+type brokenStore struct {
+	countingStore
+	keepAlives atomic.Int64
+}
+
+func (s *brokenStore) Watch(ctx context.Context, prefix string, rev int64) <-chan store.Event {
+	s.watches.Add(1)
+	ch := make(chan store.Event)
+	close(ch)
+	return ch
+}
+
+func (s *brokenStore) KeepAlive(ctx context.Context, lease store.LeaseID) error {
+	s.keepAlives.Add(1)
+	return errors.New("store unavailable")
+}
+
+func TestWaitVacantBacksOff(t *testing.T) {
+	s := &brokenStore{countingStore: countingStore{Store: store.NewMemoryStore()}}
+	if _, err := s.Put(context.Background(), "/election/test", []byte("m1"), store.NoLease); err != nil {
+		t.Fatal(err)
+	}
+	c := start(s, "m2")
+	defer c.stop()
+	select {
+	case <-c.leading:
+		t.Fatal("m2 became leader while m1 holds the key")
+	case <-time.After(ttl):
+	}
+	if n := s.watches.Load(); n > 5 {
+		t.Fatalf("watch called %d times in one ttl, want a backoff between broken watches", n)
+	}
+}
+
+func TestStepDownBeforeLeaseExpires(t *testing.T) {
+	s := &brokenStore{countingStore: countingStore{Store: store.NewMemoryStore()}}
+	c := start(s, "m1")
+	defer c.stop()
+	ctx := waitLeading(t, c)
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * ttl):
+		t.Fatal("leader kept leading although keepalive kept failing")
+	}
+	// 续约间隔为 ttl/3，第二次失败时已到 2/3 ttl
+	if n := s.keepAlives.Load(); n > 2 {
+		t.Fatalf("stepped down after %d failed keepalives, want 2", n)
+	}
+}
@@ -2,33 +2,66 @@ package manager
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"go.etcd.io/etcd/clientv3"
-	"go.etcd.io/etcd/clientv3/concurrency"
+
+	"code/platform/internal/clock"
+	"code/platform/internal/metrics"
+	"code/platform/internal/placement"
+	"code/platform/internal/reconcile"
+	"code/platform/v4/election"
+	"code/platform/v4/store"
+	"code/platform/v4/store/etcdstore"
+)
+
+const (
+	// 插件超过该时间没有上报，认为插件挂了
+	pluginTimeout = 30 * time.Second
+	// agent 记录绑定该时长的租约，超过该时间没有上报由存储自动删除，认为 agent 挂了
+	agentTimeout = 60 * time.Second
+	// leader 租约时长，leader 异常退出后其他副本在该时间内接管
+	leaderTTL = 15 * time.Second
+	// 运行时记录 CAS 冲突时的最大重试次数
+	casRetries = 5
+	// Monitor2 对账间隔，以及每秒和单轮最多下发的任务数
+	reconcileInterval = 30 * time.Second
+	reconcileRate     = 10
+	reconcileBurst    = 50
 )
 
+// ErrStaleReport 上报携带的 resourceVersion 落后于存储中的记录，说明记录已被 manager 修改
+var ErrStaleReport = errors.New("manager: stale report")
+
 type PluginPod struct {
-	resourceVersion int
+	// 存储中记录的 ModRevision，读取时填充，不随记录持久化
+	resourceVersion int64
 	runtimeStatus   string
 	instanceID      string
 	version         string
 	agentID         string
 	agentIP         string
-	lastTimeStamp   int
+	lastTimeStamp   int64 // unix 秒
 }
 
 type PluginMetric struct {
 	pid    string
 	cpu    float64
 	memory float64
-	time   int
+	time   int64 // unix 秒
 }
 type PluginReportItem struct {
-	instanceID      string
-	version         string
-	resourceVersion int
+	instanceID string
+	version    string
+	// agent 最近一次从 Report 拿到的版本，0 表示首次上报，不做校验
+	resourceVersion int64
 	PluginMetric
 }
 
@@ -40,7 +73,7 @@ type Agent struct {
 	usageCpu       float64
 	usageMemory    float64
 	runningPlugins []string
-	lastTimestamp  int
+	lastTimestamp  int64 // unix 秒
 }
 type Task struct {
 	InstanceID string
@@ -49,9 +82,12 @@ type Task struct {
 }
 
 type Manager struct {
-	taskQueue  chan *Task
-	etcdClient *clientv3.Client
-	ctx        context.Context
+	taskQueue chan *Task
+	store     store.Store
+	election  *election.Election
+	ctx       context.Context
+	clock     clock.Clock
+	policy    placement.Policy
 }
 
 func NewManager(etcdEndpoints []string) (*Manager, error) {
@@ -62,189 +98,602 @@ func NewManager(etcdEndpoints []string) (*Manager, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Manager{
-		taskQueue:  make(chan *Task, 100),
-		etcdClient: cli,
-		ctx:        context.Background(),
-	}, nil
+	return NewManagerWithStore(etcdstore.New(cli))
+}
+
+// NewManagerWithStore 使用指定存储创建 manager，单机部署和测试可以传 store.NewMemoryStore()
+func NewManagerWithStore(st store.Store) (*Manager, error) {
+	hostname, _ := os.Hostname()
+	holder := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	m := &Manager{
+		taskQueue: make(chan *Task, 100),
+		store:     st,
+		election:  election.New(st, "/election/manager", holder, leaderTTL),
+		ctx:       context.Background(),
+		clock:     clock.Real{},
+	}
+	m.policy = placement.BinPack{Allocation: reportedUsage{m}}
+	return m, nil
+}
+
+// SetPolicy 替换选择 agent 的策略，默认按 agent 上报的容量和使用量装箱
+func (m *Manager) SetPolicy(p placement.Policy) {
+	m.policy = p
+}
+
+// SetClock 替换时间来源，测试中用 clock.Fake 模拟超时
+func (m *Manager) SetClock(c clock.Clock) {
+	m.clock = c
+}
+
+// stale last 为写入记录的 manager 副本的墙上时钟（unix 秒），距今超过 timeout 视为过期。
+// 墙上时钟不是单调的，副本间的时钟偏差或时钟回拨会让超时提前或推迟，偏差需远小于 timeout；
+// last 晚于当前时间时视为未过期
+func (m *Manager) stale(last int64, timeout time.Duration) bool {
+	elapsed := m.clock.Now().Unix() - last
+	return elapsed > int64(timeout/time.Second)
 }
 
 func (m *Manager) PushTask(task *Task) {
 	m.taskQueue <- task
 }
 
-func (m *Manager) Report(agent *Agent, items map[string]PluginReportItem) error {
-	s, err := concurrency.NewSession(m.etcdClient)
-	if err != nil {
-		return err
+// pushTask 与 PushTask 相同，ctx 结束时放弃，避免失去领导权后阻塞在满队列上
+func (m *Manager) pushTask(ctx context.Context, task *Task) {
+	select {
+	case m.taskQueue <- task:
+	case <-ctx.Done():
 	}
-	defer s.Close()
-	mu := concurrency.NewMutex(s, "/locks/report")
+}
 
-	if err := mu.Lock(m.ctx); err != nil {
-		return err
-	}
-	defer mu.Unlock(m.ctx)
+// Run 参与选主，只有 leader 运行调度和各个 monitor，失去领导权时全部停止并重新竞选。
+// Report 等读写接口不受影响，follower 也可以处理，阻塞直到 ctx 结束
+func (m *Manager) Run(ctx context.Context, source DesiredSource) error {
+	m.election.Run(ctx, func(ctx context.Context) {
+		log.Printf("manager %s: became leader", m.election.ID())
+		var wg sync.WaitGroup
+		for _, loop := range []func(ctx context.Context){
+			m.schedule,
+			m.monitor1,
+			func(ctx context.Context) { m.monitor2(ctx, source) },
+			m.monitor3,
+		} {
+			wg.Add(1)
+			go func(loop func(ctx context.Context)) {
+				defer wg.Done()
+				loop(ctx)
+			}(loop)
+		}
+		wg.Wait()
+		log.Printf("manager %s: stepped down", m.election.ID())
+	})
+	return ctx.Err()
+}
+
+// IsLeader 当前副本是否为 leader
+func (m *Manager) IsLeader() bool {
+	return m.election.IsLeader()
+}
+
+// Report 更新 agent 和插件运行时，返回每个插件最新的 resourceVersion，agent 下次上报时带上。
+// 版本落后的条目被拒绝并返回 ErrStaleReport，其余条目照常写入
+func (m *Manager) Report(agent *Agent, items map[string]PluginReportItem) (map[string]int64, error) {
+	now := m.clock.Now().Unix()
 
 	// 更新 agent 状态
-	agentKey := "/agents/" + agent.agentID
-	agentValue, _ := json.Marshal(agent)
-	_, err = m.etcdClient.Put(m.ctx, agentKey, string(agentValue))
+	agent.lastTimestamp = now
+	agentValue, err := encodeAgent(agent)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := m.putAgent("/agents/"+agent.agentID, agentValue); err != nil {
+		return nil, err
 	}
 
 	// 更新 plugin runtimes 和 metrics
+	versions := make(map[string]int64, len(items))
+	var errs []error
 	for _, item := range items {
-		runtimeKey := "/pluginRuntimes/" + item.instanceID
-		runtimeValue, _ := json.Marshal(&PluginPod{
-			instanceID:    item.instanceID,
-			version:       item.version,
-			agentID:       agent.agentID,
-			agentIP:       agent.agentIP,
-			lastTimeStamp: time.Now().Second(),
-			runtimeStatus: "running",
+		pluginPod, err := m.updatePluginPod(item.instanceID, func(pluginPod *PluginPod) (*PluginPod, error) {
+			if pluginPod == nil {
+				pluginPod = &PluginPod{instanceID: item.instanceID, runtimeStatus: "running"}
+			} else if item.resourceVersion != 0 && item.resourceVersion != pluginPod.resourceVersion {
+				return nil, fmt.Errorf("%w: %s", ErrStaleReport, item.instanceID)
+			}
+			pluginPod.version = item.version
+			pluginPod.agentID = agent.agentID
+			pluginPod.agentIP = agent.agentIP
+			pluginPod.lastTimeStamp = now
+			// 已下发停止的插件保持 killing，直到 agent 停止上报
+			if pluginPod.runtimeStatus != "killing" {
+				pluginPod.runtimeStatus = "running"
+			}
+			return pluginPod, nil
 		})
-		_, err = m.etcdClient.Put(m.ctx, runtimeKey, string(runtimeValue))
+		if pluginPod != nil {
+			versions[item.instanceID] = pluginPod.resourceVersion
+		}
 		if err != nil {
-			return err
+			errs = append(errs, err)
+			continue
 		}
 
 		metricKey := "/pluginMetrics/" + item.instanceID
-		metricValue, _ := json.Marshal(&PluginMetric{
-			pid:    item.instanceID,
+		metricValue, err := encodePluginMetric(&PluginMetric{
+			pid:    item.pid,
 			cpu:    item.cpu,
 			memory: item.memory,
-			time:   time.Now().Second(),
+			time:   now,
 		})
-		_, err = m.etcdClient.Put(m.ctx, metricKey, string(metricValue))
 		if err != nil {
-			return err
+			errs = append(errs, err)
+			continue
+		}
+		_, err = m.store.Put(m.ctx, metricKey, metricValue, store.NoLease)
+		if err != nil {
+			errs = append(errs, err)
 		}
 	}
 
-	return nil
+	return versions, errors.Join(errs...)
+}
+
+// putAgent 写入 agent 记录并续约记录上的租约，记录不存在或租约已过期时重新申请。
+// 每个 agent 一个租约，而不是挂在 manager 的会话租约上：会话租约只反映 manager 存活，
+// 无法让某个 agent 停止上报后只删除它自己的记录。
+// 同一 agent 的并发上报都可能申请新租约，按读到的 ModRevision CAS 写入，冲突的一方撤销自己的租约后重试
+func (m *Manager) putAgent(agentKey string, agentValue []byte) error {
+	for i := 0; i < casRetries; i++ {
+		var rev int64
+		lease := store.NoLease
+		kv, err := m.store.Get(m.ctx, agentKey)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+		if err == nil {
+			rev = kv.ModRevision
+			if kv.Lease != store.NoLease {
+				err := m.store.KeepAlive(m.ctx, kv.Lease)
+				if err == nil {
+					lease = kv.Lease
+				} else if !errors.Is(err, store.ErrLeaseNotFound) {
+					return err
+				}
+			}
+		}
+		granted := lease == store.NoLease
+		if granted {
+			if lease, err = m.store.Grant(m.ctx, agentTimeout); err != nil {
+				return err
+			}
+		}
+		_, err = m.store.CompareAndSwap(m.ctx, agentKey, agentValue, rev, lease)
+		if err == nil {
+			return nil
+		}
+		if granted {
+			m.store.Revoke(m.ctx, lease)
+		}
+		if !errors.Is(err, store.ErrConflict) {
+			return err
+		}
+	}
+	return fmt.Errorf("%w: %s", store.ErrConflict, agentKey)
 }
 
 func (m *Manager) UnRegisterAgent(agentID string) error {
-	s, err := concurrency.NewSession(m.etcdClient)
+	agentKey := "/agents/" + agentID
+	kv, err := m.store.Get(m.ctx, agentKey)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
-	defer s.Close()
-	mu := concurrency.NewMutex(s, "/locks/unregister")
+	if kv.Lease != store.NoLease {
+		// 撤销租约同时删除 agent 记录
+		return m.store.Revoke(m.ctx, kv.Lease)
+	}
+	return m.store.Delete(m.ctx, agentKey)
+}
 
-	if err := mu.Lock(m.ctx); err != nil {
-		return err
+// getPluginPod 读取插件运行时记录，resourceVersion 取自存储的 ModRevision。
+// 历史遗留的空记录返回 nil 和它的 ModRevision，由调用方覆盖
+func (m *Manager) getPluginPod(instanceID string) (*PluginPod, int64, error) {
+	kv, err := m.store.Get(m.ctx, "/pluginRuntimes/"+instanceID)
+	if err != nil {
+		return nil, 0, err
+	}
+	pluginPod, err := decodePluginPod(kv.Value)
+	if errors.Is(err, ErrEmptyRecord) {
+		return nil, kv.ModRevision, nil
 	}
-	defer mu.Unlock(m.ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	pluginPod.resourceVersion = kv.ModRevision
+	return pluginPod, kv.ModRevision, nil
+}
 
-	agentKey := "/agents/" + agentID
-	_, err = m.etcdClient.Delete(m.ctx, agentKey)
-	return err
+// updatePluginPod 以 CAS 方式读改写插件运行时记录，冲突时重新读取后重试。
+// mutate 收到的记录不存在时为 nil，返回 nil 表示不写入；返回值为当前记录，出错时也尽量返回
+func (m *Manager) updatePluginPod(instanceID string, mutate func(pluginPod *PluginPod) (*PluginPod, error)) (*PluginPod, error) {
+	runtimeKey := "/pluginRuntimes/" + instanceID
+	for i := 0; i < casRetries; i++ {
+		current, rev, err := m.getPluginPod(instanceID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return nil, err
+		}
+		var base *PluginPod
+		if current != nil {
+			copied := *current
+			base = &copied
+		}
+
+		next, err := mutate(base)
+		if err != nil || next == nil {
+			return current, err
+		}
+		runtimeValue, err := encodePluginPod(next)
+		if err != nil {
+			return current, err
+		}
+		rev, err = m.store.CompareAndSwap(m.ctx, runtimeKey, runtimeValue, rev, store.NoLease)
+		if errors.Is(err, store.ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return current, err
+		}
+		next.resourceVersion = rev
+		return next, nil
+	}
+	return nil, fmt.Errorf("%w: %s", store.ErrConflict, runtimeKey)
 }
 
 func (m *Manager) Schedule() {
+	m.schedule(m.ctx)
+}
+
+func (m *Manager) schedule(ctx context.Context) {
 	for {
 		select {
+		case <-ctx.Done():
+			return
 		case task := <-m.taskQueue:
-			runtimeKey := "/pluginRuntimes/" + task.InstanceID
-			resp, err := m.etcdClient.Get(m.ctx, runtimeKey)
-			if err != nil || len(resp.Kvs) == 0 {
-				continue
-			}
-
-			var pluginPod PluginPod
-			json.Unmarshal(resp.Kvs[0].Value, &pluginPod)
-
-			if task.Action == "start" {
-				if pluginPod.runtimeStatus == "running" || pluginPod.runtimeStatus == "pending" {
-					continue
-				}
-
-				pluginPod.runtimeStatus = "pending"
-				runtimeValue, _ := json.Marshal(pluginPod)
-				m.etcdClient.Put(m.ctx, runtimeKey, string(runtimeValue))
+			m.scheduleTask(ctx, task)
+		}
+	}
+}
 
-				// 计算最合适的 agent，并推送到 agent
-			} else {
-				if pluginPod.runtimeStatus == "killing" {
-					continue
-				}
+// scheduleTask 更新运行时记录后推送到 agent，状态变更时刷新 lastTimeStamp，
+// 由 Monitor1 从这一刻起计算 agent 确认的超时
+func (m *Manager) scheduleTask(ctx context.Context, task *Task) {
+	now := m.clock.Now().Unix()
+	if task.Action == "start" {
+		_, err := m.updatePluginPod(task.InstanceID, func(pluginPod *PluginPod) (*PluginPod, error) {
+			// killing 的插件等 agent 停止上报、记录被删除后再启动
+			if pluginPod != nil && (pluginPod.runtimeStatus == "running" || pluginPod.runtimeStatus == "pending" || pluginPod.runtimeStatus == "killing") {
+				return nil, nil
+			}
+			agent, err := m.pickAgent(ctx, placement.Request{InstanceID: task.InstanceID})
+			if err != nil {
+				return nil, err
+			}
+			return &PluginPod{
+				instanceID:    task.InstanceID,
+				version:       task.Version,
+				agentID:       agent.agentID,
+				agentIP:       agent.agentIP,
+				runtimeStatus: "pending",
+				lastTimeStamp: now,
+			}, nil
+		})
+		if err != nil {
+			// 没有放得下的 agent 时等 Monitor2 下一轮重新下发
+			log.Printf("manager %s: start %s: %v", m.election.ID(), task.InstanceID, err)
+			return
+		}
 
-				pluginPod.runtimeStatus = "killing"
-				runtimeValue, _ := json.Marshal(pluginPod)
-				m.etcdClient.Put(m.ctx, runtimeKey, string(runtimeValue))
+		// 推送到 agent
+	} else if task.Action == "upgrade" {
+		// 在原 agent 上替换版本，运行时已不存在时等 Monitor2 下一轮下发 start
+		_, err := m.updatePluginPod(task.InstanceID, func(pluginPod *PluginPod) (*PluginPod, error) {
+			if pluginPod == nil || pluginPod.runtimeStatus != "running" || pluginPod.version == task.Version {
+				return nil, nil
+			}
+			pluginPod.version = task.Version
+			pluginPod.runtimeStatus = "pending"
+			pluginPod.lastTimeStamp = now
+			return pluginPod, nil
+		})
+		if err != nil {
+			return
+		}
 
-				// 推送到 agent
+		// 推送到 agent
+	} else {
+		_, err := m.updatePluginPod(task.InstanceID, func(pluginPod *PluginPod) (*PluginPod, error) {
+			if pluginPod == nil || pluginPod.runtimeStatus == "killing" {
+				return nil, nil
 			}
+			pluginPod.runtimeStatus = "killing"
+			pluginPod.lastTimeStamp = now
+			return pluginPod, nil
+		})
+		if err != nil {
+			return
 		}
+
+		// 推送到 agent
 	}
 }
 
-func (m *Manager) Monitor1() {
-	for {
-		resp, err := m.etcdClient.Get(m.ctx, "/pluginRuntimes", clientv3.WithPrefix())
+// pickAgent 由 policy 在存储中的 agent 里选择，插件数为 agent 上报的运行中插件
+func (m *Manager) pickAgent(ctx context.Context, req placement.Request) (*Agent, error) {
+	kvs, _, err := m.store.List(ctx, "/agents/")
+	if err != nil {
+		return nil, err
+	}
+	agents := make(map[string]*Agent, len(kvs))
+	candidates := make([]placement.Agent, 0, len(kvs))
+	for _, kv := range kvs {
+		agent, err := decodeAgent(kv.Value)
 		if err != nil {
-			time.Sleep(10 * time.Second)
 			continue
 		}
+		agents[agent.agentID] = agent
+		candidates = append(candidates, placement.Agent{
+			ID:      agent.agentID,
+			Plugins: len(agent.runningPlugins),
+			CPU:     agent.cpu,
+			Memory:  agent.memory,
+		})
+	}
+	target, err := m.policy.Select(req, candidates)
+	if err != nil {
+		return nil, err
+	}
+	return agents[target.ID], nil
+}
 
-		for _, kv := range resp.Kvs {
-			var pluginPod PluginPod
-			json.Unmarshal(kv.Value, &pluginPod)
+// reportedUsage 以 agent 最近一次上报的使用量作为已分配的资源，单位与容量相同
+type reportedUsage struct {
+	m *Manager
+}
 
-			if time.Now().Second()-pluginPod.lastTimeStamp > 30 {
-				m.PushTask(&Task{
-					InstanceID: pluginPod.instanceID,
-					Version:    pluginPod.version,
-					Action:     "stop",
-				})
-			}
-		}
+func (u reportedUsage) Allocated(agentID string) (float64, float64) {
+	kv, err := u.m.store.Get(u.m.ctx, "/agents/"+agentID)
+	if err != nil {
+		return 0, 0
+	}
+	agent, err := decodeAgent(kv.Value)
+	if err != nil {
+		return 0, 0
+	}
+	return agent.usageCpu, agent.usageMemory
+}
 
-		time.Sleep(10 * time.Second)
+// Monitor1 通过 informer 监听插件运行时，记录变更时立即检查，
+// 超时依赖时间推进，由每 10 秒一次的 resync 基于本地缓存检查，不再轮询存储
+func (m *Manager) Monitor1() {
+	m.monitor1(m.ctx)
+}
+
+func (m *Manager) monitor1(ctx context.Context) {
+	informer := store.NewInformer(m.store, "/pluginRuntimes/", 10*time.Second)
+	informer.AddHandler(store.Handler{
+		OnAdd:    func(kv store.KeyValue) { m.checkPlugin(ctx, kv) },
+		OnUpdate: func(_, kv store.KeyValue) { m.checkPlugin(ctx, kv) },
+	})
+	informer.Run(ctx)
+}
+
+// checkPlugin 超时未上报的插件 push stop task。killing 的插件超时说明 agent 已停止上报，
+// 视为停止完成，删除记录后由 Monitor2 按期望状态重新下发
+func (m *Manager) checkPlugin(ctx context.Context, kv store.KeyValue) {
+	pluginPod, err := decodePluginPod(kv.Value)
+	if err != nil || !m.stale(pluginPod.lastTimeStamp, pluginTimeout) {
+		return
 	}
+
+	if pluginPod.runtimeStatus == "killing" {
+		// 期间有新的上报时放弃，下次检查再判断
+		if err := m.store.CompareAndDelete(ctx, kv.Key, kv.ModRevision); err != nil {
+			return
+		}
+		m.store.Delete(ctx, "/pluginMetrics/"+pluginPod.instanceID)
+		return
+	}
+	m.pushTask(ctx, &Task{
+		InstanceID: pluginPod.instanceID,
+		Version:    pluginPod.version,
+		Action:     "stop",
+	})
 }
 
-func (m *Manager) Monitor2() {
-	for {
-		// 获取当前业务状态为启用的插件列表，与当前运行时列表做对比
-		// 少的部分 push add task，多的部分 push stop task
+// 业务状态为启用的插件列表，key instanceID，val version
+type DesiredSource func(ctx context.Context) (map[string]string, error)
+
+func (m *Manager) Monitor2(source DesiredSource) {
+	m.monitor2(m.ctx, source)
+}
+
+// monitor2 少的部分 push start task，多的部分 push stop task，版本不一致的 push upgrade task，下发受 reconcileRate 限流
+func (m *Manager) monitor2(ctx context.Context, source DesiredSource) {
+	m.newReconciler(ctx, source).Run(ctx, reconcileInterval)
+}
+
+func (m *Manager) newReconciler(ctx context.Context, source DesiredSource) *reconcile.Reconciler {
+	desired := reconcile.SourceFunc(func(ctx context.Context) ([]reconcile.Desired, error) {
+		plugins, err := source(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return reconcile.FromVersions(plugins), nil
+	})
+	pusher := reconcile.PusherFunc(func(task reconcile.Task) {
+		m.pushTask(ctx, &Task{InstanceID: task.InstanceID, Version: task.Version, Action: string(task.Action)})
+	})
+	return reconcile.New(desired, reconcile.RuntimesFunc(m.runtimes), pusher, reconcileRate, reconcileBurst)
+}
 
-		time.Sleep(30 * time.Second)
+// runtimes 存储中的插件运行时，pending 和等待 agent 确认停止的 killing 视为调度中
+func (m *Manager) runtimes(ctx context.Context) ([]reconcile.Runtime, error) {
+	kvs, _, err := m.store.List(ctx, "/pluginRuntimes/")
+	if err != nil {
+		return nil, err
 	}
+	var runtimes []reconcile.Runtime
+	for _, kv := range kvs {
+		pluginPod, err := decodePluginPod(kv.Value)
+		if err != nil {
+			continue
+		}
+		runtimes = append(runtimes, reconcile.Runtime{
+			InstanceID: pluginPod.instanceID,
+			Version:    pluginPod.version,
+			Pending:    pluginPod.runtimeStatus == "pending" || pluginPod.runtimeStatus == "killing",
+		})
+	}
+	return runtimes, nil
 }
 
+// Monitor3 agent 记录随租约过期自动删除，这里监听删除事件，并在启动时对比一次已有的 agent，
+// 把已不存在的 agent 上的插件 push stop task，由 Monitor2 对账后重新调度
 func (m *Manager) Monitor3() {
-	for {
-		resp, err := m.etcdClient.Get(m.ctx, "/agents", clientv3.WithPrefix())
+	m.monitor3(m.ctx)
+}
+
+func (m *Manager) monitor3(ctx context.Context) {
+	informer := store.NewInformer(m.store, "/agents/", 0)
+	informer.AddHandler(store.Handler{
+		OnDelete: func(kv store.KeyValue) { m.agentGone(ctx, kv) },
+	})
+
+	// 删除事件只覆盖本副本当选之后，首次同步后再对比一次，
+	// 处理 leader 切换期间租约过期的 agent
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+		case <-informer.Synced():
+			m.stopOrphans(ctx, informer.List())
+		}
+	}()
+	informer.Run(ctx)
+	wg.Wait()
+}
+
+// stopOrphans 所在 agent 已不在 agents 中的插件 push stop task
+func (m *Manager) stopOrphans(ctx context.Context, agents []store.KeyValue) {
+	alive := make(map[string]bool, len(agents))
+	for _, kv := range agents {
+		agent, err := decodeAgent(kv.Value)
 		if err != nil {
-			time.Sleep(10 * time.Second)
 			continue
 		}
+		alive[agent.agentID] = true
+	}
+	kvs, _, err := m.store.List(ctx, "/pluginRuntimes/")
+	if err != nil {
+		log.Printf("manager %s: list plugin runtimes: %v", m.election.ID(), err)
+		return
+	}
+	for _, kv := range kvs {
+		pluginPod, err := decodePluginPod(kv.Value)
+		// 还未分配 agent 的插件不算孤儿
+		if err != nil || pluginPod.agentID == "" || alive[pluginPod.agentID] {
+			continue
+		}
+		m.pushTask(ctx, &Task{
+			InstanceID: pluginPod.instanceID,
+			Version:    pluginPod.version,
+			Action:     "stop",
+		})
+	}
+}
 
-		for _, kv := range resp.Kvs {
-			var agent Agent
-			json.Unmarshal(kv.Value, &agent)
+func (m *Manager) agentGone(ctx context.Context, kv store.KeyValue) {
+	agent, err := decodeAgent(kv.Value)
+	if err != nil {
+		return
+	}
+	kvs, _, err := m.store.List(ctx, "/pluginRuntimes/")
+	if err != nil {
+		return
+	}
+	for _, kv := range kvs {
+		pluginPod, err := decodePluginPod(kv.Value)
+		if err != nil || pluginPod.agentID != agent.agentID {
+			continue
+		}
+		m.pushTask(ctx, &Task{
+			InstanceID: pluginPod.instanceID,
+			Version:    pluginPod.version,
+			Action:     "stop",
+		})
+	}
+}
 
-			if time.Now().Second()-agent.lastTimestamp > 60 {
-				s, err := concurrency.NewSession(m.etcdClient)
+// 注册调度队列、agent 数量和插件运行时状态指标，抓取时读取存储
+func (m *Manager) RegisterMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(metrics.NewGaugeFunc("manager_task_queue_depth", "Tasks waiting in the schedule queue.", nil, func(emit metrics.Emit) {
+		emit(float64(len(m.taskQueue)))
+	}))
+	reg.MustRegister(metrics.NewGaugeFunc("manager_agents", "Registered agents.", nil, func(emit metrics.Emit) {
+		kvs, _, err := m.store.List(m.ctx, "/agents/")
+		if err != nil {
+			return
+		}
+		count := 0
+		for _, kv := range kvs {
+			if _, err := decodeAgent(kv.Value); err == nil {
+				count++
+			}
+		}
+		emit(float64(count))
+	}))
+	reg.MustRegister(metrics.NewGaugeFunc("manager_plugin_runtimes", "Plugin runtimes by status.", []string{"status"}, func(emit metrics.Emit) {
+		kvs, _, err := m.store.List(m.ctx, "/pluginRuntimes/")
+		if err != nil {
+			return
+		}
+		counts := make(map[string]int)
+		for _, kv := range kvs {
+			pluginPod, err := decodePluginPod(kv.Value)
+			if err != nil {
+				continue
+			}
+			counts[pluginPod.runtimeStatus]++
+		}
+		for status, count := range counts {
+			emit(float64(count), status)
+		}
+	}))
+	for _, gauge := range []struct {
+		name  string
+		help  string
+		value func(metric *PluginMetric) float64
+	}{
+		{"manager_plugin_cpu_cores", "Latest reported CPU usage by plugin instance.", func(metric *PluginMetric) float64 { return metric.cpu }},
+		{"manager_plugin_memory_bytes", "Latest reported memory usage by plugin instance.", func(metric *PluginMetric) float64 { return metric.memory }},
+	} {
+		value := gauge.value
+		reg.MustRegister(metrics.NewGaugeFunc(gauge.name, gauge.help, []string{"instance"}, func(emit metrics.Emit) {
+			kvs, _, err := m.store.List(m.ctx, "/pluginMetrics/")
+			if err != nil {
+				return
+			}
+			for _, kv := range kvs {
+				metric, err := decodePluginMetric(kv.Value)
 				if err != nil {
 					continue
 				}
-				defer s.Close()
-				mu := concurrency.NewMutex(s, "/locks/agent_cleanup")
-
-				if err := mu.Lock(m.ctx); err != nil {
-					continue
-				}
-
-				m.etcdClient.Delete(m.ctx, "/agents/"+agent.agentID)
-				mu.Unlock(m.ctx)
+				emit(value(metric), strings.TrimPrefix(kv.Key, "/pluginMetrics/"))
 			}
-		}
-
-		time.Sleep(10 * time.Second)
+		}))
 	}
 }
@@ -0,0 +1,330 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"code/platform/internal/clock"
+	"code/platform/v4/store"
+)
+
+func newTestManager(t *testing.T) (*Manager, *store.MemoryStore, *clock.Fake) {
+	t.Helper()
+	st := store.NewMemoryStore()
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	st.SetClock(fake)
+	m, err := NewManagerWithStore(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetClock(fake)
+	return m, st, fake
+}
+
+func report(t *testing.T, m *Manager, agentID string, instanceIDs ...string) {
+	t.Helper()
+	items := make(map[string]PluginReportItem)
+	for _, id := range instanceIDs {
+		items[id] = PluginReportItem{instanceID: id, version: "v1"}
+	}
+	if _, err := m.Report(&Agent{agentID: agentID, agentIP: "10.0.0.1"}, items); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func drain(m *Manager) []Task {
+	var tasks []Task
+	for len(m.taskQueue) > 0 {
+		tasks = append(tasks, *<-m.taskQueue)
+	}
+	return tasks
+}
+
+func TestStale(t *testing.T) {
+	m, _, fake := newTestManager(t)
+	now := fake.Now().Unix()
+	tests := []struct {
+		name string
+		last int64
+		want bool
+	}{
+		{"just reported", now, false},
+		{"at timeout", now - 30, false},
+		{"past timeout", now - 31, true},
+		{"clock behind the writer", now + 5, false},
+	}
+	for _, tt := range tests {
+		if got := m.stale(tt.last, pluginTimeout); got != tt.want {
+			t.Errorf("%s: stale = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPluginStopsStalePlugin(t *testing.T) {
+	m, st, fake := newTestManager(t)
+	ctx := context.Background()
+	report(t, m, "a1", "i1")
+
+	kv, err := st.Get(ctx, "/pluginRuntimes/i1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.checkPlugin(ctx, kv)
+	if tasks := drain(m); len(tasks) != 0 {
+		t.Fatalf("fresh plugin pushed %+v", tasks)
+	}
+
+	fake.Advance(pluginTimeout + time.Second)
+	m.checkPlugin(ctx, kv)
+	tasks := drain(m)
+	if len(tasks) != 1 || tasks[0] != (Task{InstanceID: "i1", Version: "v1", Action: "stop"}) {
+		t.Fatalf("tasks = %+v, want stop i1", tasks)
+	}
+}
+
+func TestAgentExpiresWithoutReports(t *testing.T) {
+	m, st, fake := newTestManager(t)
+	ctx := context.Background()
+	report(t, m, "a1", "i1")
+
+	// 持续上报会续约，不会过期
+	fake.Advance(agentTimeout - time.Second)
+	report(t, m, "a1", "i1")
+	fake.Advance(agentTimeout - time.Second)
+	st.ExpireLeases()
+	kv, err := st.Get(ctx, "/agents/a1")
+	if err != nil {
+		t.Fatalf("agent expired while reporting: %v", err)
+	}
+
+	fake.Advance(2 * time.Second)
+	st.ExpireLeases()
+	if _, err := st.Get(ctx, "/agents/a1"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("agent after timeout: err = %v, want ErrNotFound", err)
+	}
+
+	// 前缀相近的其他记录不属于插件运行时
+	archived, err := encodePluginPod(&PluginPod{instanceID: "i9", version: "v1", agentID: "a1", runtimeStatus: "running"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Put(ctx, "/pluginRuntimesArchive/i9", archived, store.NoLease); err != nil {
+		t.Fatal(err)
+	}
+
+	m.agentGone(ctx, kv)
+	tasks := drain(m)
+	if len(tasks) != 1 || tasks[0] != (Task{InstanceID: "i1", Version: "v1", Action: "stop"}) {
+		t.Fatalf("tasks = %+v, want stop i1", tasks)
+	}
+}
+
+// leaseStore 统计未撤销的租约，Grant 时稍作停顿放大并发窗口
+type leaseStore struct {
+	*store.MemoryStore
+	live atomic.Int64
+}
+
+func (s *leaseStore) Grant(ctx context.Context, ttl time.Duration) (store.LeaseID, error) {
+	time.Sleep(10 * time.Millisecond)
+	lease, err := s.MemoryStore.Grant(ctx, ttl)
+	if err == nil {
+		s.live.Add(1)
+	}
+	return lease, err
+}
+
+func (s *leaseStore) Revoke(ctx context.Context, id store.LeaseID) error {
+	s.live.Add(-1)
+	return s.MemoryStore.Revoke(ctx, id)
+}
+
+func TestConcurrentReportsShareAgentLease(t *testing.T) {
+	st := &leaseStore{MemoryStore: store.NewMemoryStore()}
+	m, err := NewManagerWithStore(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.Report(&Agent{agentID: "a1"}, nil); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := st.live.Load(); n != 1 {
+		t.Fatalf("%d agent leases granted, want 1", n)
+	}
+	kv, err := st.Get(context.Background(), "/agents/a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.KeepAlive(context.Background(), kv.Lease); err != nil {
+		t.Fatalf("agent record not bound to the live lease: %v", err)
+	}
+}
+
+func TestMonitor3StopsPluginsOfMissingAgents(t *testing.T) {
+	m, st, _ := newTestManager(t)
+	// a1 的租约在上一个 leader 任期内过期，记录已被删除，只剩运行时
+	report(t, m, "a1", "i1")
+	report(t, m, "a2", "i2")
+	if err := m.UnRegisterAgent("a1"); err != nil {
+		t.Fatal(err)
+	}
+	// 尚未分配 agent 的插件不受影响
+	if _, err := m.updatePluginPod("i3", func(*PluginPod) (*PluginPod, error) {
+		return &PluginPod{instanceID: "i3", version: "v1", runtimeStatus: "pending"}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.monitor3(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	want := Task{InstanceID: "i1", Version: "v1", Action: "stop"}
+	select {
+	case task := <-m.taskQueue:
+		if *task != want {
+			t.Fatalf("task = %+v, want %+v", *task, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no stop task for the plugin of the missing agent")
+	}
+
+	// 之后删除的 agent 由删除事件处理
+	kv, err := st.Get(ctx, "/agents/a2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Revoke(ctx, kv.Lease)
+	want = Task{InstanceID: "i2", Version: "v1", Action: "stop"}
+	select {
+	case task := <-m.taskQueue:
+		if *task != want {
+			t.Fatalf("task = %+v, want %+v", *task, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no stop task after agent a2 expired")
+	}
+	if tasks := drain(m); len(tasks) != 0 {
+		t.Fatalf("unexpected tasks %+v", tasks)
+	}
+}
+
+func TestKillingPluginDeletedOnceStopped(t *testing.T) {
+	m, st, fake := newTestManager(t)
+	ctx := context.Background()
+	report(t, m, "a1", "i1")
+	fake.Advance(pluginTimeout + time.Second)
+	kv, _ := st.Get(ctx, "/pluginRuntimes/i1")
+	m.checkPlugin(ctx, kv)
+	for _, task := range drain(m) {
+		m.scheduleTask(ctx, &task)
+	}
+
+	// 标记 killing 时刷新时间，不会立即再次下发 stop
+	kv, _ = st.Get(ctx, "/pluginRuntimes/i1")
+	m.checkPlugin(ctx, kv)
+	if tasks := drain(m); len(tasks) != 0 {
+		t.Fatalf("killing plugin pushed %+v", tasks)
+	}
+	// agent 确认停止前 start 不会接手 killing 的记录，对账也不会下发
+	m.scheduleTask(ctx, &Task{InstanceID: "i1", Version: "v1", Action: "start"})
+	pluginPod, _, err := m.getPluginPod("i1")
+	if err != nil || pluginPod.runtimeStatus != "killing" {
+		t.Fatalf("record = %+v, %v, want killing", pluginPod, err)
+	}
+	source := func(ctx context.Context) (map[string]string, error) { return map[string]string{"i1": "v1"}, nil }
+	if res, _ := m.newReconciler(ctx, source).Reconcile(ctx); res.Started != 0 {
+		t.Fatalf("reconcile = %+v, want nothing while killing", res)
+	}
+
+	// 仍在上报时保持 killing
+	fake.Advance(pluginTimeout - time.Second)
+	report(t, m, "a1", "i1")
+	fake.Advance(2 * time.Second)
+	kv, _ = st.Get(ctx, "/pluginRuntimes/i1")
+	m.checkPlugin(ctx, kv)
+	if _, err := st.Get(ctx, "/pluginRuntimes/i1"); err != nil {
+		t.Fatalf("record deleted while agent still reporting: %v", err)
+	}
+
+	// 停止上报后删除记录，不再下发 stop
+	fake.Advance(pluginTimeout)
+	kv, _ = st.Get(ctx, "/pluginRuntimes/i1")
+	m.checkPlugin(ctx, kv)
+	if _, err := st.Get(ctx, "/pluginRuntimes/i1"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("stopped plugin record: err = %v, want ErrNotFound", err)
+	}
+	if _, err := st.Get(ctx, "/pluginMetrics/i1"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("stopped plugin metric: err = %v, want ErrNotFound", err)
+	}
+	if tasks := drain(m); len(tasks) != 0 {
+		t.Fatalf("tasks = %+v, want none", tasks)
+	}
+	if res, _ := m.newReconciler(ctx, source).Reconcile(ctx); res.Started != 1 {
+		t.Fatalf("reconcile = %+v, want i1 started again", res)
+	}
+}
+
+func TestStartPlacesByCapacity(t *testing.T) {
+	const gib = 1 << 30
+	m, _, _ := newTestManager(t)
+	ctx := context.Background()
+	for _, agent := range []*Agent{
+		// 使用量超过容量，放不下
+		{agentID: "a1", agentIP: "10.0.0.1", cpu: 4, memory: 8 * gib, usageCpu: 5, usageMemory: gib},
+		{agentID: "a2", agentIP: "10.0.0.2", cpu: 8, memory: 16 * gib, usageCpu: 6, usageMemory: 12 * gib},
+		{agentID: "a3", agentIP: "10.0.0.3", cpu: 8, memory: 16 * gib, usageCpu: 1, usageMemory: gib},
+		// 没有上报容量，不参与装箱
+		{agentID: "a4", agentIP: "10.0.0.4"},
+	} {
+		if _, err := m.Report(agent, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m.scheduleTask(ctx, &Task{InstanceID: "i1", Version: "v1", Action: "start"})
+	pluginPod, _, err := m.getPluginPod("i1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a2 放入后剩余最少
+	if pluginPod.agentID != "a2" || pluginPod.agentIP != "10.0.0.2" || pluginPod.runtimeStatus != "pending" || pluginPod.version != "v1" {
+		t.Fatalf("record = %+v, want pending on a2", pluginPod)
+	}
+
+	// 已在调度中的插件不重复选择
+	m.scheduleTask(ctx, &Task{InstanceID: "i1", Version: "v1", Action: "start"})
+	if again, _, _ := m.getPluginPod("i1"); again.agentID != "a2" || again.resourceVersion != pluginPod.resourceVersion {
+		t.Fatalf("record = %+v, want unchanged", again)
+	}
+
+	if err := m.UnRegisterAgent("a2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.UnRegisterAgent("a3"); err != nil {
+		t.Fatal(err)
+	}
+	m.scheduleTask(ctx, &Task{InstanceID: "i2", Version: "v1", Action: "start"})
+	if _, _, err := m.getPluginPod("i2"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("i2 without a fitting agent: err = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,142 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+
+	"code/platform/v4/codec"
+)
+
+// ErrEmptyRecord 记录解码后没有标识字段，通常是迁移自历史 {} 的数据，调用方应跳过
+var ErrEmptyRecord = errors.New("manager: empty record")
+
+// 之前的版本直接 json.Marshal 只有未导出字段的结构体，写入的都是 {}，没有可以恢复的数据，
+// 迁移后解码返回 ErrEmptyRecord
+func fromEmptyObject(data json.RawMessage) (json.RawMessage, error) {
+	return json.RawMessage("{}"), nil
+}
+
+var (
+	agentCodec        = codec.New("agent", 1).Register(0, fromEmptyObject)
+	pluginPodCodec    = codec.New("plugin_pod", 1).Register(0, fromEmptyObject)
+	pluginMetricCodec = codec.New("plugin_metric", 1).Register(0, fromEmptyObject)
+)
+
+// agentRecord /agents/{agentID} 的 v1 schema
+type agentRecord struct {
+	AgentID        string   `json:"agent_id"`
+	AgentIP        string   `json:"agent_ip"`
+	CPU            float64  `json:"cpu"`
+	Memory         float64  `json:"memory"`
+	UsageCPU       float64  `json:"usage_cpu"`
+	UsageMemory    float64  `json:"usage_memory"`
+	RunningPlugins []string `json:"running_plugins"`
+	LastTimestamp  int64    `json:"last_timestamp"`
+}
+
+// pluginPodRecord /pluginRuntimes/{instanceID} 的 v1 schema。
+// resourceVersion 取自存储的 ModRevision，旧数据里的 resource_version 字段解码时忽略
+type pluginPodRecord struct {
+	RuntimeStatus string `json:"runtime_status"`
+	InstanceID    string `json:"instance_id"`
+	Version       string `json:"version"`
+	AgentID       string `json:"agent_id"`
+	AgentIP       string `json:"agent_ip"`
+	LastTimeStamp int64  `json:"last_timestamp"`
+}
+
+// pluginMetricRecord /pluginMetrics/{instanceID} 的 v1 schema
+type pluginMetricRecord struct {
+	PID    string  `json:"pid"`
+	CPU    float64 `json:"cpu"`
+	Memory float64 `json:"memory"`
+	Time   int64   `json:"time"`
+}
+
+func encodeAgent(a *Agent) ([]byte, error) {
+	return agentCodec.Encode(agentRecord{
+		AgentID:        a.agentID,
+		AgentIP:        a.agentIP,
+		CPU:            a.cpu,
+		Memory:         a.memory,
+		UsageCPU:       a.usageCpu,
+		UsageMemory:    a.usageMemory,
+		RunningPlugins: a.runningPlugins,
+		LastTimestamp:  a.lastTimestamp,
+	})
+}
+
+func decodeAgent(data []byte) (*Agent, error) {
+	var r agentRecord
+	if err := agentCodec.Decode(data, &r); err != nil {
+		return nil, err
+	}
+	if r.AgentID == "" {
+		return nil, ErrEmptyRecord
+	}
+	return &Agent{
+		agentID:        r.AgentID,
+		agentIP:        r.AgentIP,
+		cpu:            r.CPU,
+		memory:         r.Memory,
+		usageCpu:       r.UsageCPU,
+		usageMemory:    r.UsageMemory,
+		runningPlugins: r.RunningPlugins,
+		lastTimestamp:  r.LastTimestamp,
+	}, nil
+}
+
+func encodePluginPod(p *PluginPod) ([]byte, error) {
+	return pluginPodCodec.Encode(pluginPodRecord{
+		RuntimeStatus: p.runtimeStatus,
+		InstanceID:    p.instanceID,
+		Version:       p.version,
+		AgentID:       p.agentID,
+		AgentIP:       p.agentIP,
+		LastTimeStamp: p.lastTimeStamp,
+	})
+}
+
+func decodePluginPod(data []byte) (*PluginPod, error) {
+	var r pluginPodRecord
+	if err := pluginPodCodec.Decode(data, &r); err != nil {
+		return nil, err
+	}
+	if r.InstanceID == "" {
+		return nil, ErrEmptyRecord
+	}
+	return &PluginPod{
+		runtimeStatus: r.RuntimeStatus,
+		instanceID:    r.InstanceID,
+		version:       r.Version,
+		agentID:       r.AgentID,
+		agentIP:       r.AgentIP,
+		lastTimeStamp: r.LastTimeStamp,
+	}, nil
+}
+
+func encodePluginMetric(m *PluginMetric) ([]byte, error) {
+	return pluginMetricCodec.Encode(pluginMetricRecord{
+		PID:    m.pid,
+		CPU:    m.cpu,
+		Memory: m.memory,
+		Time:   m.time,
+	})
+}
+
+func decodePluginMetric(data []byte) (*PluginMetric, error) {
+	var r pluginMetricRecord
+	if err := pluginMetricCodec.Decode(data, &r); err != nil {
+		return nil, err
+	}
+	if r.Time == 0 {
+		// 指标记录没有标识字段，以采样时间判断
+		return nil, ErrEmptyRecord
+	}
+	return &PluginMetric{
+		pid:    r.PID,
+		cpu:    r.CPU,
+		memory: r.Memory,
+		time:   r.Time,
+	}, nil
+}
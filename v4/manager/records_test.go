@@ -0,0 +1,150 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"code/platform/v4/store"
+)
+
+func TestRecordsRoundTrip(t *testing.T) {
+	agent := &Agent{
+		agentID:        "a1",
+		agentIP:        "10.0.0.1",
+		cpu:            4,
+		memory:         8 << 30,
+		usageCpu:       1.5,
+		usageMemory:    1 << 30,
+		runningPlugins: []string{"i1", "i2"},
+		lastTimestamp:  1700000000,
+	}
+	raw, err := encodeAgent(agent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotAgent, err := decodeAgent(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotAgent, agent) {
+		t.Errorf("agent = %+v, want %+v", gotAgent, agent)
+	}
+
+	pod := &PluginPod{
+		runtimeStatus: "running",
+		instanceID:    "i1",
+		version:       "v1",
+		agentID:       "a1",
+		agentIP:       "10.0.0.1",
+		lastTimeStamp: 1700000000,
+	}
+	raw, err = encodePluginPod(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotPod, err := decodePluginPod(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *gotPod != *pod {
+		t.Errorf("plugin pod = %+v, want %+v", gotPod, pod)
+	}
+
+	metric := &PluginMetric{pid: "42", cpu: 0.5, memory: 1 << 20, time: 1700000000}
+	raw, err = encodePluginMetric(metric)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotMetric, err := decodePluginMetric(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *gotMetric != *metric {
+		t.Errorf("plugin metric = %+v, want %+v", gotMetric, metric)
+	}
+}
+
+func TestLegacyEmptyRecords(t *testing.T) {
+	legacy := []byte("{}")
+	if _, err := decodeAgent(legacy); !errors.Is(err, ErrEmptyRecord) {
+		t.Errorf("agent: err = %v, want ErrEmptyRecord", err)
+	}
+	if _, err := decodePluginPod(legacy); !errors.Is(err, ErrEmptyRecord) {
+		t.Errorf("plugin pod: err = %v, want ErrEmptyRecord", err)
+	}
+	if _, err := decodePluginMetric(legacy); !errors.Is(err, ErrEmptyRecord) {
+		t.Errorf("plugin metric: err = %v, want ErrEmptyRecord", err)
+	}
+}
+
+func TestLegacyRuntimeSkippedAndOverwritten(t *testing.T) {
+	m, st, _ := newTestManager(t)
+	ctx := context.Background()
+	if _, err := st.Put(ctx, "/pluginRuntimes/i1", []byte("{}"), store.NoLease); err != nil {
+		t.Fatal(err)
+	}
+	kv, err := st.Get(ctx, "/pluginRuntimes/i1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 空记录的上报时间为 0，但不会被当成 instanceID 为空的插件下发停止
+	m.checkPlugin(ctx, kv)
+	if tasks := drain(m); len(tasks) != 0 {
+		t.Fatalf("legacy record pushed %+v", tasks)
+	}
+	runtimes, err := m.runtimes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runtimes) != 0 {
+		t.Fatalf("runtimes = %+v, want legacy record skipped", runtimes)
+	}
+
+	// 上报时覆盖空记录
+	report(t, m, "a1", "i1")
+	pod, _, err := m.getPluginPod("i1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pod == nil || pod.instanceID != "i1" || pod.agentID != "a1" {
+		t.Fatalf("plugin pod after report = %+v", pod)
+	}
+}
+
+func TestPluginUsageMetrics(t *testing.T) {
+	m, st, _ := newTestManager(t)
+	ctx := context.Background()
+	if _, err := st.Put(ctx, "/pluginMetrics/legacy", []byte("{}"), store.NoLease); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Report(&Agent{agentID: "a1"}, map[string]PluginReportItem{
+		"i1": {instanceID: "i1", version: "v1", PluginMetric: PluginMetric{pid: "42", cpu: 0.5, memory: 1024}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	reg := prometheus.NewRegistry()
+	m.RegisterMetrics(reg)
+	// 旧格式的 legacy 记录不导出
+	want := `
+# HELP manager_agents Registered agents.
+# TYPE manager_agents gauge
+manager_agents 1
+# HELP manager_plugin_cpu_cores Latest reported CPU usage by plugin instance.
+# TYPE manager_plugin_cpu_cores gauge
+manager_plugin_cpu_cores{instance="i1"} 0.5
+# HELP manager_plugin_memory_bytes Latest reported memory usage by plugin instance.
+# TYPE manager_plugin_memory_bytes gauge
+manager_plugin_memory_bytes{instance="i1"} 1024
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "manager_agents", "manager_plugin_cpu_cores", "manager_plugin_memory_bytes"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,169 @@
+package etcdstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/etcdserver/api/v3rpc/rpctypes"
+	"go.etcd.io/etcd/mvcc/mvccpb"
+
+	"code/platform/v4/store"
+)
+
+// Store 基于 etcd v3 的 store.Store 实现
+type Store struct {
+	client *clientv3.Client
+}
+
+func New(client *clientv3.Client) *Store {
+	return &Store{client: client}
+}
+
+func (s *Store) Get(ctx context.Context, key string) (store.KeyValue, error) {
+	resp, err := s.client.Get(ctx, key)
+	if err != nil {
+		return store.KeyValue{}, err
+	}
+	if len(resp.Kvs) == 0 {
+		return store.KeyValue{}, store.ErrNotFound
+	}
+	return fromKV(resp.Kvs[0]), nil
+}
+
+func (s *Store) List(ctx context.Context, prefix string) ([]store.KeyValue, int64, error) {
+	resp, err := s.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+	kvs := make([]store.KeyValue, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		kvs = append(kvs, fromKV(kv))
+	}
+	return kvs, resp.Header.Revision, nil
+}
+
+func (s *Store) Put(ctx context.Context, key string, value []byte, lease store.LeaseID) (int64, error) {
+	resp, err := s.client.Put(ctx, key, string(value), leaseOpts(lease)...)
+	if err != nil {
+		return 0, leaseErr(err)
+	}
+	return resp.Header.Revision, nil
+}
+
+func (s *Store) Delete(ctx context.Context, key string) error {
+	_, err := s.client.Delete(ctx, key)
+	return err
+}
+
+func (s *Store) CompareAndSwap(ctx context.Context, key string, value []byte, rev int64, lease store.LeaseID) (int64, error) {
+	cmp := clientv3.Compare(clientv3.ModRevision(key), "=", rev)
+	if rev == 0 {
+		cmp = clientv3.Compare(clientv3.CreateRevision(key), "=", 0)
+	}
+	resp, err := s.client.Txn(ctx).
+		If(cmp).
+		Then(clientv3.OpPut(key, string(value), leaseOpts(lease)...)).
+		Commit()
+	if err != nil {
+		return 0, leaseErr(err)
+	}
+	if !resp.Succeeded {
+		return 0, store.ErrConflict
+	}
+	return resp.Header.Revision, nil
+}
+
+func (s *Store) CompareAndDelete(ctx context.Context, key string, rev int64) error {
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", rev)).
+		Then(clientv3.OpDelete(key)).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return store.ErrConflict
+	}
+	return nil
+}
+
+func (s *Store) Watch(ctx context.Context, prefix string, rev int64) <-chan store.Event {
+	opts := []clientv3.OpOption{clientv3.WithPrefix()}
+	if rev > 0 {
+		opts = append(opts, clientv3.WithRev(rev+1))
+	}
+	out := make(chan store.Event)
+	go func() {
+		defer close(out)
+		for wr := range s.client.Watch(ctx, prefix, opts...) {
+			// 压缩或其他错误都关闭通道，由调用方重新 List
+			if wr.Err() != nil {
+				return
+			}
+			for _, ev := range wr.Events {
+				e := store.Event{Type: store.EventPut, KV: fromKV(ev.Kv)}
+				if ev.Type == clientv3.EventTypeDelete {
+					e.Type = store.EventDelete
+					e.KV = store.KeyValue{Key: string(ev.Kv.Key), ModRevision: ev.Kv.ModRevision}
+				}
+				select {
+				case out <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+func (s *Store) Grant(ctx context.Context, ttl time.Duration) (store.LeaseID, error) {
+	seconds := int64(ttl / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	resp, err := s.client.Grant(ctx, seconds)
+	if err != nil {
+		return 0, err
+	}
+	return store.LeaseID(resp.ID), nil
+}
+
+func (s *Store) KeepAlive(ctx context.Context, id store.LeaseID) error {
+	_, err := s.client.KeepAliveOnce(ctx, clientv3.LeaseID(id))
+	return leaseErr(err)
+}
+
+func (s *Store) Revoke(ctx context.Context, id store.LeaseID) error {
+	_, err := s.client.Revoke(ctx, clientv3.LeaseID(id))
+	if errors.Is(err, rpctypes.ErrLeaseNotFound) {
+		return nil
+	}
+	return err
+}
+
+func leaseOpts(lease store.LeaseID) []clientv3.OpOption {
+	if lease == store.NoLease {
+		return nil
+	}
+	return []clientv3.OpOption{clientv3.WithLease(clientv3.LeaseID(lease))}
+}
+
+func leaseErr(err error) error {
+	if errors.Is(err, rpctypes.ErrLeaseNotFound) {
+		return store.ErrLeaseNotFound
+	}
+	return err
+}
+
+func fromKV(kv *mvccpb.KeyValue) store.KeyValue {
+	return store.KeyValue{
+		Key:            string(kv.Key),
+		Value:          kv.Value,
+		CreateRevision: kv.CreateRevision,
+		ModRevision:    kv.ModRevision,
+		Lease:          store.LeaseID(kv.Lease),
+	}
+}
@@ -0,0 +1,208 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 重新 List 的最短间隔，避免存储不可用时空转
+const relistBackoff = time.Second
+
+// Handler 缓存变更回调，在 Informer.Run 所在的 goroutine 中依次调用。
+// resync 时对每个缓存中的 key 调用 OnUpdate(kv, kv)
+type Handler struct {
+	OnAdd    func(kv KeyValue)
+	OnUpdate func(old, kv KeyValue)
+	// OnDelete 收到删除前最后一次缓存的值
+	OnDelete func(kv KeyValue)
+}
+
+// Informer 先 List 一次再 Watch prefix，在本地维护一份缓存并分发变更，
+// Watch 中断时重新 List 并对比缓存补发事件
+type Informer struct {
+	store  Store
+	prefix string
+	resync time.Duration
+
+	mu       sync.RWMutex
+	cache    map[string]KeyValue
+	handlers []Handler
+	synced   chan struct{}
+}
+
+// NewInformer resync 为 0 时不做定期 resync
+func NewInformer(s Store, prefix string, resync time.Duration) *Informer {
+	return &Informer{
+		store:  s,
+		prefix: prefix,
+		resync: resync,
+		cache:  make(map[string]KeyValue),
+		synced: make(chan struct{}),
+	}
+}
+
+// AddHandler 需要在 Run 之前调用
+func (inf *Informer) AddHandler(h Handler) {
+	inf.mu.Lock()
+	defer inf.mu.Unlock()
+	inf.handlers = append(inf.handlers, h)
+}
+
+// Synced 首次 List 完成后关闭
+func (inf *Informer) Synced() <-chan struct{} {
+	return inf.synced
+}
+
+func (inf *Informer) Get(key string) (KeyValue, bool) {
+	inf.mu.RLock()
+	defer inf.mu.RUnlock()
+	kv, ok := inf.cache[key]
+	return kv, ok
+}
+
+// List 按 key 排序返回缓存内容
+func (inf *Informer) List() []KeyValue {
+	inf.mu.RLock()
+	defer inf.mu.RUnlock()
+	kvs := make([]KeyValue, 0, len(inf.cache))
+	for _, kv := range inf.cache {
+		kvs = append(kvs, kv)
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	return kvs
+}
+
+// Run 阻塞直到 ctx 结束
+func (inf *Informer) Run(ctx context.Context) {
+	var tick <-chan time.Time
+	if inf.resync > 0 {
+		ticker := time.NewTicker(inf.resync)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for ctx.Err() == nil {
+		rev, err := inf.relist(ctx)
+		if err != nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(relistBackoff):
+			}
+			continue
+		}
+
+		wctx, cancel := context.WithCancel(ctx)
+		events := inf.store.Watch(wctx, inf.prefix, rev)
+	watch:
+		for {
+			select {
+			case ev, ok := <-events:
+				if !ok {
+					break watch
+				}
+				inf.apply(ev)
+			case <-tick:
+				inf.resyncAll()
+			}
+		}
+		cancel()
+	}
+}
+
+// relist 用全量数据替换缓存，并对差异补发事件
+func (inf *Informer) relist(ctx context.Context) (int64, error) {
+	kvs, rev, err := inf.store.List(ctx, inf.prefix)
+	if err != nil {
+		return 0, err
+	}
+	fresh := make(map[string]KeyValue, len(kvs))
+	for _, kv := range kvs {
+		fresh[kv.Key] = kv
+	}
+
+	inf.mu.Lock()
+	old := inf.cache
+	inf.cache = fresh
+	handlers := inf.handlers
+	inf.mu.Unlock()
+
+	for _, kv := range kvs {
+		prev, ok := old[kv.Key]
+		switch {
+		case !ok:
+			dispatchAdd(handlers, kv)
+		case prev.ModRevision != kv.ModRevision:
+			dispatchUpdate(handlers, prev, kv)
+		}
+	}
+	for key, prev := range old {
+		if _, ok := fresh[key]; !ok {
+			dispatchDelete(handlers, prev)
+		}
+	}
+
+	select {
+	case <-inf.synced:
+	default:
+		close(inf.synced)
+	}
+	return rev, nil
+}
+
+func (inf *Informer) apply(ev Event) {
+	inf.mu.Lock()
+	prev, existed := inf.cache[ev.KV.Key]
+	if ev.Type == EventDelete {
+		delete(inf.cache, ev.KV.Key)
+	} else {
+		inf.cache[ev.KV.Key] = ev.KV
+	}
+	handlers := inf.handlers
+	inf.mu.Unlock()
+
+	switch {
+	case ev.Type == EventDelete:
+		if existed {
+			dispatchDelete(handlers, prev)
+		}
+	case existed:
+		dispatchUpdate(handlers, prev, ev.KV)
+	default:
+		dispatchAdd(handlers, ev.KV)
+	}
+}
+
+func (inf *Informer) resyncAll() {
+	inf.mu.RLock()
+	handlers := inf.handlers
+	inf.mu.RUnlock()
+	for _, kv := range inf.List() {
+		dispatchUpdate(handlers, kv, kv)
+	}
+}
+
+func dispatchAdd(handlers []Handler, kv KeyValue) {
+	for _, h := range handlers {
+		if h.OnAdd != nil {
+			h.OnAdd(kv)
+		}
+	}
+}
+
+func dispatchUpdate(handlers []Handler, old, kv KeyValue) {
+	for _, h := range handlers {
+		if h.OnUpdate != nil {
+			h.OnUpdate(old, kv)
+		}
+	}
+}
+
+func dispatchDelete(handlers []Handler, kv KeyValue) {
+	for _, h := range handlers {
+		if h.OnDelete != nil {
+			h.OnDelete(kv)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"code/platform/v5/lock"
+)
+
+// LockKV 把 Store 适配为 lock.KV，使 lock.LeaseTable 可以直接跑在同一个存储上
+func LockKV(s Store) lock.KV {
+	return lockKV{s: s}
+}
+
+type lockKV struct {
+	s Store
+}
+
+func (kv lockKV) Grant(ctx context.Context, ttl time.Duration) (lock.LeaseID, error) {
+	id, err := kv.s.Grant(ctx, ttl)
+	return lock.LeaseID(id), err
+}
+
+func (kv lockKV) KeepAlive(ctx context.Context, id lock.LeaseID) error {
+	err := kv.s.KeepAlive(ctx, LeaseID(id))
+	if errors.Is(err, ErrLeaseNotFound) {
+		return lock.ErrLeaseNotFound
+	}
+	return err
+}
+
+func (kv lockKV) Revoke(ctx context.Context, id lock.LeaseID) error {
+	return kv.s.Revoke(ctx, LeaseID(id))
+}
+
+func (kv lockKV) PutIfAbsent(ctx context.Context, key, value string, id lock.LeaseID) (bool, error) {
+	_, err := kv.s.CompareAndSwap(ctx, key, []byte(value), 0, LeaseID(id))
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, ErrConflict):
+		return false, nil
+	case errors.Is(err, ErrLeaseNotFound):
+		return false, lock.ErrLeaseNotFound
+	}
+	return false, err
+}
+
+func (kv lockKV) DeleteIfValue(ctx context.Context, key, value string) (bool, error) {
+	cur, err := kv.s.Get(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if string(cur.Value) != value {
+		return false, nil
+	}
+	err = kv.s.CompareAndDelete(ctx, key, cur.ModRevision)
+	if errors.Is(err, ErrConflict) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// WaitDelete 从读取时的存储 revision 开始 Watch，而不是 key 的 ModRevision：
+// key 长期未修改时它的 ModRevision 可能早已被压缩，Watch 会立即关闭导致空转
+func (kv lockKV) WaitDelete(ctx context.Context, key string) error {
+	for {
+		// List 才带有读取时的 revision，前缀匹配后只看 key 本身
+		kvs, rev, err := kv.s.List(ctx, key)
+		if err != nil {
+			return err
+		}
+		if !contains(kvs, key) {
+			return nil
+		}
+
+		wctx, cancel := context.WithCancel(ctx)
+		deleted := false
+		// Watch 按前缀匹配，需要过滤掉同前缀的其他 key
+		for ev := range kv.s.Watch(wctx, key, rev) {
+			if ev.KV.Key == key && ev.Type == EventDelete {
+				deleted = true
+				break
+			}
+		}
+		cancel()
+		if deleted {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// 通道因消费过慢或存储出错被关闭，重新读取后再等待
+	}
+}
+
+func contains(kvs []KeyValue, key string) bool {
+	for _, kv := range kvs {
+		if kv.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"code/platform/v5/lock"
+)
+
+// countingStore 记录 Watch 调用次数，用于发现空转
+type countingStore struct {
+	Store
+	watches atomic.Int64
+}
+
+func (s *countingStore) Watch(ctx context.Context, prefix string, rev int64) <-chan Event {
+	s.watches.Add(1)
+	return s.Store.Watch(ctx, prefix, rev)
+}
+
+func TestLockKVPutAndDelete(t *testing.T) {
+	s := NewMemoryStore()
+	kv := LockKV(s)
+	ctx := context.Background()
+
+	lease, err := kv.Grant(ctx, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := kv.PutIfAbsent(ctx, "/lock/a", "t1", lease); !ok || err != nil {
+		t.Fatalf("first put = %v, %v, want true", ok, err)
+	}
+	if ok, err := kv.PutIfAbsent(ctx, "/lock/a", "t2", lease); ok || err != nil {
+		t.Fatalf("second put = %v, %v, want false", ok, err)
+	}
+	if _, err := kv.PutIfAbsent(ctx, "/lock/b", "t1", 99); !errors.Is(err, lock.ErrLeaseNotFound) {
+		t.Fatalf("put with unknown lease: err = %v, want lock.ErrLeaseNotFound", err)
+	}
+	if ok, _ := kv.DeleteIfValue(ctx, "/lock/a", "t2"); ok {
+		t.Fatal("deleted with wrong value")
+	}
+	if ok, err := kv.DeleteIfValue(ctx, "/lock/a", "t1"); !ok || err != nil {
+		t.Fatalf("delete = %v, %v, want true", ok, err)
+	}
+	if ok, err := kv.DeleteIfValue(ctx, "/lock/a", "t1"); ok || err != nil {
+		t.Fatalf("delete missing = %v, %v, want false", ok, err)
+	}
+
+	if err := kv.Revoke(ctx, lease); err != nil {
+		t.Fatal(err)
+	}
+	if err := kv.KeepAlive(ctx, lease); !errors.Is(err, lock.ErrLeaseNotFound) {
+		t.Fatalf("keepalive revoked lease: err = %v, want lock.ErrLeaseNotFound", err)
+	}
+}
+
+func TestLockKVWaitDelete(t *testing.T) {
+	s := NewMemoryStore()
+	kv := LockKV(s)
+	ctx := context.Background()
+
+	if err := kv.WaitDelete(ctx, "/lock/a"); err != nil {
+		t.Fatalf("wait on missing key: %v", err)
+	}
+
+	s.Put(ctx, "/lock/a", []byte("t1"), NoLease)
+	done := make(chan error, 1)
+	go func() { done <- kv.WaitDelete(ctx, "/lock/a") }()
+
+	// 同前缀的其他 key 不会唤醒等待者
+	s.Put(ctx, "/lock/ab", nil, NoLease)
+	s.Delete(ctx, "/lock/ab")
+	select {
+	case err := <-done:
+		t.Fatalf("woke up before delete: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.Delete(ctx, "/lock/a")
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter not woken by delete")
+	}
+
+	s.Put(ctx, "/lock/a", []byte("t2"), NoLease)
+	cctx, cancel := context.WithCancel(ctx)
+	go func() { done <- kv.WaitDelete(cctx, "/lock/a") }()
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled wait: err = %v, want context.Canceled", err)
+	}
+}
+
+func TestLockKVWaitDeleteAfterCompaction(t *testing.T) {
+	s := &countingStore{Store: NewMemoryStore()}
+	kv := LockKV(s)
+	ctx := context.Background()
+
+	s.Put(ctx, "/lock/a", []byte("t1"), NoLease)
+	// 让 /lock/a 的 ModRevision 落到历史范围之外
+	for i := 0; i < historySize+1; i++ {
+		s.Put(ctx, fmt.Sprintf("/other/%d", i), nil, NoLease)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- kv.WaitDelete(ctx, "/lock/a") }()
+	time.Sleep(50 * time.Millisecond)
+	s.Delete(ctx, "/lock/a")
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter not woken by delete")
+	}
+	if n := s.watches.Load(); n != 1 {
+		t.Fatalf("watch called %d times, want 1", n)
+	}
+}
+
+func TestLeaseTableOverStore(t *testing.T) {
+	s := NewMemoryStore()
+	t1, err := lock.NewLeaseTable(LockKV(s), "/locks/", "m1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer t1.Close()
+	t2, err := lock.NewLeaseTable(LockKV(s), "/locks/", "m2", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer t2.Close()
+
+	var (
+		wg      sync.WaitGroup
+		holders atomic.Int32
+	)
+	for _, table := range []*lock.LeaseTable{t1, t2, t1, t2} {
+		wg.Add(1)
+		go func(table *lock.LeaseTable) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				table.LockRowForWrite("row")
+				if n := holders.Add(1); n != 1 {
+					t.Errorf("%d holders of the same row", n)
+				}
+				holders.Add(-1)
+				table.UnlockRowForWrite("row")
+			}
+		}(table)
+	}
+	wg.Wait()
+	if _, err := s.Get(context.Background(), "/locks/row"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("row key left behind: err = %v", err)
+	}
+}
@@ -0,0 +1,298 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code/platform/internal/clock"
+)
+
+const (
+	// 保留的历史事件数量，Watch 的 rev 早于此范围时视为已压缩
+	historySize = 1024
+	watchBuffer = 256
+)
+
+type memoryLease struct {
+	ttl      time.Duration
+	deadline time.Time
+	keys     map[string]struct{}
+	timer    *time.Timer
+}
+
+type memoryWatcher struct {
+	prefix string
+	ch     chan Event
+}
+
+// MemoryStore 进程内实现，用于单机部署和测试
+type MemoryStore struct {
+	mu        sync.Mutex
+	clock     clock.Clock
+	rev       int64
+	keys      map[string]KeyValue
+	leases    map[LeaseID]*memoryLease
+	nextLease LeaseID
+	history   []Event
+	watchers  map[*memoryWatcher]struct{}
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		clock: clock.Real{},
+		// 与 etcd 一致从 1 开始，List 返回的 revision 总能用于 Watch
+		rev:      1,
+		keys:     make(map[string]KeyValue),
+		leases:   make(map[LeaseID]*memoryLease),
+		watchers: make(map[*memoryWatcher]struct{}),
+	}
+}
+
+// SetClock 替换租约使用的时间来源；使用 clock.Fake 时由调用方推进时间后调用 ExpireLeases
+func (s *MemoryStore) SetClock(c clock.Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = c
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (KeyValue, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kv, ok := s.keys[key]
+	if !ok {
+		return KeyValue{}, ErrNotFound
+	}
+	return copyKV(kv), nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, prefix string) ([]KeyValue, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var kvs []KeyValue
+	for key, kv := range s.keys {
+		if strings.HasPrefix(key, prefix) {
+			kvs = append(kvs, copyKV(kv))
+		}
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	return kvs, s.rev, nil
+}
+
+func (s *MemoryStore) Put(ctx context.Context, key string, value []byte, lease LeaseID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.putLocked(key, value, lease)
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteLocked(key)
+	return nil
+}
+
+func (s *MemoryStore) CompareAndSwap(ctx context.Context, key string, value []byte, rev int64, lease LeaseID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.modRevisionLocked(key) != rev {
+		return 0, ErrConflict
+	}
+	return s.putLocked(key, value, lease)
+}
+
+func (s *MemoryStore) CompareAndDelete(ctx context.Context, key string, rev int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.modRevisionLocked(key) != rev {
+		return ErrConflict
+	}
+	s.deleteLocked(key)
+	return nil
+}
+
+func (s *MemoryStore) Watch(ctx context.Context, prefix string, rev int64) <-chan Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var replay []Event
+	if rev > 0 {
+		if len(s.history) > 0 && rev < s.history[0].KV.ModRevision-1 {
+			// 需要的历史已经被丢弃
+			ch := make(chan Event)
+			close(ch)
+			return ch
+		}
+		for _, ev := range s.history {
+			if ev.KV.ModRevision > rev && strings.HasPrefix(ev.KV.Key, prefix) {
+				replay = append(replay, ev)
+			}
+		}
+	}
+	w := &memoryWatcher{prefix: prefix, ch: make(chan Event, watchBuffer+len(replay))}
+	for _, ev := range replay {
+		w.ch <- copyEvent(ev)
+	}
+	s.watchers[w] = struct{}{}
+
+	if ctx.Done() == nil {
+		return w.ch
+	}
+	go func() {
+		<-ctx.Done()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.watchers[w]; ok {
+			delete(s.watchers, w)
+			close(w.ch)
+		}
+	}()
+	return w.ch
+}
+
+func (s *MemoryStore) Grant(ctx context.Context, ttl time.Duration) (LeaseID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextLease++
+	id := s.nextLease
+	l := &memoryLease{ttl: ttl, keys: make(map[string]struct{})}
+	s.leases[id] = l
+	s.renewLocked(id, l)
+	return id, nil
+}
+
+func (s *MemoryStore) KeepAlive(ctx context.Context, id LeaseID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.leases[id]
+	if !ok {
+		return ErrLeaseNotFound
+	}
+	s.renewLocked(id, l)
+	return nil
+}
+
+func (s *MemoryStore) Revoke(ctx context.Context, id LeaseID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revokeLocked(id)
+	return nil
+}
+
+// ExpireLeases 删除所有已到期的租约及其绑定的 key
+func (s *MemoryStore) ExpireLeases() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock.Now()
+	for id, l := range s.leases {
+		if !now.Before(l.deadline) {
+			s.revokeLocked(id)
+		}
+	}
+}
+
+func (s *MemoryStore) renewLocked(id LeaseID, l *memoryLease) {
+	l.deadline = s.clock.Now().Add(l.ttl)
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+	l.timer = time.AfterFunc(l.ttl, s.ExpireLeases)
+}
+
+func (s *MemoryStore) revokeLocked(id LeaseID) {
+	l, ok := s.leases[id]
+	if !ok {
+		return
+	}
+	l.timer.Stop()
+	delete(s.leases, id)
+	keys := make([]string, 0, len(l.keys))
+	for key := range l.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s.deleteLocked(key)
+	}
+}
+
+func (s *MemoryStore) modRevisionLocked(key string) int64 {
+	return s.keys[key].ModRevision
+}
+
+func (s *MemoryStore) putLocked(key string, value []byte, lease LeaseID) (int64, error) {
+	var l *memoryLease
+	if lease != NoLease {
+		var ok bool
+		if l, ok = s.leases[lease]; !ok {
+			return 0, ErrLeaseNotFound
+		}
+	}
+	prev, existed := s.keys[key]
+	if existed && prev.Lease != NoLease {
+		if pl, ok := s.leases[prev.Lease]; ok {
+			delete(pl.keys, key)
+		}
+	}
+	s.rev++
+	kv := KeyValue{
+		Key:            key,
+		Value:          append([]byte(nil), value...),
+		CreateRevision: s.rev,
+		ModRevision:    s.rev,
+		Lease:          lease,
+	}
+	if existed {
+		kv.CreateRevision = prev.CreateRevision
+	}
+	s.keys[key] = kv
+	if l != nil {
+		l.keys[key] = struct{}{}
+	}
+	s.notifyLocked(Event{Type: EventPut, KV: kv})
+	return s.rev, nil
+}
+
+func (s *MemoryStore) deleteLocked(key string) {
+	prev, ok := s.keys[key]
+	if !ok {
+		return
+	}
+	if l, ok := s.leases[prev.Lease]; ok {
+		delete(l.keys, key)
+	}
+	delete(s.keys, key)
+	s.rev++
+	s.notifyLocked(Event{Type: EventDelete, KV: KeyValue{Key: key, ModRevision: s.rev}})
+}
+
+func (s *MemoryStore) notifyLocked(ev Event) {
+	s.history = append(s.history, ev)
+	if len(s.history) > historySize {
+		s.history = s.history[len(s.history)-historySize:]
+	}
+	for w := range s.watchers {
+		if !strings.HasPrefix(ev.KV.Key, w.prefix) {
+			continue
+		}
+		select {
+		case w.ch <- copyEvent(ev):
+		default:
+			// 消费过慢，关闭通道让调用方重新 List
+			delete(s.watchers, w)
+			close(w.ch)
+		}
+	}
+}
+
+func copyKV(kv KeyValue) KeyValue {
+	kv.Value = append([]byte(nil), kv.Value...)
+	return kv
+}
+
+func copyEvent(ev Event) Event {
+	ev.KV = copyKV(ev.KV)
+	return ev
+}
@@ -0,0 +1,182 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"code/platform/internal/clock"
+)
+
+func TestMemoryStoreReadWrite(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+
+	if _, err := s.Get(ctx, "/a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get missing: err = %v, want ErrNotFound", err)
+	}
+	rev, err := s.Put(ctx, "/a", []byte("1"), NoLease)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev != 2 {
+		t.Fatalf("first put revision = %d, want 2", rev)
+	}
+	rev2, _ := s.Put(ctx, "/a", []byte("2"), NoLease)
+	kv, err := s.Get(ctx, "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(kv.Value) != "2" || kv.CreateRevision != rev || kv.ModRevision != rev2 {
+		t.Fatalf("kv = %+v, want value 2 created at %d modified at %d", kv, rev, rev2)
+	}
+
+	s.Put(ctx, "/b", []byte("3"), NoLease)
+	s.Put(ctx, "/other", []byte("4"), NoLease)
+	kvs, listRev, err := s.List(ctx, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvs) != 3 || kvs[0].Key != "/a" || kvs[1].Key != "/b" || kvs[2].Key != "/other" {
+		t.Fatalf("list = %+v, want sorted /a /b /other", kvs)
+	}
+	if listRev != s.rev {
+		t.Fatalf("list revision = %d, want %d", listRev, s.rev)
+	}
+}
+
+func TestMemoryStoreCompare(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+
+	rev, err := s.CompareAndSwap(ctx, "/a", []byte("1"), 0, NoLease)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := s.CompareAndSwap(ctx, "/a", []byte("2"), 0, NoLease); !errors.Is(err, ErrConflict) {
+		t.Fatalf("create existing: err = %v, want ErrConflict", err)
+	}
+	if _, err := s.CompareAndSwap(ctx, "/a", []byte("2"), rev+1, NoLease); !errors.Is(err, ErrConflict) {
+		t.Fatalf("stale swap: err = %v, want ErrConflict", err)
+	}
+	rev, err = s.CompareAndSwap(ctx, "/a", []byte("2"), rev, NoLease)
+	if err != nil {
+		t.Fatalf("swap: %v", err)
+	}
+	if err := s.CompareAndDelete(ctx, "/a", rev-1); !errors.Is(err, ErrConflict) {
+		t.Fatalf("stale delete: err = %v, want ErrConflict", err)
+	}
+	if err := s.CompareAndDelete(ctx, "/a", rev); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := s.Get(ctx, "/a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("after delete: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryStoreWatch(t *testing.T) {
+	s := NewMemoryStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s.Put(ctx, "/a/1", []byte("1"), NoLease)
+	_, rev, _ := s.List(ctx, "/a/")
+	s.Put(ctx, "/a/2", []byte("2"), NoLease)
+	s.Put(ctx, "/b/1", []byte("3"), NoLease)
+
+	ch := s.Watch(ctx, "/a/", rev)
+	s.Delete(ctx, "/a/1")
+
+	want := []struct {
+		typ EventType
+		key string
+	}{{EventPut, "/a/2"}, {EventDelete, "/a/1"}}
+	for _, w := range want {
+		select {
+		case ev := <-ch:
+			if ev.Type != w.typ || ev.KV.Key != w.key {
+				t.Fatalf("event = %v %s, want %v %s", ev.Type, ev.KV.Key, w.typ, w.key)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %s", w.key)
+		}
+	}
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestMemoryStoreWatchCompacted(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+	rev, _ := s.Put(ctx, "/a", []byte("1"), NoLease)
+	for i := 0; i < historySize+1; i++ {
+		s.Put(ctx, fmt.Sprintf("/b/%d", i), nil, NoLease)
+	}
+	if _, ok := <-s.Watch(ctx, "/a", rev); ok {
+		t.Fatal("watch from compacted revision delivered an event, want closed channel")
+	}
+	_, current, _ := s.List(ctx, "/a")
+	wctx, cancel := context.WithCancel(ctx)
+	ch := s.Watch(wctx, "/a", current)
+	s.Delete(ctx, "/a")
+	if ev := <-ch; ev.Type != EventDelete {
+		t.Fatalf("event = %+v, want delete", ev)
+	}
+	cancel()
+}
+
+func TestMemoryStoreLeases(t *testing.T) {
+	s := NewMemoryStore()
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	s.SetClock(fake)
+	ctx := context.Background()
+
+	lease, err := s.Grant(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Put(ctx, "/a", nil, lease); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Put(ctx, "/b", nil, 99); !errors.Is(err, ErrLeaseNotFound) {
+		t.Fatalf("put with unknown lease: err = %v, want ErrLeaseNotFound", err)
+	}
+
+	fake.Advance(9 * time.Second)
+	if err := s.KeepAlive(ctx, lease); err != nil {
+		t.Fatal(err)
+	}
+	fake.Advance(9 * time.Second)
+	s.ExpireLeases()
+	if _, err := s.Get(ctx, "/a"); err != nil {
+		t.Fatalf("renewed key expired: %v", err)
+	}
+
+	fake.Advance(time.Second)
+	s.ExpireLeases()
+	if _, err := s.Get(ctx, "/a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("after expiry: err = %v, want ErrNotFound", err)
+	}
+	if err := s.KeepAlive(ctx, lease); !errors.Is(err, ErrLeaseNotFound) {
+		t.Fatalf("keepalive expired lease: err = %v, want ErrLeaseNotFound", err)
+	}
+
+	lease, _ = s.Grant(ctx, 10*time.Second)
+	s.Put(ctx, "/c", nil, lease)
+	// 改为不绑定租约后，撤销租约不再删除该 key
+	s.Put(ctx, "/d", nil, lease)
+	s.Put(ctx, "/d", nil, NoLease)
+	if err := s.Revoke(ctx, lease); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "/c"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("after revoke: err = %v, want ErrNotFound", err)
+	}
+	if _, err := s.Get(ctx, "/d"); err != nil {
+		t.Fatalf("detached key removed by revoke: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("store: key not found")
+	// CompareAndSwap/CompareAndDelete 时 key 的 revision 与期望不一致
+	ErrConflict      = errors.New("store: revision conflict")
+	ErrLeaseNotFound = errors.New("store: lease not found")
+)
+
+type LeaseID int64
+
+// NoLease 写入的 key 不绑定租约
+const NoLease LeaseID = 0
+
+type KeyValue struct {
+	Key   string
+	Value []byte
+	// 创建和最近一次修改时的存储 revision
+	CreateRevision int64
+	ModRevision    int64
+	Lease          LeaseID
+}
+
+type EventType int
+
+const (
+	EventPut EventType = iota
+	EventDelete
+)
+
+// Event 变更事件，删除事件的 KV 只有 Key 和删除时的 ModRevision
+type Event struct {
+	Type EventType
+	KV   KeyValue
+}
+
+// Store manager 依赖的存储能力，单机用 MemoryStore，多副本用 etcd
+type Store interface {
+	Get(ctx context.Context, key string) (KeyValue, error)
+	// List prefix 下的所有 key，按 key 排序，同时返回读取时的存储 revision，用于之后 Watch
+	List(ctx context.Context, prefix string) ([]KeyValue, int64, error)
+	// Put 直接写入，返回写入后的 revision
+	Put(ctx context.Context, key string, value []byte, lease LeaseID) (int64, error)
+	Delete(ctx context.Context, key string) error
+	// CompareAndSwap key 的 ModRevision 等于 rev 时写入，rev 为 0 表示 key 必须不存在；不满足时返回 ErrConflict
+	CompareAndSwap(ctx context.Context, key string, value []byte, rev int64, lease LeaseID) (int64, error)
+	// CompareAndDelete key 的 ModRevision 等于 rev 时删除，不满足时返回 ErrConflict
+	CompareAndDelete(ctx context.Context, key string, rev int64) error
+	// Watch 返回 prefix 下 revision 大于 rev 的变更，rev 为 0 表示从现在开始。
+	// ctx 结束、出错或 rev 已被压缩时关闭通道，调用方需要重新 List 后再 Watch
+	Watch(ctx context.Context, prefix string, rev int64) <-chan Event
+	// Grant 申请租约，租约到期或被撤销时绑定的 key 一并删除
+	Grant(ctx context.Context, ttl time.Duration) (LeaseID, error)
+	KeepAlive(ctx context.Context, id LeaseID) error
+	Revoke(ctx context.Context, id LeaseID) error
+}
@@ -0,0 +1,97 @@
+package etcdkv
+
+import (
+	"context"
+	"time"
+
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/etcdserver/api/v3rpc/rpctypes"
+
+	"code/platform/v5/lock"
+)
+
+// KV 基于 etcd 的 lock.KV 实现
+type KV struct {
+	client *clientv3.Client
+}
+
+func New(client *clientv3.Client) *KV {
+	return &KV{client: client}
+}
+
+func (kv *KV) Grant(ctx context.Context, ttl time.Duration) (lock.LeaseID, error) {
+	seconds := int64(ttl / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	resp, err := kv.client.Grant(ctx, seconds)
+	if err != nil {
+		return 0, err
+	}
+	return lock.LeaseID(resp.ID), nil
+}
+
+func (kv *KV) KeepAlive(ctx context.Context, id lock.LeaseID) error {
+	_, err := kv.client.KeepAliveOnce(ctx, clientv3.LeaseID(id))
+	if err == rpctypes.ErrLeaseNotFound {
+		return lock.ErrLeaseNotFound
+	}
+	return err
+}
+
+func (kv *KV) Revoke(ctx context.Context, id lock.LeaseID) error {
+	_, err := kv.client.Revoke(ctx, clientv3.LeaseID(id))
+	if err == rpctypes.ErrLeaseNotFound {
+		return nil
+	}
+	return err
+}
+
+func (kv *KV) PutIfAbsent(ctx context.Context, key, value string, id lock.LeaseID) (bool, error) {
+	resp, err := kv.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, value, clientv3.WithLease(clientv3.LeaseID(id)))).
+		Commit()
+	if err == rpctypes.ErrLeaseNotFound {
+		return false, lock.ErrLeaseNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
+func (kv *KV) DeleteIfValue(ctx context.Context, key, value string) (bool, error) {
+	resp, err := kv.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.Value(key), "=", value)).
+		Then(clientv3.OpDelete(key)).
+		Commit()
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
+func (kv *KV) WaitDelete(ctx context.Context, key string) error {
+	resp, err := kv.client.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	wch := kv.client.Watch(ctx, key, clientv3.WithRev(resp.Header.Revision+1))
+	for wr := range wch {
+		if err := wr.Err(); err != nil {
+			return err
+		}
+		for _, ev := range wr.Events {
+			if ev.Type == clientv3.EventTypeDelete {
+				return nil
+			}
+		}
+	}
+	return ctx.Err()
+}
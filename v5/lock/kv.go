@@ -0,0 +1,160 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+type LeaseID int64
+
+var ErrLeaseNotFound = errors.New("lock: lease not found")
+
+// KV 分布式锁依赖的最小存储能力，etcd 等带租约的 KV 均可实现
+type KV interface {
+	// Grant 申请一个 ttl 的租约
+	Grant(ctx context.Context, ttl time.Duration) (LeaseID, error)
+	// KeepAlive 续约一次，租约已过期返回 ErrLeaseNotFound
+	KeepAlive(ctx context.Context, id LeaseID) error
+	// Revoke 撤销租约，并删除绑定在该租约上的 key
+	Revoke(ctx context.Context, id LeaseID) error
+	// PutIfAbsent key 不存在时写入并绑定租约，返回是否写入成功
+	PutIfAbsent(ctx context.Context, key, value string, id LeaseID) (bool, error)
+	// DeleteIfValue key 的值等于 value 时删除，返回是否删除
+	DeleteIfValue(ctx context.Context, key, value string) (bool, error)
+	// WaitDelete 阻塞直到 key 不存在
+	WaitDelete(ctx context.Context, key string) error
+}
+
+type memoryEntry struct {
+	value string
+	lease LeaseID
+}
+
+type memoryLease struct {
+	ttl      time.Duration
+	expireAt time.Time
+}
+
+// MemoryKV 进程内 KV，用于单机部署和测试
+type MemoryKV struct {
+	mu        sync.Mutex
+	nextLease LeaseID
+	leases    map[LeaseID]*memoryLease
+	keys      map[string]memoryEntry
+	waiters   map[string][]chan struct{}
+}
+
+func NewMemoryKV() *MemoryKV {
+	return &MemoryKV{
+		leases:  make(map[LeaseID]*memoryLease),
+		keys:    make(map[string]memoryEntry),
+		waiters: make(map[string][]chan struct{}),
+	}
+}
+
+func (kv *MemoryKV) Grant(ctx context.Context, ttl time.Duration) (LeaseID, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	kv.nextLease++
+	kv.leases[kv.nextLease] = &memoryLease{ttl: ttl, expireAt: time.Now().Add(ttl)}
+	return kv.nextLease, nil
+}
+
+func (kv *MemoryKV) KeepAlive(ctx context.Context, id LeaseID) error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	kv.expireLocked()
+	l, ok := kv.leases[id]
+	if !ok {
+		return ErrLeaseNotFound
+	}
+	l.expireAt = time.Now().Add(l.ttl)
+	return nil
+}
+
+func (kv *MemoryKV) Revoke(ctx context.Context, id LeaseID) error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	kv.revokeLocked(id)
+	return nil
+}
+
+func (kv *MemoryKV) PutIfAbsent(ctx context.Context, key, value string, id LeaseID) (bool, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	kv.expireLocked()
+	if _, ok := kv.leases[id]; !ok {
+		return false, ErrLeaseNotFound
+	}
+	if _, ok := kv.keys[key]; ok {
+		return false, nil
+	}
+	kv.keys[key] = memoryEntry{value: value, lease: id}
+	return true, nil
+}
+
+func (kv *MemoryKV) DeleteIfValue(ctx context.Context, key, value string) (bool, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	kv.expireLocked()
+	e, ok := kv.keys[key]
+	if !ok || e.value != value {
+		return false, nil
+	}
+	kv.deleteLocked(key)
+	return true, nil
+}
+
+func (kv *MemoryKV) WaitDelete(ctx context.Context, key string) error {
+	for {
+		kv.mu.Lock()
+		kv.expireLocked()
+		e, ok := kv.keys[key]
+		if !ok {
+			kv.mu.Unlock()
+			return nil
+		}
+		ch := make(chan struct{})
+		kv.waiters[key] = append(kv.waiters[key], ch)
+		// key 没有被主动删除时，也需要在租约到期后醒来
+		timer := time.NewTimer(time.Until(kv.leases[e.lease].expireAt))
+		kv.mu.Unlock()
+
+		select {
+		case <-ch:
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		timer.Stop()
+	}
+}
+
+func (kv *MemoryKV) expireLocked() {
+	now := time.Now()
+	for id, l := range kv.leases {
+		if !now.Before(l.expireAt) {
+			kv.revokeLocked(id)
+		}
+	}
+}
+
+func (kv *MemoryKV) revokeLocked(id LeaseID) {
+	delete(kv.leases, id)
+	for key, e := range kv.keys {
+		if e.lease == id {
+			kv.deleteLocked(key)
+		}
+	}
+}
+
+func (kv *MemoryKV) deleteLocked(key string) {
+	delete(kv.keys, key)
+	for _, ch := range kv.waiters[key] {
+		close(ch)
+	}
+	delete(kv.waiters, key)
+}
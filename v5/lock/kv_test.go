@@ -0,0 +1,79 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryKVPutIfAbsent(t *testing.T) {
+	ctx := context.Background()
+	kv := NewMemoryKV()
+	lease, _ := kv.Grant(ctx, time.Minute)
+
+	if ok, err := kv.PutIfAbsent(ctx, "k", "a", lease); !ok || err != nil {
+		t.Fatalf("first put = %v, %v", ok, err)
+	}
+	if ok, err := kv.PutIfAbsent(ctx, "k", "b", lease); ok || err != nil {
+		t.Fatalf("second put = %v, %v, want false", ok, err)
+	}
+	if _, err := kv.PutIfAbsent(ctx, "other", "a", lease+1); !errors.Is(err, ErrLeaseNotFound) {
+		t.Fatalf("put with unknown lease: %v", err)
+	}
+	if ok, _ := kv.DeleteIfValue(ctx, "k", "b"); ok {
+		t.Fatal("delete with wrong value succeeded")
+	}
+	if ok, _ := kv.DeleteIfValue(ctx, "k", "a"); !ok {
+		t.Fatal("delete with matching value failed")
+	}
+}
+
+func TestMemoryKVRevokeDeletesKeys(t *testing.T) {
+	ctx := context.Background()
+	kv := NewMemoryKV()
+	lease, _ := kv.Grant(ctx, time.Minute)
+	kv.PutIfAbsent(ctx, "k", "a", lease)
+
+	done := make(chan error, 1)
+	go func() { done <- kv.WaitDelete(ctx, "k") }()
+	kv.Revoke(ctx, lease)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WaitDelete did not return after revoke")
+	}
+	if err := kv.KeepAlive(ctx, lease); !errors.Is(err, ErrLeaseNotFound) {
+		t.Fatalf("keepalive after revoke: %v", err)
+	}
+}
+
+func TestMemoryKVWaitDeleteWakesOnExpiry(t *testing.T) {
+	ctx := context.Background()
+	kv := NewMemoryKV()
+	lease, _ := kv.Grant(ctx, 20*time.Millisecond)
+	kv.PutIfAbsent(ctx, "k", "a", lease)
+
+	start := time.Now()
+	if err := kv.WaitDelete(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("WaitDelete waited far past lease expiry")
+	}
+}
+
+func TestMemoryKVWaitDeleteContext(t *testing.T) {
+	kv := NewMemoryKV()
+	lease, _ := kv.Grant(context.Background(), time.Minute)
+	kv.PutIfAbsent(context.Background(), "k", "a", lease)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := kv.WaitDelete(ctx, "k"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitDelete = %v, want deadline exceeded", err)
+	}
+}
@@ -0,0 +1,344 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrClosed = errors.New("lock: lease table closed")
+	// ErrLockLost 会话租约丢失，持有的行锁已不再互斥
+	ErrLockLost = errors.New("lock: session lease lost")
+)
+
+// session 一个会话租约，租约丢失时 cancel，持有者通过 ctx 感知
+type session struct {
+	lease  LeaseID
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+}
+
+func newSession(lease LeaseID) *session {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	return &session{lease: lease, ctx: ctx, cancel: cancel}
+}
+
+type leaseRow struct {
+	mu    sync.Mutex
+	refs  int
+	token string
+	sess  *session
+	// users 正在加锁、持有或释放该行的调用数，归零后从 rows 中删除
+	users int
+}
+
+// LeaseTable 基于租约的分布式行锁，多个 manager 副本共享同一个 KV 时互斥。
+// 同一进程内的读写语义由本地 Table 保证，进程间只区分持有/未持有：
+// 本进程第一个读者或写者抢占 KV 中的行 key，最后一个释放者删除它。
+// 所有行 key 绑定在同一个会话租约上，进程退出后租约到期，锁自动释放。
+// 租约丢失时其他副本可以抢到同一行，持有者需要通过 *Context 方法返回的 ctx 感知并放弃操作。
+type LeaseTable struct {
+	kv     KV
+	prefix string
+	holder string
+	ttl    time.Duration
+	local  *Table
+
+	mu     sync.Mutex
+	sess   *session
+	rows   map[string]*leaseRow
+	closed bool
+
+	seq    atomic.Uint64
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewLeaseTable(kv KV, prefix string, holder string, ttl time.Duration) (*LeaseTable, error) {
+	lease, err := kv.Grant(context.Background(), ttl)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &LeaseTable{
+		kv:     kv,
+		prefix: prefix,
+		holder: holder,
+		ttl:    ttl,
+		local:  NewTable(),
+		sess:   newSession(lease),
+		rows:   make(map[string]*leaseRow),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go t.keepAlive(ctx)
+	return t, nil
+}
+
+// Close 停止续约并撤销会话租约，仍被持有的行锁随之释放
+func (t *LeaseTable) Close() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	sess := t.sess
+	t.mu.Unlock()
+
+	t.cancel()
+	<-t.done
+	sess.cancel(ErrClosed)
+	return t.kv.Revoke(context.Background(), sess.lease)
+}
+
+func (t *LeaseTable) LockRowForRead(rowID string) {
+	t.mustLock(func() error {
+		_, err := t.LockRowForReadContext(context.Background(), rowID)
+		return err
+	})
+}
+
+func (t *LeaseTable) UnlockRowForRead(rowID string) {
+	r := t.lookup(rowID)
+	r.mu.Lock()
+	r.refs--
+	if r.refs == 0 {
+		t.release(rowID, r)
+	}
+	r.mu.Unlock()
+	t.unref(rowID, r)
+	t.local.UnlockRowForRead(rowID)
+}
+
+func (t *LeaseTable) LockRowForWrite(rowID string) {
+	t.mustLock(func() error {
+		_, err := t.LockRowForWriteContext(context.Background(), rowID)
+		return err
+	})
+}
+
+func (t *LeaseTable) UnlockRowForWrite(rowID string) {
+	r := t.lookup(rowID)
+	r.mu.Lock()
+	t.release(rowID, r)
+	r.refs = 0
+	r.mu.Unlock()
+	t.unref(rowID, r)
+	t.local.UnlockRowForWrite(rowID)
+}
+
+// LockRowForReadContext 与 LockRowForRead 相同，但 KV 出错或 ctx 结束时返回错误。
+// 返回的 held 在会话租约丢失时以 ErrLockLost 结束，此后不再保证与其他副本互斥
+func (t *LeaseTable) LockRowForReadContext(ctx context.Context, rowID string) (held context.Context, err error) {
+	t.local.LockRowForRead(rowID)
+	r := t.ref(rowID)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.refs == 0 {
+		token, sess, err := t.acquire(ctx, rowID)
+		if err != nil {
+			t.unref(rowID, r)
+			t.local.UnlockRowForRead(rowID)
+			return nil, err
+		}
+		r.token, r.sess = token, sess
+	}
+	r.refs++
+	return r.sess.ctx, nil
+}
+
+// LockRowForWriteContext 与 LockRowForWrite 相同，但 KV 出错或 ctx 结束时返回错误。
+// 返回的 held 在会话租约丢失时以 ErrLockLost 结束，此后不再保证与其他副本互斥
+func (t *LeaseTable) LockRowForWriteContext(ctx context.Context, rowID string) (held context.Context, err error) {
+	t.local.LockRowForWrite(rowID)
+	r := t.ref(rowID)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token, sess, err := t.acquire(ctx, rowID)
+	if err != nil {
+		t.unref(rowID, r)
+		t.local.UnlockRowForWrite(rowID)
+		return nil, err
+	}
+	r.token, r.sess = token, sess
+	r.refs = 1
+	return sess.ctx, nil
+}
+
+// ref 取得行并登记一个使用者，与 unref 成对调用
+func (t *LeaseTable) ref(rowID string) *leaseRow {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.rows[rowID]
+	if !ok {
+		r = &leaseRow{}
+		t.rows[rowID] = r
+	}
+	r.users++
+	return r
+}
+
+func (t *LeaseTable) unref(rowID string, r *leaseRow) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r.users--
+	if r.users == 0 && t.rows[rowID] == r {
+		delete(t.rows, rowID)
+	}
+}
+
+// lookup 解锁时取得加锁时登记的行，未加锁就解锁属于调用方错误
+func (t *LeaseTable) lookup(rowID string) *leaseRow {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.rows[rowID]
+	if !ok {
+		panic("lock: unlock of unlocked row " + rowID)
+	}
+	return r
+}
+
+// rowCount 当前登记的行数
+func (t *LeaseTable) rowCount() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.rows)
+}
+
+func (t *LeaseTable) currentSession() (*session, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, ErrClosed
+	}
+	return t.sess, nil
+}
+
+func (t *LeaseTable) acquire(ctx context.Context, rowID string) (string, *session, error) {
+	key := t.prefix + rowID
+	token := fmt.Sprintf("%s/%d", t.holder, t.seq.Add(1))
+	for {
+		sess, err := t.currentSession()
+		if err != nil {
+			return "", nil, err
+		}
+		ok, err := t.kv.PutIfAbsent(ctx, key, token, sess.lease)
+		if errors.Is(err, ErrLeaseNotFound) {
+			// 会话租约刚好到期，换上新租约后重试
+			if err := t.expire(sess); err != nil {
+				return "", nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		if ok {
+			return token, sess, nil
+		}
+		if err := t.kv.WaitDelete(ctx, key); err != nil {
+			return "", nil, err
+		}
+	}
+}
+
+// release 删除失败时后台重试，直到成功或会话租约到期
+func (t *LeaseTable) release(rowID string, r *leaseRow) {
+	key := t.prefix + rowID
+	token := r.token
+	if err := context.Cause(r.sess.ctx); errors.Is(err, ErrLockLost) {
+		log.Printf("lock: %s released after its session lease was lost", key)
+	}
+	r.token, r.sess = "", nil
+	_, err := t.kv.DeleteIfValue(context.Background(), key, token)
+	if err == nil {
+		return
+	}
+	log.Printf("lock: release %s failed: %v", key, err)
+	go func() {
+		backoff := t.ttl / 10
+		for i := 0; i < 10; i++ {
+			time.Sleep(backoff)
+			if _, err := t.kv.DeleteIfValue(context.Background(), key, token); err == nil {
+				return
+			}
+		}
+	}()
+}
+
+// mustLock 接口形式的加锁没有返回值，KV 暂时不可用时一直重试
+func (t *LeaseTable) mustLock(lock func() error) {
+	backoff := 50 * time.Millisecond
+	for {
+		err := lock()
+		if err == nil {
+			return
+		}
+		if errors.Is(err, ErrClosed) {
+			panic(err)
+		}
+		log.Printf("lock: acquire failed, retry in %s: %v", backoff, err)
+		time.Sleep(backoff)
+		if backoff < t.ttl {
+			backoff *= 2
+		}
+	}
+}
+
+// expire 结束租约已丢失的会话，并申请新租约换上新会话
+func (t *LeaseTable) expire(sess *session) error {
+	sess.cancel(ErrLockLost)
+	lease, err := t.kv.Grant(context.Background(), t.ttl)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sess != sess || t.closed {
+		// 已被其他调用替换或已关闭，撤销多申请的租约
+		go t.kv.Revoke(context.Background(), lease)
+		return nil
+	}
+	t.sess = newSession(lease)
+	return nil
+}
+
+func (t *LeaseTable) keepAlive(ctx context.Context) {
+	defer close(t.done)
+	ticker := time.NewTicker(t.ttl / 3)
+	defer ticker.Stop()
+	lastRenew := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		t.mu.Lock()
+		sess := t.sess
+		t.mu.Unlock()
+
+		err := t.kv.KeepAlive(ctx, sess.lease)
+		if err == nil {
+			lastRenew = time.Now()
+			continue
+		}
+		if !errors.Is(err, ErrLeaseNotFound) && time.Since(lastRenew) < t.ttl {
+			log.Printf("lock: keepalive lease %d failed: %v", sess.lease, err)
+			continue
+		}
+		// 租约已经丢失（或超过 ttl 未能续约，服务端视为过期），通知持有者后换新会话
+		log.Printf("lock: lease %d lost: %v", sess.lease, err)
+		if err := t.expire(sess); err != nil {
+			log.Printf("lock: grant lease failed: %v", err)
+			continue
+		}
+		lastRenew = time.Now()
+	}
+}
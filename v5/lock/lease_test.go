@@ -0,0 +1,164 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newLeaseTable(t *testing.T, kv KV, holder string, ttl time.Duration) *LeaseTable {
+	t.Helper()
+	lt, err := NewLeaseTable(kv, "/locks/", holder, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lt.Close() })
+	return lt
+}
+
+func TestLeaseTableExclusiveAcrossReplicas(t *testing.T) {
+	kv := NewMemoryKV()
+	replicas := []*LeaseTable{
+		newLeaseTable(t, kv, "a", time.Minute),
+		newLeaseTable(t, kv, "b", time.Minute),
+	}
+
+	var inside, maxInside atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		lt := replicas[i%len(replicas)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				lt.LockRowForWrite("row")
+				n := inside.Add(1)
+				if n > maxInside.Load() {
+					maxInside.Store(n)
+				}
+				time.Sleep(100 * time.Microsecond)
+				inside.Add(-1)
+				lt.UnlockRowForWrite("row")
+			}
+		}()
+	}
+	wg.Wait()
+	if got := maxInside.Load(); got != 1 {
+		t.Fatalf("max holders inside critical section = %d, want 1", got)
+	}
+}
+
+func TestLeaseTableReadersShareRow(t *testing.T) {
+	kv := NewMemoryKV()
+	a := newLeaseTable(t, kv, "a", time.Minute)
+	b := newLeaseTable(t, kv, "b", time.Minute)
+
+	a.LockRowForRead("row")
+	a.LockRowForRead("row")
+	a.UnlockRowForRead("row")
+
+	// a 仍有一个读者，b 不能拿到同一行
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := b.LockRowForWriteContext(ctx, "row"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("b lock while a reads = %v, want deadline exceeded", err)
+	}
+
+	a.UnlockRowForRead("row")
+	if _, err := b.LockRowForWriteContext(context.Background(), "row"); err != nil {
+		t.Fatal(err)
+	}
+	b.UnlockRowForWrite("row")
+}
+
+func TestLeaseTablePrunesRows(t *testing.T) {
+	lt := newLeaseTable(t, NewMemoryKV(), "a", time.Minute)
+	for _, row := range []string{"r1", "r2", "r3"} {
+		lt.LockRowForWrite(row)
+		lt.UnlockRowForWrite(row)
+		lt.LockRowForRead(row)
+		lt.UnlockRowForRead(row)
+	}
+	if n := lt.rowCount(); n != 0 {
+		t.Fatalf("rows after unlock = %d, want 0", n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	other := newLeaseTable(t, lt.kv, "b", time.Minute)
+	other.LockRowForWrite("busy")
+	if _, err := lt.LockRowForWriteContext(ctx, "busy"); err == nil {
+		t.Fatal("lock on busy row succeeded")
+	}
+	if n := lt.rowCount(); n != 0 {
+		t.Fatalf("rows after failed lock = %d, want 0", n)
+	}
+}
+
+func TestLeaseTableLostLeaseFailsHolder(t *testing.T) {
+	kv := NewMemoryKV()
+	a := newLeaseTable(t, kv, "a", 60*time.Millisecond)
+	b := newLeaseTable(t, kv, "b", time.Minute)
+
+	held, err := a.LockRowForWriteContext(context.Background(), "row")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 模拟 a 的会话租约在服务端过期
+	a.mu.Lock()
+	lease := a.sess.lease
+	a.mu.Unlock()
+	kv.Revoke(context.Background(), lease)
+
+	select {
+	case <-held.Done():
+	case <-time.After(time.Second):
+		t.Fatal("holder was not notified of the lost lease")
+	}
+	if err := context.Cause(held); !errors.Is(err, ErrLockLost) {
+		t.Fatalf("cause = %v, want ErrLockLost", err)
+	}
+
+	// 行 key 随租约删除，b 可以拿到；a 换上的新会话继续可用
+	if _, err := b.LockRowForWriteContext(context.Background(), "row"); err != nil {
+		t.Fatal(err)
+	}
+	b.UnlockRowForWrite("row")
+	a.UnlockRowForWrite("row")
+
+	held, err = a.LockRowForWriteContext(context.Background(), "row")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if held.Err() != nil {
+		t.Fatal("new session already done")
+	}
+	a.UnlockRowForWrite("row")
+}
+
+func TestLeaseTableCloseReleasesRows(t *testing.T) {
+	kv := NewMemoryKV()
+	a, err := NewLeaseTable(kv, "/locks/", "a", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newLeaseTable(t, kv, "b", time.Minute)
+
+	held, _ := a.LockRowForWriteContext(context.Background(), "row")
+	a.Close()
+	if held.Err() == nil {
+		t.Fatal("held context still live after Close")
+	}
+	if _, err := a.LockRowForWriteContext(context.Background(), "other"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("lock after close = %v, want ErrClosed", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := b.LockRowForWriteContext(ctx, "row"); err != nil {
+		t.Fatal(err)
+	}
+	b.UnlockRowForWrite("row")
+}
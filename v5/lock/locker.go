@@ -0,0 +1,14 @@
+package lock
+
+// Locker 行锁接口，Table 为进程内实现，LeaseTable 为基于租约的分布式实现
+type Locker interface {
+	LockRowForRead(rowID string)
+	UnlockRowForRead(rowID string)
+	LockRowForWrite(rowID string)
+	UnlockRowForWrite(rowID string)
+}
+
+var (
+	_ Locker = (*Table)(nil)
+	_ Locker = (*LeaseTable)(nil)
+)
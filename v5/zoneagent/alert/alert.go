@@ -1 +1,323 @@
 package alert
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code/platform/internal/clock"
+)
+
+// State 告警状态
+type State string
+
+const (
+	// 条件已满足，但持续时间还没达到 Rule.For
+	StatePending State = "pending"
+	StateFiring  State = "firing"
+	// 条件不再满足
+	StateResolved State = "resolved"
+)
+
+// Result 条件在某个对象上成立，Labels 区分对象，例如 agent_id、plugin_id
+type Result struct {
+	Labels  map[string]string
+	Value   float64
+	Message string
+}
+
+// Condition 告警条件，返回当前所有成立的对象
+type Condition interface {
+	Evaluate(now time.Time) []Result
+}
+
+type Rule struct {
+	Name      string
+	Severity  string
+	Condition Condition
+	// 条件需要持续满足的时间，0 表示立即触发
+	For time.Duration
+}
+
+type Alert struct {
+	Rule     string
+	Severity string
+	Labels   map[string]string
+	Value    float64
+	Message  string
+	State    State
+	// 被静默的告警照常流转状态，但不发送通知
+	Silenced   bool
+	ActiveAt   time.Time
+	FiredAt    time.Time
+	ResolvedAt time.Time
+	// firing 通知是否已经发出，静默期间触发的告警在静默结束后补发
+	notified bool
+}
+
+// Key 告警去重的 key：规则名 + 排序后的标签
+func (a Alert) Key() string {
+	return a.Rule + "{" + fingerprint(a.Labels) + "}"
+}
+
+type Silence struct {
+	ID string
+	// 告警标签全部匹配时被静默，key 为 alertname 时匹配规则名
+	Matchers map[string]string
+	Until    time.Time
+	Comment  string
+}
+
+func (s Silence) matches(a Alert, now time.Time) bool {
+	if !now.Before(s.Until) {
+		return false
+	}
+	for k, v := range s.Matchers {
+		if k == "alertname" {
+			if a.Rule != v {
+				return false
+			}
+			continue
+		}
+		if a.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Listener 告警状态变化时回调，同步执行，不应阻塞
+type Listener func(a Alert)
+
+// Engine 定期评估规则，维护 pending/firing/resolved 生命周期
+type Engine struct {
+	clock clock.Clock
+
+	mu        sync.Mutex
+	rules     []Rule
+	active    map[string]*Alert // key Alert.Key()
+	silences  map[string]Silence
+	silenceID int
+	listeners []Listener
+}
+
+func NewEngine(rules ...Rule) *Engine {
+	return &Engine{
+		clock:    clock.Real{},
+		rules:    rules,
+		active:   make(map[string]*Alert),
+		silences: make(map[string]Silence),
+	}
+}
+
+func (e *Engine) SetClock(c clock.Clock) {
+	e.clock = c
+}
+
+func (e *Engine) AddRule(rule Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules = append(e.rules, rule)
+}
+
+func (e *Engine) Subscribe(l Listener) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.listeners = append(e.listeners, l)
+}
+
+// Silence 新增静默，返回静默 ID
+func (e *Engine) Silence(matchers map[string]string, until time.Time, comment string) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.silenceID++
+	id := fmt.Sprintf("silence-%d", e.silenceID)
+	e.silences[id] = Silence{ID: id, Matchers: matchers, Until: until, Comment: comment}
+	return id
+}
+
+func (e *Engine) Unsilence(id string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.silences, id)
+}
+
+// Silences 未过期的静默
+func (e *Engine) Silences() []Silence {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.clock.Now()
+	var silences []Silence
+	for id, s := range e.silences {
+		if !now.Before(s.Until) {
+			delete(e.silences, id)
+			continue
+		}
+		silences = append(silences, s)
+	}
+	sort.Slice(silences, func(i, j int) bool { return silences[i].ID < silences[j].ID })
+	return silences
+}
+
+// Active 当前 pending 和 firing 的告警
+func (e *Engine) Active() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	alerts := make([]Alert, 0, len(e.active))
+	for _, a := range e.active {
+		alerts = append(alerts, copyAlert(a))
+	}
+	sortAlerts(alerts)
+	return alerts
+}
+
+// Evaluate 评估所有规则一次，返回状态发生变化的告警，以及静默结束后补发的 firing 告警。
+// resolved 只在对应的 firing 通知发出过时才通知，即使此时处于静默
+func (e *Engine) Evaluate() []Alert {
+	now := e.clock.Now()
+	e.mu.Lock()
+	rules := append([]Rule(nil), e.rules...)
+	e.mu.Unlock()
+
+	// 条件可能访问其他 manager，不在持锁时执行
+	results := make([][]Result, len(rules))
+	for i, rule := range rules {
+		results[i] = rule.Condition.Evaluate(now)
+	}
+
+	e.mu.Lock()
+	var changed []Alert
+	seen := make(map[string]struct{})
+	for i, rule := range rules {
+		for _, res := range results[i] {
+			a := Alert{Rule: rule.Name, Severity: rule.Severity, Labels: res.Labels}
+			key := a.Key()
+			seen[key] = struct{}{}
+
+			cur, ok := e.active[key]
+			if !ok {
+				cur = &a
+				cur.State = StatePending
+				cur.ActiveAt = now
+				e.active[key] = cur
+				changed = append(changed, *cur)
+			}
+			cur.Value = res.Value
+			cur.Message = res.Message
+			if cur.State == StatePending && now.Sub(cur.ActiveAt) >= rule.For {
+				cur.State = StateFiring
+				cur.FiredAt = now
+				if ok {
+					changed = append(changed, *cur)
+				} else {
+					changed[len(changed)-1] = *cur
+				}
+			}
+		}
+	}
+	for key, cur := range e.active {
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		delete(e.active, key)
+		// 没有触发过的 pending 告警直接丢弃
+		if cur.State == StateFiring {
+			cur.State = StateResolved
+			cur.ResolvedAt = now
+			changed = append(changed, *cur)
+		}
+	}
+
+	var notify []Alert
+	inChanged := make(map[string]struct{}, len(changed))
+	for i := range changed {
+		a := &changed[i]
+		inChanged[a.Key()] = struct{}{}
+		a.Silenced = e.silencedLocked(*a, now)
+		switch a.State {
+		case StateFiring:
+			if !a.Silenced {
+				e.active[a.Key()].notified = true
+			}
+		case StateResolved:
+			// 与 firing 配对：发过 firing 的一定发 resolved，没发过的不发
+			a.Silenced = !a.notified
+		}
+		*a = copyAlert(a)
+		if !a.Silenced {
+			notify = append(notify, *a)
+		}
+	}
+	// 静默期间触发、静默已结束的 firing 告警补发
+	for key, cur := range e.active {
+		if _, ok := inChanged[key]; ok || cur.State != StateFiring || cur.notified {
+			continue
+		}
+		if e.silencedLocked(*cur, now) {
+			continue
+		}
+		cur.notified = true
+		a := copyAlert(cur)
+		changed = append(changed, a)
+		notify = append(notify, a)
+	}
+	listeners := e.listeners
+	e.mu.Unlock()
+
+	sortAlerts(changed)
+	sortAlerts(notify)
+	for _, a := range notify {
+		for _, l := range listeners {
+			l(a)
+		}
+	}
+	return changed
+}
+
+// Run 每隔 interval 评估一次，直到 ctx 结束
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.Evaluate()
+		}
+	}
+}
+
+func (e *Engine) silencedLocked(a Alert, now time.Time) bool {
+	for _, s := range e.silences {
+		if s.matches(a, now) {
+			return true
+		}
+	}
+	return false
+}
+
+func copyAlert(a *Alert) Alert {
+	c := *a
+	c.Labels = make(map[string]string, len(a.Labels))
+	for k, v := range a.Labels {
+		c.Labels[k] = v
+	}
+	return c
+}
+
+func sortAlerts(alerts []Alert) {
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Key() < alerts[j].Key() })
+}
+
+func fingerprint(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
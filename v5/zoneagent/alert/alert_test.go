@@ -0,0 +1,209 @@
+package alert
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"code/platform/internal/clock"
+	"code/platform/v5/zoneagent/runtime/agent"
+	"code/platform/v5/zoneagent/runtime/plugin"
+)
+
+// toggle 条件是否成立由测试控制
+type toggle struct {
+	mu sync.Mutex
+	on bool
+}
+
+func (c *toggle) set(on bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.on = on
+}
+
+func (c *toggle) Evaluate(now time.Time) []Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.on {
+		return nil
+	}
+	return []Result{{Labels: map[string]string{"agent_id": "a1"}}}
+}
+
+type sink struct {
+	alerts []Alert
+}
+
+func (s *sink) states() []State {
+	states := make([]State, len(s.alerts))
+	for i, a := range s.alerts {
+		states[i] = a.State
+	}
+	s.alerts = nil
+	return states
+}
+
+func equalStates(a, b []State) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func newEngine(cond Condition, forDuration time.Duration) (*Engine, *clock.Fake, *sink) {
+	fake := clock.NewFake(time.Unix(1000, 0))
+	e := NewEngine(Rule{Name: "down", Severity: "critical", Condition: cond, For: forDuration})
+	e.SetClock(fake)
+	s := &sink{}
+	e.Subscribe(func(a Alert) { s.alerts = append(s.alerts, a) })
+	return e, fake, s
+}
+
+func TestEngineLifecycle(t *testing.T) {
+	cond := &toggle{on: true}
+	e, fake, s := newEngine(cond, time.Minute)
+
+	e.Evaluate()
+	if got := s.states(); !equalStates(got, []State{StatePending}) {
+		t.Fatalf("first evaluation notified %v", got)
+	}
+	fake.Advance(time.Minute)
+	e.Evaluate()
+	if got := s.states(); !equalStates(got, []State{StateFiring}) {
+		t.Fatalf("after For notified %v", got)
+	}
+	e.Evaluate()
+	if got := s.states(); len(got) != 0 {
+		t.Fatalf("steady firing notified %v", got)
+	}
+	cond.set(false)
+	e.Evaluate()
+	if got := s.states(); !equalStates(got, []State{StateResolved}) {
+		t.Fatalf("after clear notified %v", got)
+	}
+}
+
+func TestEngineSendsFiringAfterSilenceEnds(t *testing.T) {
+	cond := &toggle{on: true}
+	e, fake, s := newEngine(cond, 0)
+	e.Silence(map[string]string{"alertname": "down"}, fake.Now().Add(time.Minute), "maintenance")
+
+	e.Evaluate()
+	if got := s.states(); len(got) != 0 {
+		t.Fatalf("silenced alert notified %v", got)
+	}
+	fake.Advance(2 * time.Minute)
+	changed := e.Evaluate()
+	if got := s.states(); !equalStates(got, []State{StateFiring}) {
+		t.Fatalf("after silence ended notified %v, want firing", got)
+	}
+	if len(changed) != 1 || changed[0].State != StateFiring {
+		t.Fatalf("Evaluate returned %v", changed)
+	}
+	e.Evaluate()
+	if got := s.states(); len(got) != 0 {
+		t.Fatalf("firing sent twice: %v", got)
+	}
+}
+
+func TestEngineResolvedPairsWithFiring(t *testing.T) {
+	cond := &toggle{on: true}
+	e, fake, s := newEngine(cond, 0)
+
+	// 静默期间触发并恢复：firing 和 resolved 都不发
+	id := e.Silence(map[string]string{"agent_id": "a1"}, fake.Now().Add(time.Hour), "")
+	e.Evaluate()
+	cond.set(false)
+	e.Evaluate()
+	if got := s.states(); len(got) != 0 {
+		t.Fatalf("silenced lifecycle notified %v", got)
+	}
+	e.Unsilence(id)
+
+	// firing 已发出后才静默：resolved 照常发出
+	cond.set(true)
+	e.Evaluate()
+	e.Silence(map[string]string{"agent_id": "a1"}, fake.Now().Add(time.Hour), "")
+	cond.set(false)
+	e.Evaluate()
+	if got := s.states(); !equalStates(got, []State{StateFiring, StateResolved}) {
+		t.Fatalf("notified %v, want firing then resolved", got)
+	}
+}
+
+func TestAgentHeartbeatLostForgetsEvicted(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1000, 0))
+	agents := agent.NewManager(nil, 10*time.Second)
+	agents.SetClock(fake)
+	cond := NewAgentHeartbeatLost(agents, 5*time.Second, time.Hour)
+
+	agents.Register(agent.NewAgent("a1", ""))
+	agents.Register(agent.NewAgent("a2", ""))
+	fake.Advance(11 * time.Second)
+	agents.Heartbeat("a2")
+	agents.Sweep()
+
+	if got := cond.Evaluate(fake.Now()); len(got) != 1 || got[0].Labels["agent_id"] != "a1" {
+		t.Fatalf("results = %v, want evicted a1", got)
+	}
+	fake.Advance(30 * time.Minute)
+	agents.Heartbeat("a2")
+	if got := cond.Evaluate(fake.Now()); len(got) != 1 {
+		t.Fatalf("results = %v, want a1 still lost", got)
+	}
+	fake.Advance(time.Hour)
+	agents.Heartbeat("a2")
+	if got := cond.Evaluate(fake.Now()); len(got) != 0 {
+		t.Fatalf("results = %v, want a1 forgotten", got)
+	}
+	if len(cond.evicted) != 0 {
+		t.Fatalf("evicted not pruned: %v", cond.evicted)
+	}
+}
+
+func TestPluginRestartLoop(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1000, 0))
+	plugins := plugin.NewManager(nil)
+	plugins.SetClock(fake)
+	cond := NewPluginRestartLoop(plugins, time.Minute, 2)
+	move := func(states ...plugin.State) {
+		t.Helper()
+		for _, s := range states {
+			fake.Advance(time.Second)
+			if _, err := plugins.Transition("i1", "v1", s, ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if _, err := plugins.Create(plugin.NewPlugin("i1", "v1", "", "")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 首次启动和启动失败都不算重启
+	move(plugin.StateScheduled, plugin.StateFailed, plugin.StatePending, plugin.StateScheduled, plugin.StateRunning)
+	if got := cond.Evaluate(fake.Now()); len(got) != 0 {
+		t.Fatalf("results = %v, want none before any restart", got)
+	}
+	// supervisor 拉起一次，失败后重新调度一次
+	move(plugin.StateStarting, plugin.StateRunning)
+	move(plugin.StateFailed, plugin.StatePending, plugin.StateScheduled, plugin.StateRunning)
+	if got := cond.Evaluate(fake.Now()); len(got) != 1 || got[0].Value != 2 {
+		t.Fatalf("results = %v, want 2 restarts", got)
+	}
+
+	// 主动停止后重新启动不计入，旧的重启移出窗口
+	move(plugin.StateStopping, plugin.StateStopped, plugin.StatePending, plugin.StateScheduled, plugin.StateRunning)
+	fake.Advance(time.Minute)
+	if got := cond.Evaluate(fake.Now()); len(got) != 0 {
+		t.Fatalf("results = %v, want none after window", got)
+	}
+	if len(cond.restarts) != 0 {
+		t.Fatalf("restarts not pruned: %v", cond.restarts)
+	}
+}
@@ -0,0 +1,221 @@
+package alert
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"code/platform/v5/zoneagent/metric"
+	"code/platform/v5/zoneagent/runtime/agent"
+	"code/platform/v5/zoneagent/runtime/plugin"
+)
+
+// PluginCPUAbove 插件最近一次采样的 cpu 超过阈值，配合 Rule.For 表示持续 N 分钟
+type PluginCPUAbove struct {
+	Metrics   *metric.Manager
+	Threshold float64
+}
+
+func (c PluginCPUAbove) Evaluate(now time.Time) []Result {
+	var results []Result
+	for _, agentID := range c.Metrics.Agents() {
+		for _, pluginID := range c.Metrics.Plugins(agentID) {
+			sample, ok := c.Metrics.LatestPlugin(pluginID)
+			if !ok || sample.CPU() <= c.Threshold {
+				continue
+			}
+			results = append(results, Result{
+				Labels:  map[string]string{"agent_id": agentID, "plugin_id": pluginID},
+				Value:   sample.CPU(),
+				Message: fmt.Sprintf("plugin %s cpu %.2f above %.2f", pluginID, sample.CPU(), c.Threshold),
+			})
+		}
+	}
+	return results
+}
+
+// PluginMemoryGrowth 插件内存在 Window 内增长超过 Ratio 倍，例如 1.5 表示增长 50%
+type PluginMemoryGrowth struct {
+	Metrics *metric.Manager
+	Window  time.Duration
+	Ratio   float64
+}
+
+func (c PluginMemoryGrowth) Evaluate(now time.Time) []Result {
+	var results []Result
+	for _, agentID := range c.Metrics.Agents() {
+		for _, pluginID := range c.Metrics.Plugins(agentID) {
+			samples := c.Metrics.PluginRange(pluginID, now.Add(-c.Window), now)
+			if len(samples) < 2 {
+				continue
+			}
+			first, last := samples[0].Memory(), samples[len(samples)-1].Memory()
+			if first <= 0 || last/first < c.Ratio {
+				continue
+			}
+			results = append(results, Result{
+				Labels:  map[string]string{"agent_id": agentID, "plugin_id": pluginID},
+				Value:   last / first,
+				Message: fmt.Sprintf("plugin %s memory grew from %.0f to %.0f in %s", pluginID, first, last, c.Window),
+			})
+		}
+	}
+	return results
+}
+
+// 被驱逐的 agent 默认持续告警的时长
+const defaultForget = 24 * time.Hour
+
+// AgentHeartbeatLost agent 超过 After 没有心跳，或已被驱逐且还没有重新注册。
+// 驱逐后超过 forget 仍未重新注册的 agent 视为已下线，告警随之恢复
+type AgentHeartbeatLost struct {
+	agents *agent.Manager
+	after  time.Duration
+	forget time.Duration
+
+	mu      sync.Mutex
+	evicted map[string]time.Time // agentID:最后一次心跳
+}
+
+// NewAgentHeartbeatLost forget 不大于 0 时使用 defaultForget
+func NewAgentHeartbeatLost(agents *agent.Manager, after time.Duration, forget time.Duration) *AgentHeartbeatLost {
+	if forget <= 0 {
+		forget = defaultForget
+	}
+	c := &AgentHeartbeatLost{
+		agents:  agents,
+		after:   after,
+		forget:  forget,
+		evicted: make(map[string]time.Time),
+	}
+	agents.OnEvict(func(a agent.Agent) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.evicted[a.AgentID()] = a.LastHeartbeat()
+	})
+	return c
+}
+
+func (c *AgentHeartbeatLost) Evaluate(now time.Time) []Result {
+	var results []Result
+	for _, a := range c.agents.List() {
+		if silent := now.Sub(a.LastHeartbeat()); silent > c.after {
+			results = append(results, c.result(a.AgentID(), silent))
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for agentID, last := range c.evicted {
+		if _, err := c.agents.Get(agentID); err == nil {
+			// 已重新注册
+			delete(c.evicted, agentID)
+			continue
+		}
+		if now.Sub(last) > c.forget {
+			delete(c.evicted, agentID)
+			continue
+		}
+		results = append(results, c.result(agentID, now.Sub(last)))
+	}
+	return results
+}
+
+func (c *AgentHeartbeatLost) result(agentID string, silent time.Duration) Result {
+	return Result{
+		Labels:  map[string]string{"agent_id": agentID},
+		Value:   silent.Seconds(),
+		Message: fmt.Sprintf("agent %s heartbeat lost for %s", agentID, silent.Truncate(time.Second)),
+	}
+}
+
+// PluginRestartLoop 插件在 Window 内重启次数达到 Threshold。
+// 重启指插件运行过之后再次进入 running，主动停止后重新启动不计入
+type PluginRestartLoop struct {
+	window    time.Duration
+	threshold int
+
+	mu       sync.Mutex
+	started  map[string]bool        // key instanceID + version，运行过且没有被主动停止
+	restarts map[string][]time.Time // key instanceID + version
+}
+
+func NewPluginRestartLoop(plugins *plugin.Manager, window time.Duration, threshold int) *PluginRestartLoop {
+	c := &PluginRestartLoop{
+		window:    window,
+		threshold: threshold,
+		started:   make(map[string]bool),
+		restarts:  make(map[string][]time.Time),
+	}
+	plugins.Subscribe(c.observe)
+	return c
+}
+
+func (c *PluginRestartLoop) observe(ev plugin.Event) {
+	key := plugin.Key(ev.InstanceID, ev.Version)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case ev.To == plugin.StateStopped:
+		delete(c.started, key)
+	case ev.To != plugin.StateRunning || ev.From == plugin.StateRunning:
+	case c.started[key]:
+		c.restarts[key] = append(c.restarts[key], ev.At)
+	default:
+		c.started[key] = true
+	}
+}
+
+func (c *PluginRestartLoop) Evaluate(now time.Time) []Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var results []Result
+	for key, restarts := range c.restarts {
+		i := 0
+		for i < len(restarts) && now.Sub(restarts[i]) > c.window {
+			i++
+		}
+		restarts = restarts[i:]
+		if len(restarts) == 0 {
+			delete(c.restarts, key)
+			continue
+		}
+		c.restarts[key] = restarts
+		if len(restarts) < c.threshold {
+			continue
+		}
+		results = append(results, Result{
+			Labels:  map[string]string{"plugin_id": key},
+			Value:   float64(len(restarts)),
+			Message: fmt.Sprintf("plugin %s restarted %d times in %s", key, len(restarts), c.window),
+		})
+	}
+	return results
+}
+
+// DefaultRules 管理端默认启用的规则，agentTTL 为 agent 心跳的过期时间
+func DefaultRules(metrics *metric.Manager, agents *agent.Manager, plugins *plugin.Manager, agentTTL time.Duration) []Rule {
+	return []Rule{
+		{
+			Name:      "PluginCPUHigh",
+			Severity:  "warning",
+			Condition: PluginCPUAbove{Metrics: metrics, Threshold: 1},
+			For:       5 * time.Minute,
+		},
+		{
+			Name:      "PluginMemoryGrowth",
+			Severity:  "warning",
+			Condition: PluginMemoryGrowth{Metrics: metrics, Window: 10 * time.Minute, Ratio: 1.5},
+		},
+		{
+			Name:      "AgentHeartbeatLost",
+			Severity:  "critical",
+			Condition: NewAgentHeartbeatLost(agents, agentTTL, 0),
+		},
+		{
+			Name:      "PluginRestartLoop",
+			Severity:  "critical",
+			Condition: NewPluginRestartLoop(plugins, 10*time.Minute, 3),
+		},
+	}
+}
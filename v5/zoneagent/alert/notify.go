@@ -0,0 +1,355 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"code/platform/internal/clock"
+)
+
+const defaultTemplate = `[{{.Status}}] {{.Route}}{{range .Alerts}}
+- {{.State}} {{.Rule}}{{if .Severity}} ({{.Severity}}){{end}}: {{.Message}}{{end}}`
+
+var defaultTmpl = template.Must(NewTemplate(defaultTemplate))
+
+// Notification 一次发送的内容：同一路由、同一分组内的告警
+type Notification struct {
+	Route       string
+	GroupLabels map[string]string
+	// 分组内有 firing 的告警时为 firing，否则为 resolved
+	Status  State
+	Alerts  []Alert
+	Message string
+}
+
+// Notifier 告警通知的发送端
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// NewTemplate 解析消息模板，模板数据为 Notification
+func NewTemplate(text string) (*template.Template, error) {
+	return template.New("alert").Parse(text)
+}
+
+// Webhook 以 JSON POST 发送通知，非 2xx 视为失败
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+type webhookAlert struct {
+	Rule       string            `json:"rule"`
+	Severity   string            `json:"severity,omitempty"`
+	State      State             `json:"state"`
+	Labels     map[string]string `json:"labels"`
+	Value      float64           `json:"value"`
+	Message    string            `json:"message"`
+	ActiveAt   time.Time         `json:"active_at"`
+	FiredAt    time.Time         `json:"fired_at"`
+	ResolvedAt time.Time         `json:"resolved_at"`
+}
+
+type webhookPayload struct {
+	Route       string            `json:"route"`
+	GroupLabels map[string]string `json:"group_labels"`
+	Status      State             `json:"status"`
+	Message     string            `json:"message"`
+	Alerts      []webhookAlert    `json:"alerts"`
+}
+
+func (w *Webhook) Notify(ctx context.Context, n Notification) error {
+	payload := webhookPayload{
+		Route:       n.Route,
+		GroupLabels: n.GroupLabels,
+		Status:      n.Status,
+		Message:     n.Message,
+		Alerts:      make([]webhookAlert, 0, len(n.Alerts)),
+	}
+	for _, a := range n.Alerts {
+		payload.Alerts = append(payload.Alerts, webhookAlert{
+			Rule:       a.Rule,
+			Severity:   a.Severity,
+			State:      a.State,
+			Labels:     a.Labels,
+			Value:      a.Value,
+			Message:    a.Message,
+			ActiveAt:   a.ActiveAt,
+			FiredAt:    a.FiredAt,
+			ResolvedAt: a.ResolvedAt,
+		})
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("alert: webhook %s returned %s", w.URL, resp.Status)
+	}
+	return nil
+}
+
+// Log 把通知写到日志，Logger 为空时使用标准库默认 logger
+type Log struct {
+	Logger *log.Logger
+}
+
+func (l *Log) Notify(ctx context.Context, n Notification) error {
+	if l.Logger == nil {
+		log.Print(n.Message)
+		return nil
+	}
+	l.Logger.Print(n.Message)
+	return nil
+}
+
+// Route 匹配的告警按 GroupBy 分组后发给 Notifier
+type Route struct {
+	Name string
+	// 告警标签全部匹配时命中，key 为 alertname/severity 时匹配规则名/级别，为空时匹配所有告警
+	Matchers map[string]string
+	GroupBy  []string
+	// 同一分组两次发送的最小间隔
+	Interval time.Duration
+	Notifier Notifier
+	// 为空时使用默认模板
+	Template *template.Template
+	// 命中后是否继续匹配后面的路由
+	Continue bool
+}
+
+func (r *Route) matches(a Alert) bool {
+	for k, v := range r.Matchers {
+		var got string
+		switch k {
+		case "alertname":
+			got = a.Rule
+		case "severity":
+			got = a.Severity
+		default:
+			got = a.Labels[k]
+		}
+		if got != v {
+			return false
+		}
+	}
+	return true
+}
+
+type group struct {
+	route  *Route
+	labels map[string]string
+	alerts map[string]Alert // key Alert.Key()，同一告警只保留最新状态
+	// 每个告警最近一次写入的序号，发送成功后只删除发送期间没有更新的告警
+	seqs     map[string]uint64
+	lastSent time.Time
+	// 正在发送，避免并发的 Flush 重复发送同一分组
+	sending bool
+}
+
+// Dispatcher 接收引擎的告警变化，按路由分组、限流，发送失败时重试
+type Dispatcher struct {
+	routes   []*Route
+	maxRetry int
+	backoff  time.Duration
+	clock    clock.Clock
+
+	mu     sync.Mutex
+	groups map[string]*group // key 路由名 + 分组标签
+	seq    uint64
+}
+
+// NewDispatcher 发送失败时最多重试 maxRetry 次，等待时间从 backoff 开始翻倍
+func NewDispatcher(maxRetry int, backoff time.Duration, routes ...Route) *Dispatcher {
+	d := &Dispatcher{
+		maxRetry: maxRetry,
+		backoff:  backoff,
+		clock:    clock.Real{},
+		groups:   make(map[string]*group),
+	}
+	for i := range routes {
+		d.routes = append(d.routes, &routes[i])
+	}
+	return d
+}
+
+func (d *Dispatcher) SetClock(c clock.Clock) {
+	d.clock = c
+}
+
+// Add 作为 Engine 的 Listener 使用，只接收 firing 和 resolved 的告警
+func (d *Dispatcher) Add(a Alert) {
+	if a.State == StatePending {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, r := range d.routes {
+		if !r.matches(a) {
+			continue
+		}
+		labels := make(map[string]string, len(r.GroupBy))
+		for _, k := range r.GroupBy {
+			labels[k] = a.Labels[k]
+		}
+		key := r.Name + "{" + fingerprint(labels) + "}"
+		g, ok := d.groups[key]
+		if !ok {
+			g = &group{route: r, labels: labels, alerts: make(map[string]Alert), seqs: make(map[string]uint64)}
+			d.groups[key] = g
+		}
+		d.seq++
+		g.alerts[a.Key()] = a
+		g.seqs[a.Key()] = d.seq
+		if !r.Continue {
+			return
+		}
+	}
+}
+
+// Flush 并行发送所有到了发送间隔的分组，返回一个发送失败的错误。
+// 发送成功后才清空分组，重试后仍失败的告警保留到下一次 Flush
+func (d *Dispatcher) Flush(ctx context.Context) error {
+	now := d.clock.Now()
+	type batch struct {
+		group *group
+		seqs  map[string]uint64
+		n     Notification
+	}
+	var due []batch
+	d.mu.Lock()
+	keys := make([]string, 0, len(d.groups))
+	for key := range d.groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		g := d.groups[key]
+		if g.sending || len(g.alerts) == 0 || now.Sub(g.lastSent) < g.route.Interval {
+			continue
+		}
+		seqs := make(map[string]uint64, len(g.seqs))
+		for k, v := range g.seqs {
+			seqs[k] = v
+		}
+		g.sending = true
+		due = append(due, batch{group: g, seqs: seqs, n: d.notificationLocked(g)})
+	}
+	d.mu.Unlock()
+
+	errs := make([]error, len(due))
+	var wg sync.WaitGroup
+	for i, b := range due {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = d.send(ctx, b.group.route, b.n)
+		}()
+	}
+	wg.Wait()
+
+	var lastErr error
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, b := range due {
+		g := b.group
+		g.sending = false
+		if errs[i] != nil {
+			log.Printf("alert: notify route %s failed: %v", b.n.Route, errs[i])
+			lastErr = errs[i]
+			continue
+		}
+		g.lastSent = now
+		for key, seq := range b.seqs {
+			if g.seqs[key] == seq {
+				delete(g.alerts, key)
+				delete(g.seqs, key)
+			}
+		}
+	}
+	return lastErr
+}
+
+// Run 每隔 interval 执行一次 Flush，直到 ctx 结束
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.Flush(ctx)
+		}
+	}
+}
+
+func (d *Dispatcher) notificationLocked(g *group) Notification {
+	n := Notification{
+		Route:       g.route.Name,
+		GroupLabels: g.labels,
+		Status:      StateResolved,
+	}
+	for _, a := range g.alerts {
+		n.Alerts = append(n.Alerts, a)
+		if a.State == StateFiring {
+			n.Status = StateFiring
+		}
+	}
+	sortAlerts(n.Alerts)
+	return n
+}
+
+func (d *Dispatcher) send(ctx context.Context, r *Route, n Notification) error {
+	tmpl := r.Template
+	if tmpl == nil {
+		tmpl = defaultTmpl
+	}
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, n); err != nil {
+		// 模板错误重试也不会恢复，改用默认模板发送，避免分组一直积压
+		log.Printf("alert: render template of route %s failed, fall back to default: %v", r.Name, err)
+		buf.Reset()
+		if err := defaultTmpl.Execute(&buf, n); err != nil {
+			return err
+		}
+	}
+	n.Message = buf.String()
+
+	backoff := d.backoff
+	var err error
+	for i := 0; ; i++ {
+		if err = r.Notifier.Notify(ctx, n); err == nil || i >= d.maxRetry {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
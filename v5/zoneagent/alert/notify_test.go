@@ -0,0 +1,233 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"code/platform/internal/clock"
+)
+
+// hook 记录收到的 webhook，fail 次数内返回 500
+type hook struct {
+	mu       sync.Mutex
+	payloads []webhookPayload
+	fail     int
+	server   *httptest.Server
+}
+
+func newHook(t *testing.T, fail int) *hook {
+	h := &hook{fail: fail}
+	h.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var p webhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.fail > 0 {
+			h.fail--
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		h.payloads = append(h.payloads, p)
+	}))
+	t.Cleanup(h.server.Close)
+	return h
+}
+
+func (h *hook) received() []webhookPayload {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]webhookPayload(nil), h.payloads...)
+}
+
+func (h *hook) setFail(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fail = n
+}
+
+func firing(rule string, labels map[string]string) Alert {
+	return Alert{Rule: rule, Severity: "critical", Labels: labels, State: StateFiring, Message: rule + " firing"}
+}
+
+func TestWebhookPayload(t *testing.T) {
+	h := newHook(t, 0)
+	d := NewDispatcher(0, time.Millisecond, Route{
+		Name:     "ops",
+		GroupBy:  []string{"agent_id"},
+		Notifier: &Webhook{URL: h.server.URL},
+	})
+	d.Add(firing("down", map[string]string{"agent_id": "a1"}))
+	d.Add(firing("cpu", map[string]string{"agent_id": "a1", "plugin_id": "p1"}))
+	d.Add(firing("down", map[string]string{"agent_id": "a2"}))
+	if err := d.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := h.received()
+	if len(got) != 2 {
+		t.Fatalf("received %d notifications, want one per group", len(got))
+	}
+	byAgent := map[string]webhookPayload{}
+	for _, p := range got {
+		byAgent[p.GroupLabels["agent_id"]] = p
+	}
+	p := byAgent["a1"]
+	if p.Route != "ops" || p.Status != StateFiring || len(p.Alerts) != 2 {
+		t.Fatalf("a1 payload = %+v", p)
+	}
+	if !strings.Contains(p.Message, "[firing] ops") || !strings.Contains(p.Message, "down (critical)") {
+		t.Fatalf("message = %q", p.Message)
+	}
+}
+
+func TestWebhookErrorStatus(t *testing.T) {
+	h := newHook(t, 1)
+	err := (&Webhook{URL: h.server.URL}).Notify(context.Background(), Notification{Route: "ops"})
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Fatalf("Notify = %v, want 500 error", err)
+	}
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	h := newHook(t, 2)
+	d := NewDispatcher(2, time.Millisecond, Route{Name: "ops", Notifier: &Webhook{URL: h.server.URL}})
+	d.Add(firing("down", nil))
+	if err := d.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush with retries = %v", err)
+	}
+	if got := h.received(); len(got) != 1 {
+		t.Fatalf("received %d, want 1", len(got))
+	}
+}
+
+func TestDispatcherKeepsFailedNotification(t *testing.T) {
+	h := newHook(t, 10)
+	d := NewDispatcher(1, time.Millisecond, Route{Name: "ops", Notifier: &Webhook{URL: h.server.URL}, Interval: time.Hour})
+	d.Add(firing("down", nil))
+	if err := d.Flush(context.Background()); err == nil {
+		t.Fatal("Flush succeeded against failing webhook")
+	}
+
+	// 下一次 Flush 不受 Interval 限制，仍然发送之前失败的告警
+	h.setFail(0)
+	if err := d.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := h.received()
+	if len(got) != 1 || len(got[0].Alerts) != 1 || got[0].Alerts[0].Rule != "down" {
+		t.Fatalf("received %+v", got)
+	}
+	if err := d.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.received(); len(got) != 1 {
+		t.Fatalf("sent again after success: %d", len(got))
+	}
+}
+
+func TestDispatcherInterval(t *testing.T) {
+	h := newHook(t, 0)
+	fake := clock.NewFake(time.Unix(1000, 0))
+	d := NewDispatcher(0, time.Millisecond, Route{Name: "ops", Notifier: &Webhook{URL: h.server.URL}, Interval: time.Minute})
+	d.SetClock(fake)
+
+	d.Add(firing("down", nil))
+	d.Flush(context.Background())
+	resolved := firing("down", nil)
+	resolved.State = StateResolved
+	d.Add(resolved)
+	d.Flush(context.Background())
+	if got := h.received(); len(got) != 1 {
+		t.Fatalf("received %d within interval, want 1", len(got))
+	}
+	fake.Advance(time.Minute)
+	d.Flush(context.Background())
+	got := h.received()
+	if len(got) != 2 || got[1].Status != StateResolved {
+		t.Fatalf("received %+v", got)
+	}
+}
+
+// blocked 一直阻塞到 ctx 结束
+type blocked struct{}
+
+func (blocked) Notify(ctx context.Context, n Notification) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestDispatcherRoutesInParallel(t *testing.T) {
+	h := newHook(t, 0)
+	d := NewDispatcher(0, time.Millisecond,
+		Route{Name: "dead", Notifier: blocked{}, Continue: true},
+		Route{Name: "ops", Notifier: &Webhook{URL: h.server.URL}},
+	)
+	d.Add(firing("down", nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- d.Flush(ctx) }()
+
+	deadline := time.Now().Add(time.Second)
+	for len(h.received()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("healthy route held up by a dead one")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Flush = %v, want canceled from dead route", err)
+	}
+}
+
+func TestDispatcherIgnoresPending(t *testing.T) {
+	h := newHook(t, 0)
+	d := NewDispatcher(0, time.Millisecond, Route{Name: "ops", Notifier: &Webhook{URL: h.server.URL}})
+	a := firing("down", nil)
+	a.State = StatePending
+	d.Add(a)
+	d.Flush(context.Background())
+	if got := h.received(); len(got) != 0 {
+		t.Fatalf("pending alert sent: %+v", got)
+	}
+}
+
+func TestDispatcherTemplateErrorFallsBack(t *testing.T) {
+	h := newHook(t, 0)
+	// 执行时才会出错的模板：对字符串字段取下标
+	tmpl, err := NewTemplate(`{{index .Route 99}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDispatcher(0, time.Millisecond, Route{Name: "ops", Notifier: &Webhook{URL: h.server.URL}, Template: tmpl})
+	d.Add(firing("down", nil))
+	if err := d.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush with broken template = %v", err)
+	}
+	got := h.received()
+	if len(got) != 1 || !strings.HasPrefix(got[0].Message, "[firing] ops") {
+		t.Fatalf("received %+v, want default rendering", got)
+	}
+	// 分组已清空，不会每次 Flush 重发
+	if err := d.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.received(); len(got) != 1 {
+		t.Fatalf("sent again after fallback: %d", len(got))
+	}
+}
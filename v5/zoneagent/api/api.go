@@ -0,0 +1,83 @@
+package api
+
+import "errors"
+
+// Prefix 当前接口版本，不兼容的变更使用新的前缀
+const Prefix = "/v1"
+
+// ErrNotRegistered agent 未注册或已被驱逐，需要重新注册
+var ErrNotRegistered = errors.New("api: agent not registered")
+
+// 下发给 agent 的任务类型
+const (
+	ActionStart = "start"
+	ActionStop  = "stop"
+)
+
+// 插件在 agent 上的状态
+const (
+	StatusStarting = "starting"
+	StatusRunning  = "running"
+	StatusStopped  = "stopped"
+	StatusFailed   = "failed"
+)
+
+// RegisterRequest PUT /v1/agents/{id}
+type RegisterRequest struct {
+	IP     string            `json:"ip"`
+	CPU    float64           `json:"cpu"`
+	Memory float64           `json:"memory"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type RegisterResponse struct {
+	// agent 上报间隔，超过 manager 的心跳租约未上报会被驱逐
+	HeartbeatIntervalMS int64 `json:"heartbeat_interval_ms"`
+}
+
+// Process 进程采样，cpu 为核数，memory 为字节
+type Process struct {
+	PID    string  `json:"pid"`
+	CPU    float64 `json:"cpu"`
+	Memory float64 `json:"memory"`
+}
+
+// PluginReport agent 上一个插件进程的状态
+type PluginReport struct {
+	InstanceID string `json:"instance_id"`
+	Version    string `json:"version"`
+	Status     string `json:"status"`
+	Reason     string `json:"reason,omitempty"`
+	Process
+}
+
+// ReportRequest POST /v1/agents/{id}/report，同时作为心跳
+type ReportRequest struct {
+	Agent   Process        `json:"agent"`
+	Plugins []PluginReport `json:"plugins"`
+}
+
+// Task GET /v1/agents/{id}/tasks 返回的任务，执行后需要确认，否则超时后重新下发
+type Task struct {
+	ID string `json:"id"`
+	// 第几次下发，大于 1 表示之前的下发未确认，agent 需要保证重复执行无副作用
+	Attempt    int    `json:"attempt"`
+	InstanceID string `json:"instance_id"`
+	Version    string `json:"version"`
+	Action     string `json:"action"`
+}
+
+type TasksResponse struct {
+	Tasks []Task `json:"tasks"`
+}
+
+// Assignment 分配给 agent、应当在其上运行的插件
+type Assignment struct {
+	InstanceID string `json:"instance_id"`
+	Version    string `json:"version"`
+}
+
+// AssignmentsResponse GET /v1/agents/{id}/assignments，agent 以此为准对比本地进程
+type AssignmentsResponse struct {
+	Assignments []Assignment `json:"assignments"`
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client agent 侧调用 Server 的客户端
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// NewClient baseURL 为 manager 地址，不含版本前缀；hc 为空时使用 http.DefaultClient
+func NewClient(baseURL string, hc *http.Client) *Client {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), http: hc}
+}
+
+func (c *Client) Register(ctx context.Context, agentID string, req RegisterRequest) (RegisterResponse, error) {
+	var resp RegisterResponse
+	err := c.do(ctx, http.MethodPut, agentPath(agentID), req, &resp)
+	return resp, err
+}
+
+func (c *Client) Unregister(ctx context.Context, agentID string) error {
+	return c.do(ctx, http.MethodDelete, agentPath(agentID), nil, nil)
+}
+
+// Report 返回 ErrNotRegistered 时需要重新注册
+func (c *Client) Report(ctx context.Context, agentID string, req ReportRequest) error {
+	return c.do(ctx, http.MethodPost, agentPath(agentID)+"/report", req, nil)
+}
+
+// Tasks 长轮询任务，最多等待 wait，为 0 时立即返回；http.Client 的超时需要大于 wait
+func (c *Client) Tasks(ctx context.Context, agentID string, wait time.Duration) ([]Task, error) {
+	var resp TasksResponse
+	path := agentPath(agentID) + "/tasks"
+	if wait > 0 {
+		path += "?wait=" + url.QueryEscape(wait.String())
+	}
+	err := c.do(ctx, http.MethodGet, path, nil, &resp)
+	return resp.Tasks, err
+}
+
+// Ack 确认任务已执行
+func (c *Client) Ack(ctx context.Context, agentID string, taskID string) error {
+	return c.do(ctx, http.MethodPost, agentPath(agentID)+"/tasks/"+url.PathEscape(taskID)+"/ack", nil, nil)
+}
+
+func (c *Client) Assignments(ctx context.Context, agentID string) ([]Assignment, error) {
+	var resp AssignmentsResponse
+	err := c.do(ctx, http.MethodGet, agentPath(agentID)+"/assignments", nil, &resp)
+	return resp.Assignments, err
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, in any, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotRegistered
+	case resp.StatusCode >= 300:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("api: %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func agentPath(agentID string) string {
+	return Prefix + "/agents/" + url.PathEscape(agentID)
+}
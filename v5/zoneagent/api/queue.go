@@ -0,0 +1,138 @@
+package api
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"code/platform/internal/clock"
+)
+
+// delivery 一个待确认的任务，deadline 为零表示尚未下发
+type delivery struct {
+	task     Task
+	deadline time.Time
+}
+
+// agentQueue 单个 agent 的任务队列：pending 按入队顺序下发，下发后进入 inflight 等待确认
+type agentQueue struct {
+	pending  []*delivery
+	inflight map[string]*delivery // key task.ID
+	// 有新任务时关闭并替换，唤醒长轮询
+	notify chan struct{}
+}
+
+func newAgentQueue() *agentQueue {
+	return &agentQueue{inflight: make(map[string]*delivery), notify: make(chan struct{})}
+}
+
+// queues 所有 agent 的任务队列，未在 ackTimeout 内确认的任务重新下发
+type queues struct {
+	mu         sync.Mutex
+	clock      clock.Clock
+	ackTimeout time.Duration
+	seq        uint64
+	agents     map[string]*agentQueue
+}
+
+func newQueues(ackTimeout time.Duration) *queues {
+	return &queues{
+		clock:      clock.Real{},
+		ackTimeout: ackTimeout,
+		agents:     make(map[string]*agentQueue),
+	}
+}
+
+func (q *queues) get(agentID string) *agentQueue {
+	aq, ok := q.agents[agentID]
+	if !ok {
+		aq = newAgentQueue()
+		q.agents[agentID] = aq
+	}
+	return aq
+}
+
+func (q *queues) push(agentID string, task Task) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.seq++
+	task.ID = strconv.FormatUint(q.seq, 10)
+	aq := q.get(agentID)
+	aq.pending = append(aq.pending, &delivery{task: task})
+	close(aq.notify)
+	aq.notify = make(chan struct{})
+}
+
+// take 取走可下发的任务：超时未确认的任务优先，其次是新任务。
+// 没有任务时返回用于等待的通道
+func (q *queues) take(agentID string) ([]Task, <-chan struct{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	aq := q.get(agentID)
+	now := q.clock.Now()
+
+	var due []*delivery
+	for _, d := range aq.inflight {
+		if !now.Before(d.deadline) {
+			due = append(due, d)
+		}
+	}
+	sortDeliveries(due)
+	due = append(due, aq.pending...)
+	aq.pending = nil
+	if len(due) == 0 {
+		return nil, aq.notify
+	}
+
+	tasks := make([]Task, 0, len(due))
+	for _, d := range due {
+		d.task.Attempt++
+		d.deadline = now.Add(q.ackTimeout)
+		aq.inflight[d.task.ID] = d
+		tasks = append(tasks, d.task)
+	}
+	return tasks, nil
+}
+
+// ack 确认任务已执行，重复确认或未知任务忽略
+func (q *queues) ack(agentID string, taskID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if aq, ok := q.agents[agentID]; ok {
+		delete(aq.inflight, taskID)
+	}
+}
+
+// drain 删除 agent 的队列，返回尚未确认的任务，按入队顺序
+func (q *queues) drain(agentID string) []Task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	aq, ok := q.agents[agentID]
+	if !ok {
+		return nil
+	}
+	delete(q.agents, agentID)
+	close(aq.notify)
+
+	rest := make([]*delivery, 0, len(aq.inflight)+len(aq.pending))
+	for _, d := range aq.inflight {
+		rest = append(rest, d)
+	}
+	sortDeliveries(rest)
+	rest = append(rest, aq.pending...)
+	tasks := make([]Task, 0, len(rest))
+	for _, d := range rest {
+		tasks = append(tasks, d.task)
+	}
+	return tasks
+}
+
+// sortDeliveries 按任务序号排序，保持入队顺序
+func sortDeliveries(ds []*delivery) {
+	seq := func(d *delivery) uint64 {
+		n, _ := strconv.ParseUint(d.task.ID, 10, 64)
+		return n
+	}
+	sort.Slice(ds, func(i, j int) bool { return seq(ds[i]) < seq(ds[j]) })
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"code/platform/internal/clock"
+)
+
+func newTestQueues() (*queues, *clock.Fake) {
+	fake := clock.NewFake(time.Unix(1000, 0))
+	q := newQueues(10 * time.Second)
+	q.clock = fake
+	return q, fake
+}
+
+// instances 按顺序返回任务的实例 ID
+func instances(tasks []Task) []string {
+	ids := make([]string, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.InstanceID
+	}
+	return ids
+}
+
+func equalIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestQueuesOrder(t *testing.T) {
+	q, _ := newTestQueues()
+	tasks, notify := q.take("a1")
+	if len(tasks) != 0 || notify == nil {
+		t.Fatalf("take on empty queue = %v, %v, want wait channel", tasks, notify)
+	}
+	for _, id := range []string{"i1", "i2", "i3"} {
+		q.push("a1", Task{InstanceID: id, Action: "start"})
+	}
+	select {
+	case <-notify:
+	default:
+		t.Fatal("push did not wake the waiter")
+	}
+	q.push("a2", Task{InstanceID: "i4", Action: "start"})
+
+	tasks, _ = q.take("a1")
+	if got := instances(tasks); !equalIDs(got, []string{"i1", "i2", "i3"}) {
+		t.Fatalf("took %v, want i1 i2 i3 in order", got)
+	}
+	for _, task := range tasks {
+		if task.Attempt != 1 || task.ID == "" {
+			t.Fatalf("task %+v, want first attempt with an ID", task)
+		}
+	}
+	// 下发后等待确认，不会重复下发
+	if tasks, _ := q.take("a1"); len(tasks) != 0 {
+		t.Fatalf("took %v again before ackTimeout", instances(tasks))
+	}
+	if tasks, _ := q.take("a2"); !equalIDs(instances(tasks), []string{"i4"}) {
+		t.Fatalf("a2 took %v, want i4", instances(tasks))
+	}
+}
+
+func TestQueuesRedeliverAfterAckTimeout(t *testing.T) {
+	q, fake := newTestQueues()
+	q.push("a1", Task{InstanceID: "i1"})
+	q.push("a1", Task{InstanceID: "i2"})
+	q.push("a1", Task{InstanceID: "i3"})
+	first, _ := q.take("a1")
+	q.ack("a1", first[1].ID)
+
+	fake.Advance(9 * time.Second)
+	q.push("a1", Task{InstanceID: "i4"})
+	if tasks, _ := q.take("a1"); !equalIDs(instances(tasks), []string{"i4"}) {
+		t.Fatalf("took %v before ackTimeout, want only new i4", instances(tasks))
+	}
+
+	// 超时未确认的 i1、i3 按入队顺序重新下发，排在新任务之前
+	fake.Advance(time.Second)
+	q.push("a1", Task{InstanceID: "i5"})
+	tasks, _ := q.take("a1")
+	if got := instances(tasks); !equalIDs(got, []string{"i1", "i3", "i5"}) {
+		t.Fatalf("took %v, want i1 i3 i5", got)
+	}
+	if tasks[0].Attempt != 2 || tasks[0].ID != first[0].ID || tasks[2].Attempt != 1 {
+		t.Fatalf("tasks %+v, want i1 redelivered with the same ID as attempt 2", tasks)
+	}
+}
+
+func TestQueuesDuplicateAck(t *testing.T) {
+	q, fake := newTestQueues()
+	q.push("a1", Task{InstanceID: "i1"})
+	tasks, _ := q.take("a1")
+	q.ack("a1", tasks[0].ID)
+	q.ack("a1", tasks[0].ID)
+	q.ack("a1", "unknown")
+	q.ack("a2", tasks[0].ID)
+
+	fake.Advance(time.Minute)
+	if tasks, _ := q.take("a1"); len(tasks) != 0 {
+		t.Fatalf("acked task redelivered: %v", instances(tasks))
+	}
+	if got := q.drain("a1"); len(got) != 0 {
+		t.Fatalf("drained %v, want nothing after ack", instances(got))
+	}
+}
+
+func TestQueuesDrain(t *testing.T) {
+	q, _ := newTestQueues()
+	for _, id := range []string{"i1", "i2", "i3"} {
+		q.push("a1", Task{InstanceID: id})
+	}
+	taken, _ := q.take("a1")
+	q.ack("a1", taken[1].ID)
+	q.push("a1", Task{InstanceID: "i4"})
+	_, notify := q.take("a2")
+
+	// 已下发未确认的在前，未下发的在后，各自保持入队顺序
+	if got := instances(q.drain("a1")); !equalIDs(got, []string{"i1", "i3", "i4"}) {
+		t.Fatalf("drained %v, want i1 i3 i4", got)
+	}
+	if got := q.drain("a1"); got != nil {
+		t.Fatalf("drained %v twice", instances(got))
+	}
+	q.drain("a2")
+	select {
+	case <-notify:
+	default:
+		t.Fatal("drain did not wake the waiter")
+	}
+}
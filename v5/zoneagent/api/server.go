@@ -0,0 +1,393 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"code/platform/internal/clock"
+	"code/platform/internal/placement"
+	"code/platform/v5/zoneagent/metric"
+	"code/platform/v5/zoneagent/runtime"
+	"code/platform/v5/zoneagent/runtime/agent"
+	"code/platform/v5/zoneagent/runtime/plugin"
+	"code/platform/v5/zoneagent/runtime/scheduler"
+	"code/platform/v5/zoneagent/spec"
+)
+
+// Server manager 侧的 agent 接口：
+//
+//	PUT    /v1/agents/{id}          注册或更新
+//	DELETE /v1/agents/{id}          注销，其上的插件重新调度
+//	POST   /v1/agents/{id}/report   上报进程状态和采样，同时续约
+//	GET    /v1/agents/{id}/tasks    长轮询待执行的任务，?wait=30s 为最长等待时间
+//	POST   /v1/agents/{id}/tasks/{task}/ack  确认任务已执行
+//	GET    /v1/agents/{id}/assignments       分配给 agent 的全部插件
+//
+// 同时实现 scheduler.Handler，把调度结果放入对应 agent 的任务队列。
+// agent 注销或被驱逐时，未确认的任务重新交给调度器
+type Server struct {
+	runtime *runtime.Runtime
+	metrics *metric.Manager
+	// 插件实例的期望状态，调度时从中取资源需求和标签约束
+	specs  spec.Store
+	policy placement.Policy
+	// 预调度占用，选定 agent 到 agent 上报 running 之间计入，避免并发调度都落到同一个 agent
+	reservations *placement.Reservations
+	// 保证选择 agent 与登记预占之间不会插入其他选择
+	placeMu sync.Mutex
+	// agent 上报间隔，注册时告知 agent
+	interval time.Duration
+	clock    clock.Clock
+	mux      *http.ServeMux
+	queues   *queues
+}
+
+// 长轮询的最长等待时间
+const maxWait = time.Minute
+
+// NewServer specs 为空时调度请求只带 instanceID；reservations 应与 policy 使用的预占相同，为空时不记录预占；
+// interval 为 agent 上报间隔，ackTimeout 为任务下发后等待确认的时间
+func NewServer(rt *runtime.Runtime, metrics *metric.Manager, specs spec.Store, policy placement.Policy, reservations *placement.Reservations, interval time.Duration, ackTimeout time.Duration) *Server {
+	s := &Server{
+		runtime:      rt,
+		metrics:      metrics,
+		specs:        specs,
+		policy:       policy,
+		reservations: reservations,
+		interval:     interval,
+		clock:        clock.Real{},
+		mux:          http.NewServeMux(),
+		queues:       newQueues(ackTimeout),
+	}
+	s.mux.HandleFunc("PUT "+Prefix+"/agents/{id}", s.register)
+	s.mux.HandleFunc("DELETE "+Prefix+"/agents/{id}", s.unregister)
+	s.mux.HandleFunc("POST "+Prefix+"/agents/{id}/report", s.report)
+	s.mux.HandleFunc("GET "+Prefix+"/agents/{id}/tasks", s.pull)
+	s.mux.HandleFunc("POST "+Prefix+"/agents/{id}/tasks/{task}/ack", s.ack)
+	s.mux.HandleFunc("GET "+Prefix+"/agents/{id}/assignments", s.assignments)
+	rt.Agents.OnEvict(func(a agent.Agent) { s.requeue(a.AgentID()) })
+	return s
+}
+
+func (s *Server) SetClock(c clock.Clock) {
+	s.clock = c
+	s.queues.mu.Lock()
+	s.queues.clock = c
+	s.queues.mu.Unlock()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Handle 执行调度任务：start/upgrade 选择 agent 并下发启动，stop 下发给插件所在的 agent
+func (s *Server) Handle(ctx context.Context, task scheduler.ScheduleTask) error {
+	switch task.Action() {
+	case scheduler.ActionStart, scheduler.ActionUpgrade:
+		return s.start(task.InstanceID(), task.Version())
+	case scheduler.ActionStop:
+		return s.stop(task.InstanceID(), task.Version())
+	}
+	return fmt.Errorf("api: unknown action %q", task.Action())
+}
+
+func (s *Server) start(instanceID string, version string) error {
+	req := s.request(instanceID)
+	plugins := s.runtime.Plugins
+	p, err := plugins.Get(instanceID, version)
+	if errors.Is(err, plugin.ErrPluginNotFound) {
+		p, err = plugins.Create(plugin.NewPlugin(instanceID, version, req.AppID, ""))
+	}
+	if err != nil {
+		return err
+	}
+	switch p.Status() {
+	case plugin.StateScheduled, plugin.StateStarting, plugin.StateRunning:
+		return nil
+	case plugin.StatePending:
+	default:
+		if p, err = plugins.Transition(instanceID, version, plugin.StatePending, "rescheduling"); err != nil {
+			return err
+		}
+	}
+
+	if req.AppID == "" {
+		req.AppID = p.AppID()
+	}
+	target, err := s.place(req)
+	if err != nil {
+		return err
+	}
+	if err := s.assign(p, target); err != nil {
+		// 预占保留到 agent 上报 running，分配失败时立即释放
+		if s.reservations != nil {
+			s.reservations.Release(instanceID)
+		}
+		return err
+	}
+	s.enqueue(target.AgentID(), Task{InstanceID: instanceID, Version: version, Action: ActionStart})
+	return nil
+}
+
+// request 调度请求的资源需求和约束取自期望状态，没有 spec 时只按实例调度
+func (s *Server) request(instanceID string) placement.Request {
+	if s.specs != nil {
+		sp, err := s.specs.Get(instanceID)
+		if err == nil {
+			return sp.Request()
+		}
+		if !errors.Is(err, spec.ErrNotFound) {
+			log.Printf("api: get spec %s: %v", instanceID, err)
+		}
+	}
+	return placement.Request{InstanceID: instanceID}
+}
+
+// place 在存活的 agent 中选择并登记预占
+func (s *Server) place(req placement.Request) (agent.Agent, error) {
+	s.placeMu.Lock()
+	defer s.placeMu.Unlock()
+	var candidates []placement.Agent
+	alive := make(map[string]agent.Agent)
+	for _, a := range s.runtime.Agents.List() {
+		if s.runtime.Agents.Alive(a) {
+			candidates = append(candidates, a.Placement())
+			alive[a.AgentID()] = a
+		}
+	}
+	target, err := s.policy.Select(req, candidates)
+	if err != nil {
+		return agent.Agent{}, err
+	}
+	if s.reservations != nil {
+		s.reservations.Reserve(target.ID, req)
+	}
+	return alive[target.ID], nil
+}
+
+// assign 把插件登记到选定的 agent。先登记到 agent 再置为 scheduled，
+// agent 已被驱逐时插件保持 pending，由调度器重试；置状态失败时撤销登记
+func (s *Server) assign(p plugin.Plugin, target agent.Agent) error {
+	if err := s.runtime.Agents.AddPlugin(target.AgentID(), p.Key()); err != nil {
+		return err
+	}
+	if _, err := s.runtime.Plugins.Update(p.WithAgent(target.AgentID(), target.AgentIP()).WithStatus(plugin.StateScheduled, "assigned to "+target.AgentID())); err != nil {
+		s.runtime.Agents.RemovePlugin(target.AgentID(), p.Key())
+		return err
+	}
+	return nil
+}
+
+func (s *Server) stop(instanceID string, version string) error {
+	p, err := s.runtime.Plugins.Get(instanceID, version)
+	if errors.Is(err, plugin.ErrPluginNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if p.Status().Terminal() || p.Status() == plugin.StateStopping {
+		return nil
+	}
+	if p.AgentID() == "" || p.Status() == plugin.StateLost || p.Status() == plugin.StatePending {
+		// 没有进程需要停止
+		_, err := s.runtime.Plugins.Transition(instanceID, version, plugin.StateStopped, "stopped before placement")
+		return err
+	}
+	if _, err := s.runtime.Plugins.Transition(instanceID, version, plugin.StateStopping, "stop requested"); err != nil {
+		return err
+	}
+	s.enqueue(p.AgentID(), Task{InstanceID: instanceID, Version: version, Action: ActionStop})
+	return nil
+}
+
+func (s *Server) enqueue(agentID string, task Task) {
+	s.queues.push(agentID, task)
+}
+
+// requeue agent 已不可用，未确认的任务重新交给调度器。
+// 在 runtime 的驱逐回调之后执行，同一实例的 stop 会覆盖重新调度产生的 start
+func (s *Server) requeue(agentID string) {
+	for _, task := range s.queues.drain(agentID) {
+		action := scheduler.ActionStart
+		if task.Action == ActionStop {
+			action = scheduler.ActionStop
+		}
+		s.runtime.Scheduler.Push(scheduler.NewScheduleTask(task.InstanceID, task.Version, action))
+	}
+}
+
+func (s *Server) register(w http.ResponseWriter, r *http.Request) {
+	var req RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	a := agent.NewAgent(r.PathValue("id"), req.IP).WithCapacity(req.CPU, req.Memory).WithLabels(req.Labels)
+	if err := s.runtime.Agents.Register(a); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, RegisterResponse{HeartbeatIntervalMS: s.interval.Milliseconds()})
+}
+
+func (s *Server) unregister(w http.ResponseWriter, r *http.Request) {
+	agentID := r.PathValue("id")
+	if err := s.runtime.RemoveAgent(agentID); err != nil {
+		writeError(w, err)
+		return
+	}
+	s.metrics.RemoveAgent(agentID)
+	s.requeue(agentID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) report(w http.ResponseWriter, r *http.Request) {
+	agentID := r.PathValue("id")
+	var req ReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.runtime.Agents.Heartbeat(agentID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	now := s.clock.Now()
+	s.metrics.ReportAgent(agentID, now, toProcessMetric(req.Agent))
+	for _, pr := range req.Plugins {
+		key := plugin.Key(pr.InstanceID, pr.Version)
+		if pr.Status == StatusRunning {
+			s.metrics.ReportPlugin(agentID, key, now, toProcessMetric(pr.Process))
+		}
+		if err := s.applyStatus(agentID, pr); err != nil {
+			log.Printf("api: agent %s report %s: %v", agentID, key, err)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// applyStatus 把 agent 上报的进程状态同步到插件运行时
+func (s *Server) applyStatus(agentID string, pr PluginReport) error {
+	p, err := s.runtime.Plugins.Get(pr.InstanceID, pr.Version)
+	if err != nil {
+		return err
+	}
+	if p.AgentID() != agentID {
+		return fmt.Errorf("assigned to %q", p.AgentID())
+	}
+	to := plugin.State(pr.Status)
+	if to == p.Status() {
+		return nil
+	}
+	if !plugin.CanTransition(p.Status(), to) {
+		// 例如已下发停止但 agent 还在上报 running，等待下一次上报
+		return nil
+	}
+	if _, err := s.runtime.Plugins.Transition(pr.InstanceID, pr.Version, to, pr.Reason); err != nil {
+		return err
+	}
+	if s.reservations != nil {
+		switch {
+		case to == plugin.StateRunning:
+			s.reservations.Confirm(pr.InstanceID)
+		case to.Terminal() || to == plugin.StateFailed:
+			s.reservations.Release(pr.InstanceID)
+		}
+	}
+	if to.Terminal() || to == plugin.StateFailed {
+		s.runtime.Agents.RemovePlugin(agentID, p.Key())
+		s.metrics.RemovePlugin(p.Key())
+	}
+	return nil
+}
+
+func (s *Server) pull(w http.ResponseWriter, r *http.Request) {
+	agentID := r.PathValue("id")
+	if _, err := s.runtime.Agents.Get(agentID); err != nil {
+		writeError(w, err)
+		return
+	}
+	var wait time.Duration
+	if v := r.URL.Query().Get("wait"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			http.Error(w, "invalid wait", http.StatusBadRequest)
+			return
+		}
+		wait = min(d, maxWait)
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		tasks, notify := s.queues.take(agentID)
+		if len(tasks) > 0 || wait == 0 {
+			writeJSON(w, http.StatusOK, TasksResponse{Tasks: tasks})
+			return
+		}
+		select {
+		case <-notify:
+			// 队列被删除说明 agent 已注销或被驱逐
+			if _, err := s.runtime.Agents.Get(agentID); err != nil {
+				writeError(w, err)
+				return
+			}
+		case <-timer.C:
+			writeJSON(w, http.StatusOK, TasksResponse{})
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Server) ack(w http.ResponseWriter, r *http.Request) {
+	s.queues.ack(r.PathValue("id"), r.PathValue("task"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func toProcessMetric(p Process) metric.ProcessMetric {
+	return metric.NewProcessMetric(p.PID, p.CPU, p.Memory)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, agent.ErrAgentNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, agent.ErrInvalidAgent):
+		code = http.StatusBadRequest
+	}
+	http.Error(w, err.Error(), code)
+}
+
+// assignments 已调度到 agent 且未下发停止的插件
+func (s *Server) assignments(w http.ResponseWriter, r *http.Request) {
+	agentID := r.PathValue("id")
+	if _, err := s.runtime.Agents.Get(agentID); err != nil {
+		writeError(w, err)
+		return
+	}
+	resp := AssignmentsResponse{Assignments: []Assignment{}}
+	for _, p := range s.runtime.Plugins.ListByAgent(agentID) {
+		switch p.Status() {
+		case plugin.StateScheduled, plugin.StateStarting, plugin.StateRunning:
+			resp.Assignments = append(resp.Assignments, Assignment{InstanceID: p.InstanceID(), Version: p.Version()})
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
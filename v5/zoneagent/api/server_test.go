@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"code/platform/internal/placement"
+	"code/platform/v5/zoneagent/metric"
+	"code/platform/v5/zoneagent/runtime"
+	"code/platform/v5/zoneagent/runtime/agent"
+	"code/platform/v5/zoneagent/runtime/plugin"
+	"code/platform/v5/zoneagent/runtime/scheduler"
+	"code/platform/v5/zoneagent/spec"
+)
+
+func newTestServer(t *testing.T, specs spec.Store, policy placement.Policy) *Server {
+	t.Helper()
+	noop := func(ctx context.Context, task scheduler.ScheduleTask) error { return nil }
+	rt := runtime.New(nil, time.Minute, noop, 1, 0)
+	return NewServer(rt, metric.NewManager(nil, 0, time.Minute), specs, policy, nil, time.Second, time.Second)
+}
+
+// recordPolicy 记录收到的调度请求，总是选第一个 agent
+type recordPolicy struct {
+	req placement.Request
+}
+
+func (p *recordPolicy) Select(req placement.Request, agents []placement.Agent) (placement.Agent, error) {
+	p.req = req
+	if len(agents) == 0 {
+		return placement.Agent{}, placement.ErrNoAgent
+	}
+	return agents[0], nil
+}
+
+func TestAssignFailureKeepsPluginPending(t *testing.T) {
+	s := newTestServer(t, nil, placement.FewestPlugins{})
+	p, err := s.runtime.Plugins.Create(plugin.NewPlugin("i1", "v1", "", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// agent 在选定之后、登记之前被驱逐
+	if err := s.assign(p, agent.NewAgent("gone", "10.0.0.1")); err == nil {
+		t.Fatal("assign to a missing agent succeeded")
+	}
+	got, err := s.runtime.Plugins.Get("i1", "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status() != plugin.StatePending || got.AgentID() != "" {
+		t.Fatalf("plugin = %s on %q, want pending and unassigned", got.Status(), got.AgentID())
+	}
+}
+
+func TestStartBuildsRequestFromSpec(t *testing.T) {
+	specs := spec.NewMemoryStore()
+	sp := spec.Spec{
+		InstanceID: "i1",
+		AppID:      "app",
+		Version:    "v1",
+		Enabled:    true,
+		Resources:  spec.Resources{CPU: 2, Memory: 1 << 30},
+		Placement: spec.Placement{
+			Selector:  map[string]string{"zone": "west"},
+			Preferred: map[string]string{"disk": "ssd"},
+		},
+	}
+	if _, err := specs.Put(sp); err != nil {
+		t.Fatal(err)
+	}
+	policy := &recordPolicy{}
+	s := newTestServer(t, specs, policy)
+	if err := s.runtime.Agents.Register(agent.NewAgent("a1", "10.0.0.1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.start("i1", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	want := sp.Request()
+	if policy.req.InstanceID != want.InstanceID || policy.req.AppID != want.AppID ||
+		policy.req.CPU != want.CPU || policy.req.Memory != want.Memory ||
+		policy.req.Selector["zone"] != "west" || policy.req.Preferred["disk"] != "ssd" {
+		t.Fatalf("request = %+v, want %+v", policy.req, want)
+	}
+	p, err := s.runtime.Plugins.Get("i1", "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Status() != plugin.StateScheduled || p.AgentID() != "a1" || p.AppID() != "app" {
+		t.Fatalf("plugin = %s on %q app %q, want scheduled on a1 with app", p.Status(), p.AgentID(), p.AppID())
+	}
+	a, _ := s.runtime.Agents.Get("a1")
+	if !a.HasPlugin(p.Key()) {
+		t.Fatal("plugin not registered on agent a1")
+	}
+}
+
+func TestReservationHeldUntilRunning(t *testing.T) {
+	noop := func(ctx context.Context, task scheduler.ScheduleTask) error { return nil }
+	rt := runtime.New(nil, time.Minute, noop, 1, 0)
+	reservations := placement.NewReservations(time.Minute, nil)
+	s := NewServer(rt, metric.NewManager(nil, 0, time.Minute), nil, placement.FewestPlugins{Reservations: reservations}, reservations, time.Second, time.Second)
+	if err := rt.Agents.Register(agent.NewAgent("a1", "10.0.0.1")); err != nil {
+		t.Fatal(err)
+	}
+	reserved := func() int {
+		_, _, n := reservations.Reserved("a1")
+		return n
+	}
+
+	tests := []struct {
+		instanceID string
+		statuses   []plugin.State
+		want       int
+	}{
+		{"i1", nil, 1},
+		{"i2", []plugin.State{plugin.StateStarting}, 1},
+		{"i3", []plugin.State{plugin.StateStarting, plugin.StateRunning}, 0},
+		{"i4", []plugin.State{plugin.StateFailed}, 0},
+	}
+	for _, tt := range tests {
+		if err := s.start(tt.instanceID, "v1"); err != nil {
+			t.Fatal(err)
+		}
+		for _, status := range tt.statuses {
+			if err := s.applyStatus("a1", PluginReport{InstanceID: tt.instanceID, Version: "v1", Status: string(status)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := reserved(); got != tt.want {
+			t.Fatalf("%s after %v: reserved = %d, want %d", tt.instanceID, tt.statuses, got, tt.want)
+		}
+		reservations.Release(tt.instanceID)
+	}
+}
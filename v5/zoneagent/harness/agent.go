@@ -0,0 +1,171 @@
+package harness
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"code/platform/v5/zoneagent/api"
+	"code/platform/v5/zoneagent/runtime/plugin"
+)
+
+var (
+	errPaused      = errors.New("harness: agent paused")
+	errStartFailed = errors.New("harness: start failed")
+)
+
+// FakeAgent 运行真实的 node.Agent，本地进程用内存模拟：启动立即视为运行，停止立即退出。
+// 网络经过可控的 transport，用于模拟分区和确认丢失
+type FakeAgent struct {
+	ID string
+
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	running map[string]api.PluginReport // key plugin.Key
+	paused  bool
+	// 不确认任务，模拟确认丢失
+	dropAcks bool
+	// 启动插件失败，模拟本地进程拉起失败
+	failStarts bool
+	// 收到的任务，包含重复下发的
+	received []api.Task
+}
+
+func newFakeAgent(agentID string) *FakeAgent {
+	return &FakeAgent{
+		ID:      agentID,
+		running: make(map[string]api.PluginReport),
+	}
+}
+
+// Running 当前运行的插件 key，排序后返回
+func (a *FakeAgent) Running() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	keys := make([]string, 0, len(a.running))
+	for key := range a.running {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Pause 断开与 manager 的网络，模拟网络分区，manager 会在心跳租约过期后驱逐它
+func (a *FakeAgent) Pause(paused bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.paused = paused
+}
+
+// DropAcks 开启后丢弃任务确认，manager 会在确认超时后重新下发
+func (a *FakeAgent) DropAcks(drop bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.dropAcks = drop
+}
+
+// FailStarts 开启后启动插件失败，已收到的任务不会被确认
+func (a *FakeAgent) FailStarts(fail bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.failStarts = fail
+}
+
+// Received 收到的所有任务，包含重复下发的
+func (a *FakeAgent) Received() []api.Task {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]api.Task(nil), a.received...)
+}
+
+// StartLocal 绕过 manager 在本地拉起进程，模拟残留进程
+func (a *FakeAgent) StartLocal(instanceID string, version string) {
+	a.Start(context.Background(), instanceID, version)
+}
+
+// Kill 模拟 agent 进程退出，不注销
+func (a *FakeAgent) Kill() {
+	a.cancel()
+}
+
+// List 实现 node.Processes
+func (a *FakeAgent) List() []api.PluginReport {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	reports := make([]api.PluginReport, 0, len(a.running))
+	for _, pr := range a.running {
+		reports = append(reports, pr)
+	}
+	return reports
+}
+
+func (a *FakeAgent) Start(ctx context.Context, instanceID string, version string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.failStarts {
+		return errStartFailed
+	}
+	key := plugin.Key(instanceID, version)
+	a.running[key] = api.PluginReport{
+		InstanceID: instanceID,
+		Version:    version,
+		Status:     api.StatusRunning,
+		Process:    api.Process{PID: key, CPU: 0.5, Memory: 128 << 20},
+	}
+	return nil
+}
+
+func (a *FakeAgent) Stop(ctx context.Context, instanceID string, version string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.running, plugin.Key(instanceID, version))
+	return nil
+}
+
+// transport 在 agent 与 manager 之间模拟网络，并记录下发的任务
+type transport struct {
+	agent *FakeAgent
+	next  http.RoundTripper
+}
+
+func (t transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	a := t.agent
+	a.mu.Lock()
+	paused, dropAcks := a.paused, a.dropAcks
+	a.mu.Unlock()
+	if paused {
+		return nil, errPaused
+	}
+	if dropAcks && strings.HasSuffix(req.URL.Path, "/ack") {
+		return &http.Response{
+			StatusCode: http.StatusNoContent,
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK || !strings.HasSuffix(req.URL.Path, "/tasks") {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	var tasks api.TasksResponse
+	if json.Unmarshal(body, &tasks) == nil {
+		a.mu.Lock()
+		a.received = append(a.received, tasks.Tasks...)
+		a.mu.Unlock()
+	}
+	return resp, nil
+}
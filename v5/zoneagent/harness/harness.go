@@ -0,0 +1,123 @@
+// Package harness 在同一进程内启动 manager 和若干模拟 agent，经真实的 HTTP 接口交互，
+// 用于验证调度、上报和任务下发的端到端流程
+package harness
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"code/platform/v5/zoneagent/api"
+	"code/platform/v5/zoneagent/manager"
+	"code/platform/v5/zoneagent/node"
+	"code/platform/v5/zoneagent/runtime/scheduler"
+)
+
+// Config 同 manager.Config，为零值的字段使用适合测试的较短时间
+type Config = manager.Config
+
+func defaults(c *Config) {
+	if c.AgentTTL == 0 {
+		c.AgentTTL = time.Second
+	}
+	if c.ReportInterval == 0 {
+		c.ReportInterval = c.AgentTTL / 5
+	}
+	if c.Backoff == 0 {
+		c.Backoff = 50 * time.Millisecond
+	}
+	if c.MetricCapacity == 0 {
+		c.MetricCapacity = 64
+	}
+	if c.MetricRetention == 0 {
+		c.MetricRetention = time.Minute
+	}
+	if c.ReconcileInterval == 0 {
+		c.ReconcileInterval = c.ReportInterval
+	}
+	if c.ReconcileRate == 0 {
+		c.ReconcileRate = 100
+	}
+	if c.ReconcileBurst == 0 {
+		c.ReconcileBurst = 100
+	}
+}
+
+type Harness struct {
+	*manager.Manager
+	// manager 的 HTTP 地址
+	URL string
+
+	config Config
+	http   *httptest.Server
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New 启动 manager 和它的 HTTP 服务，其余未设置的配置由 manager 填充
+func New(config Config) *Harness {
+	defaults(&config)
+	h := &Harness{Manager: manager.New(config), config: config}
+	h.ctx, h.cancel = context.WithCancel(context.Background())
+	h.http = httptest.NewServer(h.Handler())
+	h.URL = h.http.URL
+	h.goRun(h.Run)
+	return h
+}
+
+// Start 推送启动任务，与 reconciler 下发的任务相同
+func (h *Harness) Start(instanceID string, version string) {
+	h.Runtime.Scheduler.Push(scheduler.NewScheduleTask(instanceID, version, scheduler.ActionStart))
+}
+
+func (h *Harness) Stop(instanceID string, version string) {
+	h.Runtime.Scheduler.Push(scheduler.NewScheduleTask(instanceID, version, scheduler.ActionStop))
+}
+
+// AddAgent 启动一个模拟 agent
+func (h *Harness) AddAgent(agentID string) *FakeAgent {
+	return h.AddLabeledAgent(agentID, nil)
+}
+
+// AddLabeledAgent 启动一个带标签的模拟 agent，用于验证标签约束
+func (h *Harness) AddLabeledAgent(agentID string, labels map[string]string) *FakeAgent {
+	a := newFakeAgent(agentID)
+	hc := h.http.Client()
+	client := api.NewClient(h.URL, &http.Client{Transport: transport{agent: a, next: hc.Transport}})
+	n := node.New(agentID, client, a, api.RegisterRequest{IP: "127.0.0.1", CPU: 4, Memory: 8 << 30, Labels: labels}, h.config.ReportInterval)
+
+	ctx, cancel := context.WithCancel(h.ctx)
+	a.cancel = cancel
+	h.goRun(func(context.Context) { n.Run(ctx) })
+	return a
+}
+
+// WaitFor 轮询 cond 直到成立或超时
+func (h *Harness) WaitFor(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return cond()
+}
+
+// Close 停止所有 agent 和 manager
+func (h *Harness) Close() {
+	h.cancel()
+	h.wg.Wait()
+	h.http.Close()
+}
+
+func (h *Harness) goRun(fn func(ctx context.Context)) {
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		fn(h.ctx)
+	}()
+}
@@ -0,0 +1,278 @@
+package harness
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"code/platform/v5/zoneagent/alert"
+	"code/platform/v5/zoneagent/runtime/plugin"
+	"code/platform/v5/zoneagent/spec"
+)
+
+const wait = 5 * time.Second
+
+func status(h *Harness, instanceID string, version string) plugin.State {
+	p, err := h.Runtime.Plugins.Get(instanceID, version)
+	if err != nil {
+		return ""
+	}
+	return p.Status()
+}
+
+func running(a *FakeAgent, key string) bool {
+	for _, k := range a.Running() {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func TestStartSpreadsAndStop(t *testing.T) {
+	h := New(Config{})
+	defer h.Close()
+	a1 := h.AddAgent("a1")
+	a2 := h.AddAgent("a2")
+	if !h.WaitFor(wait, func() bool { return len(h.Runtime.Agents.List()) == 2 }) {
+		t.Fatal("agents did not register")
+	}
+
+	for _, id := range []string{"i1", "i2", "i3", "i4"} {
+		h.Start(id, "v1")
+	}
+	if !h.WaitFor(wait, func() bool { return len(a1.Running())+len(a2.Running()) == 4 }) {
+		t.Fatalf("running a1 %v a2 %v, want 4 plugins", a1.Running(), a2.Running())
+	}
+	if len(a1.Running()) != 2 || len(a2.Running()) != 2 {
+		t.Fatalf("running a1 %v a2 %v, want 2 each", a1.Running(), a2.Running())
+	}
+	if !h.WaitFor(wait, func() bool { return status(h, "i1", "v1") == plugin.StateRunning }) {
+		t.Fatalf("i1 status = %s, want running", status(h, "i1", "v1"))
+	}
+
+	h.Stop("i1", "v1")
+	if !h.WaitFor(wait, func() bool { return status(h, "i1", "v1") == plugin.StateStopped }) {
+		t.Fatalf("i1 status = %s, want stopped", status(h, "i1", "v1"))
+	}
+	key := plugin.Key("i1", "v1")
+	if running(a1, key) || running(a2, key) {
+		t.Fatal("i1 still running after stop")
+	}
+}
+
+func TestStartUsesSpec(t *testing.T) {
+	h := New(Config{})
+	defer h.Close()
+	east := h.AddLabeledAgent("a1", map[string]string{"zone": "east"})
+	west := h.AddLabeledAgent("a2", map[string]string{"zone": "west"})
+	if !h.WaitFor(wait, func() bool { return len(h.Runtime.Agents.List()) == 2 }) {
+		t.Fatal("agents did not register")
+	}
+
+	for _, id := range []string{"i1", "i2", "i3"} {
+		_, err := h.Specs.Put(spec.Spec{
+			InstanceID: id,
+			AppID:      "app",
+			Version:    "v1",
+			Enabled:    true,
+			Resources:  spec.Resources{CPU: 1, Memory: 1 << 30},
+			Placement:  spec.Placement{Selector: map[string]string{"zone": "west"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.Start(id, "v1")
+	}
+	if !h.WaitFor(wait, func() bool { return len(west.Running()) == 3 }) {
+		t.Fatalf("running east %v west %v, want all on west", east.Running(), west.Running())
+	}
+	if len(east.Running()) != 0 {
+		t.Fatalf("selector ignored: east runs %v", east.Running())
+	}
+	p, err := h.Runtime.Plugins.Get("i1", "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.AppID() != "app" {
+		t.Fatalf("app id = %q, want app from spec", p.AppID())
+	}
+}
+
+func TestAgentLossReschedules(t *testing.T) {
+	h := New(Config{})
+	defer h.Close()
+	a1 := h.AddAgent("a1")
+	if !h.WaitFor(wait, func() bool { return len(h.Runtime.Agents.List()) == 1 }) {
+		t.Fatal("agent did not register")
+	}
+	h.Start("i1", "v1")
+	key := plugin.Key("i1", "v1")
+	if !h.WaitFor(wait, func() bool { return running(a1, key) }) {
+		t.Fatal("i1 not started on a1")
+	}
+
+	a2 := h.AddAgent("a2")
+	a1.Pause(true)
+	if !h.WaitFor(wait, func() bool { return running(a2, key) }) {
+		t.Fatalf("i1 not rescheduled to a2, status %s", status(h, "i1", "v1"))
+	}
+	if !h.WaitFor(wait, func() bool { return status(h, "i1", "v1") == plugin.StateRunning }) {
+		t.Fatalf("i1 status = %s, want running", status(h, "i1", "v1"))
+	}
+}
+
+// notifications 记录收到的告警通知
+type notifications struct {
+	mu   sync.Mutex
+	sent []alert.Notification
+}
+
+func (n *notifications) Notify(ctx context.Context, notification alert.Notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent = append(n.sent, notification)
+	return nil
+}
+
+func (n *notifications) firing(rule string, label string, value string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, sent := range n.sent {
+		for _, a := range sent.Alerts {
+			if a.Rule == rule && a.State == alert.StateFiring && a.Labels[label] == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestAgentLossAlerts(t *testing.T) {
+	sink := &notifications{}
+	h := New(Config{AlertRoutes: []alert.Route{{Name: "test", Notifier: sink}}})
+	defer h.Close()
+	a1 := h.AddAgent("a1")
+	if !h.WaitFor(wait, func() bool { return len(h.Runtime.Agents.List()) == 1 }) {
+		t.Fatal("agent did not register")
+	}
+	a1.Pause(true)
+	if !h.WaitFor(wait, func() bool { return sink.firing("AgentHeartbeatLost", "agent_id", "a1") }) {
+		t.Fatalf("no AgentHeartbeatLost notification for a1, active %+v", h.Alerts.Active())
+	}
+}
+
+func TestTaskAckedAfterApplied(t *testing.T) {
+	h := New(Config{})
+	defer h.Close()
+	a1 := h.AddAgent("a1")
+	if !h.WaitFor(wait, func() bool { return len(h.Runtime.Agents.List()) == 1 }) {
+		t.Fatal("agent did not register")
+	}
+
+	// 启动失败时任务不确认，manager 超时后重新下发
+	a1.FailStarts(true)
+	h.Start("i1", "v1")
+	redelivered := func() bool {
+		for _, task := range a1.Received() {
+			if task.InstanceID == "i1" && task.Attempt > 1 {
+				return true
+			}
+		}
+		return false
+	}
+	if !h.WaitFor(wait, redelivered) {
+		t.Fatalf("task not redelivered after a failed start, received %+v", a1.Received())
+	}
+
+	a1.FailStarts(false)
+	if !h.WaitFor(wait, func() bool { return status(h, "i1", "v1") == plugin.StateRunning }) {
+		t.Fatalf("i1 status = %s, want running", status(h, "i1", "v1"))
+	}
+}
+
+func TestReconcilerFollowsSpecs(t *testing.T) {
+	specs := spec.NewMemoryStore()
+	h := New(Config{Specs: specs, Desired: spec.Source(specs)})
+	defer h.Close()
+	a1 := h.AddAgent("a1")
+
+	sp, err := specs.Put(spec.Spec{InstanceID: "i1", Version: "v1", Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := plugin.Key("i1", "v1")
+	if !h.WaitFor(wait, func() bool { return running(a1, v1) }) {
+		t.Fatal("enabled spec not started")
+	}
+
+	sp.Version = "v2"
+	if sp, err = specs.Put(sp); err != nil {
+		t.Fatal(err)
+	}
+	v2 := plugin.Key("i1", "v2")
+	if !h.WaitFor(wait, func() bool { return running(a1, v2) && !running(a1, v1) }) {
+		t.Fatalf("upgrade not applied, running %v", a1.Running())
+	}
+
+	sp.Enabled = false
+	if _, err := specs.Put(sp); err != nil {
+		t.Fatal(err)
+	}
+	if !h.WaitFor(wait, func() bool { return len(a1.Running()) == 0 }) {
+		t.Fatalf("disabled spec still running %v", a1.Running())
+	}
+}
+
+func TestAgentJoinsAfterDeadLetter(t *testing.T) {
+	specs := spec.NewMemoryStore()
+	h := New(Config{Specs: specs, Desired: spec.Source(specs), MaxRetry: 1, Backoff: time.Millisecond})
+	defer h.Close()
+
+	if _, err := specs.Put(spec.Spec{InstanceID: "i1", Version: "v1", Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	// 没有 agent 时重试耗尽进入死信，插件不能停在 pending
+	if !h.WaitFor(wait, func() bool { return h.Runtime.Scheduler.Stats().DeadLettered > 0 }) {
+		t.Fatal("start task not dead-lettered without agents")
+	}
+	if !h.WaitFor(wait, func() bool { return status(h, "i1", "v1") != plugin.StatePending }) {
+		t.Fatal("i1 stuck in pending after dead letter")
+	}
+
+	a1 := h.AddAgent("a1")
+	if !h.WaitFor(wait, func() bool { return running(a1, plugin.Key("i1", "v1")) }) {
+		t.Fatalf("i1 not started after a1 joined, status %s", status(h, "i1", "v1"))
+	}
+	if !h.WaitFor(wait, func() bool { return status(h, "i1", "v1") == plugin.StateRunning }) {
+		t.Fatalf("i1 status = %s, want running", status(h, "i1", "v1"))
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	h := New(Config{})
+	defer h.Close()
+	h.AddAgent("a1")
+	if !h.WaitFor(wait, func() bool { return len(h.Runtime.Agents.List()) == 1 }) {
+		t.Fatal("agent did not register")
+	}
+
+	resp, err := http.Get(h.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"zoneagent_agents 1", `zoneagent_plugins{state="running"} 0`, "zoneagent_scheduler_queue_depth"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("/metrics missing %q:\n%s", want, body)
+		}
+	}
+}
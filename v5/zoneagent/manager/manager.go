@@ -0,0 +1,179 @@
+// Package manager 组装 zone manager：运行时、调度、agent 接口、期望状态对账、告警和指标，
+// 由 zonemanager 和 harness 共用
+package manager
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"code/platform/internal/placement"
+	"code/platform/internal/reconcile"
+	"code/platform/v5/lock"
+	"code/platform/v5/zoneagent/alert"
+	"code/platform/v5/zoneagent/api"
+	"code/platform/v5/zoneagent/metric"
+	"code/platform/v5/zoneagent/runtime"
+	"code/platform/v5/zoneagent/runtime/reconciler"
+	"code/platform/v5/zoneagent/runtime/scheduler"
+	"code/platform/v5/zoneagent/spec"
+)
+
+// Config 为零值的字段使用默认值
+type Config struct {
+	// 运行时的行锁，多副本共享状态时使用 lock.LeaseTable，为空时为进程内的锁
+	Locker         lock.Locker
+	AgentTTL       time.Duration
+	ReportInterval time.Duration
+	// 任务下发后等待确认的时间，超时重新下发
+	AckTimeout time.Duration
+	MaxRetry   int
+	Backoff    time.Duration
+	// 调度器的 worker 数
+	Workers int
+	// 每个 agent、插件保留的采样数和时长，为 0 时使用 metric 包的默认值
+	MetricCapacity  int
+	MetricRetention time.Duration
+	// 为空时使用按标签过滤、计入预占的 FewestPlugins
+	Policy placement.Policy
+	// 插件实例的期望状态，为空时使用内存存储
+	Specs spec.Store
+	// 期望状态，非空时启动 reconciler 定期对账，否则只能通过调度器手动下发
+	Desired           reconcile.Source
+	ReconcileInterval time.Duration
+	// reconciler 每秒和单轮最多下发的任务数
+	ReconcileRate  float64
+	ReconcileBurst int
+	// 告警规则的评估和通知发送间隔
+	AlertInterval time.Duration
+	// 为空时所有告警写到日志
+	AlertRoutes []alert.Route
+}
+
+func (c *Config) defaults() {
+	if c.AgentTTL == 0 {
+		c.AgentTTL = 30 * time.Second
+	}
+	if c.ReportInterval == 0 {
+		c.ReportInterval = c.AgentTTL / 3
+	}
+	if c.AckTimeout == 0 {
+		c.AckTimeout = 2 * c.ReportInterval
+	}
+	if c.MaxRetry == 0 {
+		c.MaxRetry = 5
+	}
+	if c.Backoff == 0 {
+		c.Backoff = time.Second
+	}
+	if c.Workers == 0 {
+		c.Workers = 2
+	}
+	if c.ReconcileInterval == 0 {
+		c.ReconcileInterval = c.AgentTTL
+	}
+	if c.ReconcileRate == 0 {
+		c.ReconcileRate = 10
+	}
+	if c.ReconcileBurst == 0 {
+		c.ReconcileBurst = 50
+	}
+	if c.AlertInterval == 0 {
+		c.AlertInterval = c.ReportInterval
+	}
+	if len(c.AlertRoutes) == 0 {
+		c.AlertRoutes = []alert.Route{{Name: "log", Notifier: &alert.Log{}}}
+	}
+}
+
+type Manager struct {
+	Runtime      *runtime.Runtime
+	Metrics      *metric.Manager
+	Reservations *placement.Reservations
+	Specs        spec.Store
+	Server       *api.Server
+	// Config.Desired 为空时为 nil
+	Reconciler *reconcile.Reconciler
+	Alerts     *alert.Engine
+	// 发送 Alerts 产生的告警
+	Notifications *alert.Dispatcher
+	// Runtime 和 Metrics 的指标，由 Handler 的 /metrics 输出
+	Registry *prometheus.Registry
+
+	config Config
+}
+
+// New 创建各组件，Run 之后才开始调度、驱逐、对账和告警
+func New(config Config) *Manager {
+	config.defaults()
+	m := &Manager{}
+
+	var server *api.Server
+	handler := func(ctx context.Context, task scheduler.ScheduleTask) error {
+		return server.Handle(ctx, task)
+	}
+	m.Runtime = runtime.New(config.Locker, config.AgentTTL, handler, config.MaxRetry, config.Backoff)
+	// 采样只保存在本进程，不需要共享锁
+	m.Metrics = metric.NewManager(nil, config.MetricCapacity, config.MetricRetention)
+	// 预占保留到 agent 上报 running，agent 在心跳过期前总会上报一次
+	m.Reservations = placement.NewReservations(config.AgentTTL, nil)
+	if config.Policy == nil {
+		config.Policy = placement.Affinity{Next: placement.FewestPlugins{Reservations: m.Reservations}}
+	}
+	if config.Specs == nil {
+		config.Specs = spec.NewMemoryStore()
+	}
+	m.Specs = config.Specs
+	server = api.NewServer(m.Runtime, m.Metrics, m.Specs, config.Policy, m.Reservations, config.ReportInterval, config.AckTimeout)
+	m.Server = server
+	if config.Desired != nil {
+		m.Reconciler = reconcile.New(config.Desired, reconciler.Plugins(m.Runtime.Plugins), reconciler.Scheduler(m.Runtime.Scheduler), config.ReconcileRate, config.ReconcileBurst)
+	}
+
+	m.Alerts = alert.NewEngine(alert.DefaultRules(m.Metrics, m.Runtime.Agents, m.Runtime.Plugins, config.AgentTTL)...)
+	m.Notifications = alert.NewDispatcher(config.MaxRetry, config.Backoff, config.AlertRoutes...)
+	m.Alerts.Subscribe(m.Notifications.Add)
+
+	m.Registry = prometheus.NewRegistry()
+	m.Runtime.RegisterMetrics(m.Registry)
+	m.Metrics.RegisterMetrics(m.Registry)
+	m.config = config
+	return m
+}
+
+// Handler agent 接口、/specs 期望状态接口和 /metrics
+func (m *Manager) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{}))
+	specs := spec.NewHandler(m.Specs)
+	mux.Handle("/specs", specs)
+	mux.Handle("/specs/", specs)
+	mux.Handle("/", m.Server)
+	return mux
+}
+
+// Run 运行调度器、agent 驱逐、预占过期、reconciler 和告警，直到 ctx 结束
+func (m *Manager) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	run := func(fn func(ctx context.Context)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(ctx)
+		}()
+	}
+	config := m.config
+	run(func(ctx context.Context) { m.Runtime.Scheduler.Run(ctx, config.Workers) })
+	run(func(ctx context.Context) { m.Runtime.Agents.Run(ctx, config.AgentTTL/4) })
+	run(func(ctx context.Context) { m.Reservations.Run(ctx, config.AgentTTL/4) })
+	if m.Reconciler != nil {
+		run(func(ctx context.Context) { m.Reconciler.Run(ctx, config.ReconcileInterval) })
+	}
+	run(func(ctx context.Context) { m.Alerts.Run(ctx, config.AlertInterval) })
+	run(func(ctx context.Context) { m.Notifications.Run(ctx, config.AlertInterval) })
+	wg.Wait()
+}
@@ -0,0 +1,57 @@
+package manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"code/platform/v5/zoneagent/api"
+)
+
+func TestHandlerRoutes(t *testing.T) {
+	m := New(Config{})
+	srv := httptest.NewServer(m.Handler())
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodPut, srv.URL+"/specs/i1", strings.NewReader(`{"version":"v1","enabled":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT /specs/i1 = %d, want 200", resp.StatusCode)
+	}
+	if _, err := m.Specs.Get("i1"); err != nil {
+		t.Fatalf("spec not stored: %v", err)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/specs", http.StatusOK},
+		{http.MethodGet, "/metrics", http.StatusOK},
+		{http.MethodGet, api.Prefix + "/agents/a1/assignments", http.StatusNotFound},
+		{http.MethodGet, "/unknown", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, srv.URL+tt.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, resp.StatusCode, tt.want)
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package metric
 
 import (
+	"sort"
+	"sync"
+	"time"
+
+	"code/platform/internal/clock"
 	"code/platform/v5/lock"
 )
 
@@ -10,12 +15,293 @@ type ProcessMetric struct {
 	memory float64
 }
 
+// NewProcessMetric cpu 为核数，memory 为字节
+func NewProcessMetric(pid string, cpu float64, memory float64) ProcessMetric {
+	return ProcessMetric{pid: pid, cpu: cpu, memory: memory}
+}
+
+func (p ProcessMetric) PID() string { return p.pid }
+
+func (p ProcessMetric) CPU() float64 { return p.cpu }
+
+func (p ProcessMetric) Memory() float64 { return p.memory }
+
 type Metric struct {
-	agentMetric ProcessMetric
-	plugins     map[string]map[string]ProcessMetric //pluginID:timestamp:ProcessMetric
+	agentMetric *series
+	plugins     map[string]*series // key pluginID
 }
 
 type Manager struct {
-	lock    lock.Table
-	metrics map[string]*Metric // key: agentID
+	// 行锁，rowID 为 agentID
+	lock lock.Locker
+	// 保护 metrics 和 pluginAgents 本身的增删
+	mu           sync.RWMutex
+	metrics      map[string]*Metric // key: agentID
+	pluginAgents map[string]string  // pluginID:agentID，插件漂移后指向新的 agent
+	// 每个序列最多保留的采样数和时长
+	capacity  int
+	retention time.Duration
+	clock     clock.Clock
+}
+
+const (
+	// 未指定容量时每个序列保留的采样数
+	defaultCapacity = 120
+	// 未指定保留时长时采样保留的时间
+	defaultRetention = time.Hour
+)
+
+// NewManager locker 为空时使用进程内行锁，capacity 不大于 0 时使用 defaultCapacity，
+// retention 不大于 0 时使用 defaultRetention
+func NewManager(locker lock.Locker, capacity int, retention time.Duration) *Manager {
+	if locker == nil {
+		locker = lock.NewTable()
+	}
+	if capacity <= 0 {
+		capacity = defaultCapacity
+	}
+	if retention <= 0 {
+		retention = defaultRetention
+	}
+	return &Manager{
+		lock:         locker,
+		metrics:      make(map[string]*Metric),
+		pluginAgents: make(map[string]string),
+		capacity:     capacity,
+		retention:    retention,
+		clock:        clock.Real{},
+	}
+}
+
+func (m *Manager) SetClock(c clock.Clock) {
+	m.clock = c
+}
+
+// ReportAgent 写入 agent 进程采样
+func (m *Manager) ReportAgent(agentID string, at time.Time, pm ProcessMetric) {
+	m.lock.LockRowForWrite(agentID)
+	defer m.lock.UnlockRowForWrite(agentID)
+
+	metric := m.getOrCreate(agentID)
+	metric.agentMetric.trim(m.cutoff())
+	metric.agentMetric.add(Sample{Timestamp: at.UnixNano(), ProcessMetric: pm})
+}
+
+// ReportPlugin 写入插件进程采样，插件从其他 agent 漂移过来时丢弃旧 agent 上的序列
+func (m *Manager) ReportPlugin(agentID string, pluginID string, at time.Time, pm ProcessMetric) {
+	// 先处理漂移再加锁，避免同时持有两个 agent 的行锁
+	m.mu.Lock()
+	prev, moved := m.pluginAgents[pluginID]
+	m.pluginAgents[pluginID] = agentID
+	m.mu.Unlock()
+	if moved && prev != agentID {
+		m.dropPlugin(prev, pluginID)
+	}
+
+	m.lock.LockRowForWrite(agentID)
+	defer m.lock.UnlockRowForWrite(agentID)
+
+	metric := m.getOrCreate(agentID)
+
+	s, ok := metric.plugins[pluginID]
+	if !ok {
+		s = newSeries(m.capacity)
+		metric.plugins[pluginID] = s
+	}
+	s.trim(m.cutoff())
+	s.add(Sample{Timestamp: at.UnixNano(), ProcessMetric: pm})
+}
+
+// RemoveAgent agent 注销或被驱逐后清理其所有序列
+func (m *Manager) RemoveAgent(agentID string) {
+	m.lock.LockRowForWrite(agentID)
+	defer m.lock.UnlockRowForWrite(agentID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	metric, ok := m.metrics[agentID]
+	if !ok {
+		return
+	}
+	for pluginID := range metric.plugins {
+		if m.pluginAgents[pluginID] == agentID {
+			delete(m.pluginAgents, pluginID)
+		}
+	}
+	delete(m.metrics, agentID)
+}
+
+// RemovePlugin 插件停止后清理其序列
+func (m *Manager) RemovePlugin(pluginID string) {
+	m.mu.Lock()
+	agentID, ok := m.pluginAgents[pluginID]
+	delete(m.pluginAgents, pluginID)
+	m.mu.Unlock()
+	if ok {
+		m.dropPlugin(agentID, pluginID)
+	}
+}
+
+func (m *Manager) LatestAgent(agentID string) (Sample, bool) {
+	var res Sample
+	ok := m.readAgent(agentID, func(s *series) bool {
+		var ok bool
+		res, ok = s.latest()
+		return ok && res.Timestamp >= m.cutoff()
+	})
+	return res, ok
+}
+
+func (m *Manager) LatestPlugin(pluginID string) (Sample, bool) {
+	var res Sample
+	ok := m.readPlugin(pluginID, func(s *series) bool {
+		var ok bool
+		res, ok = s.latest()
+		return ok && res.Timestamp >= m.cutoff()
+	})
+	return res, ok
+}
+
+// AgentRange [from, to] 内的 agent 采样
+func (m *Manager) AgentRange(agentID string, from time.Time, to time.Time) []Sample {
+	var res []Sample
+	m.readAgent(agentID, func(s *series) bool {
+		res = s.between(m.rangeStart(from), to.UnixNano())
+		return true
+	})
+	return res
+}
+
+// PluginRange [from, to] 内的插件采样
+func (m *Manager) PluginRange(pluginID string, from time.Time, to time.Time) []Sample {
+	var res []Sample
+	m.readPlugin(pluginID, func(s *series) bool {
+		res = s.between(m.rangeStart(from), to.UnixNano())
+		return true
+	})
+	return res
+}
+
+// AgentAggregate [from, to] 内 agent 的 avg/max/p95，没有采样时返回 false
+func (m *Manager) AgentAggregate(agentID string, from time.Time, to time.Time) (Aggregate, bool) {
+	samples := m.AgentRange(agentID, from, to)
+	return aggregate(samples), len(samples) > 0
+}
+
+// PluginAggregate [from, to] 内插件的 avg/max/p95，没有采样时返回 false
+func (m *Manager) PluginAggregate(pluginID string, from time.Time, to time.Time) (Aggregate, bool) {
+	samples := m.PluginRange(pluginID, from, to)
+	return aggregate(samples), len(samples) > 0
+}
+
+// AgentUsage agent 最近一次采样的使用量，供调度按负载选择 agent
+func (m *Manager) AgentUsage(agentID string) (float64, float64, bool) {
+	sample, ok := m.LatestAgent(agentID)
+	return sample.cpu, sample.memory, ok
+}
+
+// Agents 有采样的 agent
+func (m *Manager) Agents() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ids := make([]string, 0, len(m.metrics))
+	for id := range m.metrics {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Plugins agent 上有采样的插件
+func (m *Manager) Plugins(agentID string) []string {
+	m.lock.LockRowForRead(agentID)
+	defer m.lock.UnlockRowForRead(agentID)
+
+	m.mu.RLock()
+	metric, ok := m.metrics[agentID]
+	m.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	ids := make([]string, 0, len(metric.plugins))
+	for id := range metric.plugins {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// getOrCreate 调用方需持有 agentID 的写锁
+func (m *Manager) getOrCreate(agentID string) *Metric {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	metric, ok := m.metrics[agentID]
+	if !ok {
+		metric = &Metric{
+			agentMetric: newSeries(m.capacity),
+			plugins:     make(map[string]*series),
+		}
+		m.metrics[agentID] = metric
+	}
+	return metric
+}
+
+func (m *Manager) dropPlugin(agentID string, pluginID string) {
+	m.lock.LockRowForWrite(agentID)
+	defer m.lock.UnlockRowForWrite(agentID)
+
+	m.mu.RLock()
+	metric, ok := m.metrics[agentID]
+	m.mu.RUnlock()
+	if ok {
+		delete(metric.plugins, pluginID)
+	}
+}
+
+func (m *Manager) readAgent(agentID string, fn func(s *series) bool) bool {
+	m.lock.LockRowForRead(agentID)
+	defer m.lock.UnlockRowForRead(agentID)
+
+	m.mu.RLock()
+	metric, ok := m.metrics[agentID]
+	m.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	return fn(metric.agentMetric)
+}
+
+func (m *Manager) readPlugin(pluginID string, fn func(s *series) bool) bool {
+	m.mu.RLock()
+	agentID, ok := m.pluginAgents[pluginID]
+	m.mu.RUnlock()
+	if !ok {
+		return false
+	}
+
+	m.lock.LockRowForRead(agentID)
+	defer m.lock.UnlockRowForRead(agentID)
+	m.mu.RLock()
+	metric, ok := m.metrics[agentID]
+	m.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	s, ok := metric.plugins[pluginID]
+	if !ok {
+		return false
+	}
+	return fn(s)
+}
+
+// cutoff 超过保留时长的采样视为过期
+func (m *Manager) cutoff() int64 {
+	return m.clock.Now().Add(-m.retention).UnixNano()
+}
+
+func (m *Manager) rangeStart(from time.Time) int64 {
+	if start := from.UnixNano(); start > m.cutoff() {
+		return start
+	}
+	return m.cutoff()
 }
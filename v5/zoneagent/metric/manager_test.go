@@ -0,0 +1,93 @@
+package metric
+
+import (
+	"testing"
+	"time"
+
+	"code/platform/internal/clock"
+)
+
+func TestManagerDefaultsCapacity(t *testing.T) {
+	for _, capacity := range []int{0, -1} {
+		m := NewManager(nil, capacity, time.Hour)
+		m.ReportAgent("a1", time.Now(), NewProcessMetric("1", 1, 1))
+		if _, ok := m.LatestAgent("a1"); !ok {
+			t.Fatalf("capacity %d: sample not stored", capacity)
+		}
+	}
+}
+
+func TestManagerDefaultsRetention(t *testing.T) {
+	start := time.Unix(1000, 0)
+	for _, retention := range []time.Duration{0, -time.Second} {
+		fake := clock.NewFake(start)
+		m := NewManager(nil, 0, retention)
+		m.SetClock(fake)
+		m.ReportAgent("a1", start, NewProcessMetric("1", 1, 1))
+		m.ReportPlugin("a1", "p1", start, NewProcessMetric("2", 1, 1))
+		fake.Advance(time.Minute)
+		if _, ok := m.LatestAgent("a1"); !ok {
+			t.Fatalf("retention %s: agent sample dropped", retention)
+		}
+		if _, ok := m.LatestPlugin("p1"); !ok {
+			t.Fatalf("retention %s: plugin sample dropped", retention)
+		}
+		fake.Advance(defaultRetention)
+		if _, ok := m.LatestPlugin("p1"); ok {
+			t.Fatalf("retention %s: sample kept past the default retention", retention)
+		}
+	}
+}
+
+func TestManagerRetention(t *testing.T) {
+	start := time.Unix(1000, 0)
+	fake := clock.NewFake(start)
+	m := NewManager(nil, 10, 30*time.Second)
+	m.SetClock(fake)
+
+	for i := 0; i < 6; i++ {
+		at := start.Add(time.Duration(i) * 10 * time.Second)
+		fake.Set(at)
+		m.ReportPlugin("a1", "p1", at, NewProcessMetric("1", float64(i), 0))
+	}
+	// 当前 50s，保留 30s：20s 之后的采样
+	samples := m.PluginRange("p1", start, fake.Now())
+	if len(samples) != 4 || samples[0].CPU() != 2 {
+		t.Fatalf("retained %d samples starting at cpu %v, want 4 from 2", len(samples), samples[0].CPU())
+	}
+
+	fake.Advance(time.Minute)
+	if _, ok := m.LatestPlugin("p1"); ok {
+		t.Fatal("latest sample older than retention still returned")
+	}
+	if agg, ok := m.PluginAggregate("p1", start, fake.Now()); ok {
+		t.Fatalf("aggregate over expired samples = %+v", agg)
+	}
+}
+
+func TestManagerCapacityWrap(t *testing.T) {
+	start := time.Unix(1000, 0)
+	fake := clock.NewFake(start)
+	m := NewManager(nil, 3, time.Hour)
+	m.SetClock(fake)
+	for i := 0; i < 5; i++ {
+		m.ReportAgent("a1", start.Add(time.Duration(i)*time.Second), NewProcessMetric("1", float64(i), 0))
+	}
+	agg, ok := m.AgentAggregate("a1", start, start.Add(time.Minute))
+	if !ok || agg.Count != 3 || agg.CPU.Max != 4 || agg.CPU.Avg != 3 {
+		t.Fatalf("aggregate = %+v", agg)
+	}
+}
+
+func TestManagerPluginMoves(t *testing.T) {
+	m := NewManager(nil, 10, time.Hour)
+	now := time.Now()
+	m.ReportPlugin("a1", "p1", now, NewProcessMetric("1", 1, 0))
+	m.ReportPlugin("a2", "p1", now, NewProcessMetric("2", 2, 0))
+	if got := m.Plugins("a1"); len(got) != 0 {
+		t.Fatalf("a1 still has %v after p1 moved", got)
+	}
+	if s, _ := m.LatestPlugin("p1"); s.PID() != "2" {
+		t.Fatalf("latest p1 pid = %s, want 2", s.PID())
+	}
+}
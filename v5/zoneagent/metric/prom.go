@@ -0,0 +1,45 @@
+package metric
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"code/platform/internal/metrics"
+)
+
+// RegisterMetrics 注册 agent 和插件最近一次采样的 cpu/memory
+func (m *Manager) RegisterMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(metrics.NewGaugeFunc("zoneagent_agent_cpu", "Latest agent process CPU usage in cores.", []string{"agent_id"}, func(emit metrics.Emit) {
+		for _, agentID := range m.Agents() {
+			if s, ok := m.LatestAgent(agentID); ok {
+				emit(s.cpu, agentID)
+			}
+		}
+	}))
+	reg.MustRegister(metrics.NewGaugeFunc("zoneagent_agent_memory_bytes", "Latest agent process memory usage.", []string{"agent_id"}, func(emit metrics.Emit) {
+		for _, agentID := range m.Agents() {
+			if s, ok := m.LatestAgent(agentID); ok {
+				emit(s.memory, agentID)
+			}
+		}
+	}))
+	reg.MustRegister(metrics.NewGaugeFunc("zoneagent_plugin_cpu", "Latest plugin process CPU usage in cores.", []string{"agent_id", "plugin_id"}, func(emit metrics.Emit) {
+		m.rangePluginSamples(func(agentID string, pluginID string, s Sample) {
+			emit(s.cpu, agentID, pluginID)
+		})
+	}))
+	reg.MustRegister(metrics.NewGaugeFunc("zoneagent_plugin_memory_bytes", "Latest plugin process memory usage.", []string{"agent_id", "plugin_id"}, func(emit metrics.Emit) {
+		m.rangePluginSamples(func(agentID string, pluginID string, s Sample) {
+			emit(s.memory, agentID, pluginID)
+		})
+	}))
+}
+
+func (m *Manager) rangePluginSamples(fn func(agentID string, pluginID string, s Sample)) {
+	for _, agentID := range m.Agents() {
+		for _, pluginID := range m.Plugins(agentID) {
+			if s, ok := m.LatestPlugin(pluginID); ok {
+				fn(agentID, pluginID, s)
+			}
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package metric
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRegisterMetrics(t *testing.T) {
+	m := NewManager(nil, 0, time.Hour)
+	now := time.Now()
+	m.ReportAgent("a1", now, NewProcessMetric("1", 0.5, 1024))
+	m.ReportPlugin("a1", "p1", now, NewProcessMetric("2", 0.25, 512))
+
+	reg := prometheus.NewRegistry()
+	m.RegisterMetrics(reg)
+	want := `
+# HELP zoneagent_agent_cpu Latest agent process CPU usage in cores.
+# TYPE zoneagent_agent_cpu gauge
+zoneagent_agent_cpu{agent_id="a1"} 0.5
+# HELP zoneagent_plugin_memory_bytes Latest plugin process memory usage.
+# TYPE zoneagent_plugin_memory_bytes gauge
+zoneagent_plugin_memory_bytes{agent_id="a1",plugin_id="p1"} 512
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "zoneagent_agent_cpu", "zoneagent_plugin_memory_bytes"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,121 @@
+package metric
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Sample 某一时刻的进程采样
+type Sample struct {
+	Timestamp int64 // unix 纳秒
+	ProcessMetric
+}
+
+func (s Sample) Time() time.Time { return time.Unix(0, s.Timestamp) }
+
+// series 固定容量的环形缓冲，写满后覆盖最旧的采样
+type series struct {
+	samples []Sample
+	head    int // 最旧采样的位置
+	size    int
+}
+
+func newSeries(capacity int) *series {
+	return &series{samples: make([]Sample, capacity)}
+}
+
+// add 乱序到达的旧采样直接丢弃，保证缓冲内按时间递增
+func (s *series) add(sample Sample) bool {
+	if latest, ok := s.latest(); ok && sample.Timestamp < latest.Timestamp {
+		return false
+	}
+	idx := (s.head + s.size) % len(s.samples)
+	s.samples[idx] = sample
+	if s.size < len(s.samples) {
+		s.size++
+	} else {
+		s.head = (s.head + 1) % len(s.samples)
+	}
+	return true
+}
+
+func (s *series) at(i int) Sample {
+	return s.samples[(s.head+i)%len(s.samples)]
+}
+
+func (s *series) latest() (Sample, bool) {
+	if s.size == 0 {
+		return Sample{}, false
+	}
+	return s.at(s.size - 1), true
+}
+
+// trim 丢弃 cutoff 之前的采样
+func (s *series) trim(cutoff int64) {
+	for s.size > 0 && s.at(0).Timestamp < cutoff {
+		s.head = (s.head + 1) % len(s.samples)
+		s.size--
+	}
+}
+
+// between 返回 [from, to] 内的采样，按时间递增
+func (s *series) between(from int64, to int64) []Sample {
+	var samples []Sample
+	for i := 0; i < s.size; i++ {
+		sample := s.at(i)
+		if sample.Timestamp < from {
+			continue
+		}
+		if sample.Timestamp > to {
+			break
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+// Stats 一组采样的统计值
+type Stats struct {
+	Avg float64
+	Max float64
+	P95 float64
+}
+
+type Aggregate struct {
+	Count  int
+	CPU    Stats
+	Memory Stats
+}
+
+func aggregate(samples []Sample) Aggregate {
+	cpu := make([]float64, len(samples))
+	memory := make([]float64, len(samples))
+	for i, s := range samples {
+		cpu[i] = s.cpu
+		memory[i] = s.memory
+	}
+	return Aggregate{
+		Count:  len(samples),
+		CPU:    stats(cpu),
+		Memory: stats(memory),
+	}
+}
+
+func stats(values []float64) Stats {
+	if len(values) == 0 {
+		return Stats{}
+	}
+	sort.Float64s(values)
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	// nearest-rank 百分位
+	rank := int(math.Ceil(0.95*float64(len(values)))) - 1
+	return Stats{
+		Avg: sum / float64(len(values)),
+		Max: values[len(values)-1],
+		P95: values[rank],
+	}
+}
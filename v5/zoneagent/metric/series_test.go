@@ -0,0 +1,90 @@
+package metric
+
+import (
+	"testing"
+)
+
+func timestamps(samples []Sample) []int64 {
+	ts := make([]int64, len(samples))
+	for i, s := range samples {
+		ts[i] = s.Timestamp
+	}
+	return ts
+}
+
+func equal(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSeriesWrap(t *testing.T) {
+	s := newSeries(3)
+	for ts := int64(1); ts <= 5; ts++ {
+		if !s.add(Sample{Timestamp: ts}) {
+			t.Fatalf("add %d rejected", ts)
+		}
+	}
+	if got := timestamps(s.between(0, 100)); !equal(got, []int64{3, 4, 5}) {
+		t.Fatalf("after wrap = %v, want [3 4 5]", got)
+	}
+	if latest, _ := s.latest(); latest.Timestamp != 5 {
+		t.Fatalf("latest = %d", latest.Timestamp)
+	}
+	if got := timestamps(s.between(4, 4)); !equal(got, []int64{4}) {
+		t.Fatalf("between(4, 4) = %v", got)
+	}
+}
+
+func TestSeriesDropsOutOfOrder(t *testing.T) {
+	s := newSeries(4)
+	s.add(Sample{Timestamp: 10})
+	if s.add(Sample{Timestamp: 5}) {
+		t.Fatal("older sample accepted")
+	}
+	s.add(Sample{Timestamp: 10})
+	if got := timestamps(s.between(0, 100)); !equal(got, []int64{10, 10}) {
+		t.Fatalf("samples = %v", got)
+	}
+}
+
+func TestSeriesTrim(t *testing.T) {
+	s := newSeries(3)
+	for ts := int64(1); ts <= 5; ts++ {
+		s.add(Sample{Timestamp: ts})
+	}
+	s.trim(5)
+	if got := timestamps(s.between(0, 100)); !equal(got, []int64{5}) {
+		t.Fatalf("after trim = %v, want [5]", got)
+	}
+	s.trim(6)
+	if _, ok := s.latest(); ok {
+		t.Fatal("series not empty after trimming everything")
+	}
+	// 清空后继续写入，位置仍然正确
+	s.add(Sample{Timestamp: 7})
+	s.add(Sample{Timestamp: 8})
+	if got := timestamps(s.between(0, 100)); !equal(got, []int64{7, 8}) {
+		t.Fatalf("after refill = %v", got)
+	}
+}
+
+func TestStats(t *testing.T) {
+	values := make([]float64, 20)
+	for i := range values {
+		values[i] = float64(20 - i)
+	}
+	got := stats(values)
+	if got.Avg != 10.5 || got.Max != 20 || got.P95 != 19 {
+		t.Fatalf("stats = %+v", got)
+	}
+	if got := stats(nil); got != (Stats{}) {
+		t.Fatalf("empty stats = %+v", got)
+	}
+}
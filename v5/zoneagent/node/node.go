@@ -0,0 +1,263 @@
+// Package node zone agent 侧的主循环：注册、上报，并以 manager 下发的分配集合为准
+// 对比本地进程，自行启动缺少的插件、停止多余的插件
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"code/platform/v5/zoneagent/api"
+	"code/platform/v5/zoneagent/runtime/plugin"
+)
+
+// Processes 本地插件进程，Start/Stop 需要幂等
+type Processes interface {
+	// List 本地插件进程的当前状态和采样
+	List() []api.PluginReport
+	Start(ctx context.Context, instanceID string, version string) error
+	Stop(ctx context.Context, instanceID string, version string) error
+}
+
+// Result 一次对比的结果，元素为 plugin.Key
+type Result struct {
+	Started []string
+	Stopped []string
+}
+
+type Agent struct {
+	id       string
+	client   *api.Client
+	procs    Processes
+	register api.RegisterRequest
+	// 注册时 manager 未指定上报间隔时使用
+	interval time.Duration
+	// 采样 agent 自身进程，为空时只上报 pid
+	self func() api.Process
+
+	mu sync.Mutex
+	// 已停止、尚未上报的插件
+	stopped []api.PluginReport
+	// 已收到、尚未确认的任务，key 为 task.ID
+	tasks map[string]api.Task
+}
+
+// New interval 为默认上报间隔，manager 在注册响应中指定时以 manager 为准
+func New(agentID string, client *api.Client, procs Processes, register api.RegisterRequest, interval time.Duration) *Agent {
+	return &Agent{
+		id:       agentID,
+		client:   client,
+		procs:    procs,
+		register: register,
+		interval: interval,
+		tasks:    make(map[string]api.Task),
+	}
+}
+
+// SetSelfMetric 设置 agent 自身进程的采样函数
+func (a *Agent) SetSelfMetric(fn func() api.Process) {
+	a.self = fn
+}
+
+// Reconcile 拉取分配集合并与本地进程对比，缺少的启动，多余的停止。
+// 拉取前已收到的任务在对比后确认；启动或停止失败的插件的任务不确认，由 manager 超时后重新下发
+func (a *Agent) Reconcile(ctx context.Context) (Result, error) {
+	a.mu.Lock()
+	tasks := make([]api.Task, 0, len(a.tasks))
+	for _, task := range a.tasks {
+		tasks = append(tasks, task)
+	}
+	a.mu.Unlock()
+
+	assignments, err := a.client.Assignments(ctx, a.id)
+	if err != nil {
+		return Result{}, err
+	}
+	desired := make(map[string]api.Assignment, len(assignments))
+	for _, as := range assignments {
+		desired[plugin.Key(as.InstanceID, as.Version)] = as
+	}
+	local := make(map[string]api.PluginReport)
+	for _, pr := range a.procs.List() {
+		local[plugin.Key(pr.InstanceID, pr.Version)] = pr
+	}
+
+	var res Result
+	var errs []error
+	failed := make(map[string]bool)
+	for _, key := range sortedKeys(local) {
+		if _, ok := desired[key]; ok {
+			continue
+		}
+		pr := local[key]
+		if err := a.procs.Stop(ctx, pr.InstanceID, pr.Version); err != nil {
+			errs = append(errs, fmt.Errorf("stop %s: %w", key, err))
+			failed[key] = true
+			continue
+		}
+		res.Stopped = append(res.Stopped, key)
+		a.mu.Lock()
+		a.stopped = append(a.stopped, api.PluginReport{
+			InstanceID: pr.InstanceID,
+			Version:    pr.Version,
+			Status:     api.StatusStopped,
+			Reason:     "not assigned",
+		})
+		a.mu.Unlock()
+	}
+	for _, key := range sortedKeys(desired) {
+		if _, ok := local[key]; ok {
+			continue
+		}
+		as := desired[key]
+		if err := a.procs.Start(ctx, as.InstanceID, as.Version); err != nil {
+			errs = append(errs, fmt.Errorf("start %s: %w", key, err))
+			failed[key] = true
+			continue
+		}
+		res.Started = append(res.Started, key)
+	}
+	for _, task := range tasks {
+		if failed[plugin.Key(task.InstanceID, task.Version)] {
+			continue
+		}
+		if err := a.client.Ack(ctx, a.id, task.ID); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("node %s: ack %s: %v", a.id, task.ID, err)
+			}
+			continue
+		}
+		a.mu.Lock()
+		delete(a.tasks, task.ID)
+		a.mu.Unlock()
+	}
+	return res, errors.Join(errs...)
+}
+
+// Report 上报本地进程的当前状态
+func (a *Agent) Report(ctx context.Context) error {
+	req := api.ReportRequest{Plugins: a.procs.List()}
+	if a.self != nil {
+		req.Agent = a.self()
+	}
+	a.mu.Lock()
+	stopped := a.stopped
+	a.stopped = nil
+	a.mu.Unlock()
+	req.Plugins = append(req.Plugins, stopped...)
+
+	err := a.client.Report(ctx, a.id, req)
+	if err != nil {
+		// 下次上报时重试
+		a.mu.Lock()
+		a.stopped = append(stopped, a.stopped...)
+		a.mu.Unlock()
+	}
+	return err
+}
+
+// Run 注册后循环对比和上报，收到任务时立即对比一次；被 manager 驱逐后重新注册。阻塞直到 ctx 结束
+func (a *Agent) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		resp, err := a.client.Register(ctx, a.id, a.register)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("node %s: register: %v", a.id, err)
+			}
+			sleep(ctx, a.interval)
+			continue
+		}
+		interval := a.interval
+		if resp.HeartbeatIntervalMS > 0 {
+			interval = time.Duration(resp.HeartbeatIntervalMS) * time.Millisecond
+		}
+		a.session(ctx, interval)
+	}
+}
+
+// session 一次注册的生命周期，manager 返回未注册时结束
+func (a *Agent) session(ctx context.Context, interval time.Duration) {
+	// 上一次注册的任务队列已被 manager 丢弃
+	a.mu.Lock()
+	a.tasks = make(map[string]api.Task)
+	a.mu.Unlock()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	trigger := make(chan struct{}, 1)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		a.pullTasks(ctx, interval, trigger, cancel)
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := a.Reconcile(ctx); err != nil {
+			if errors.Is(err, api.ErrNotRegistered) {
+				return
+			}
+			if ctx.Err() == nil {
+				log.Printf("node %s: reconcile: %v", a.id, err)
+			}
+		}
+		if err := a.Report(ctx); errors.Is(err, api.ErrNotRegistered) {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-trigger:
+		}
+	}
+}
+
+// pullTasks 长轮询任务。分配集合已经包含任务的结果，任务只用于触发立即对比，由 Reconcile 在对比后确认
+func (a *Agent) pullTasks(ctx context.Context, interval time.Duration, trigger chan<- struct{}, stop context.CancelFunc) {
+	for ctx.Err() == nil {
+		tasks, err := a.client.Tasks(ctx, a.id, 5*interval)
+		if errors.Is(err, api.ErrNotRegistered) {
+			stop()
+			return
+		}
+		if err != nil {
+			sleep(ctx, interval)
+			continue
+		}
+		if len(tasks) == 0 {
+			continue
+		}
+		a.mu.Lock()
+		for _, task := range tasks {
+			a.tasks[task.ID] = task
+		}
+		a.mu.Unlock()
+		select {
+		case trigger <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
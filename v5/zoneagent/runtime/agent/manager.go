@@ -1,27 +1,330 @@
 package agent
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"code/platform/internal/clock"
+	"code/platform/internal/placement"
 	"code/platform/v5/lock"
 )
 
+var (
+	ErrInvalidAgent   = errors.New("agent: invalid agent")
+	ErrAgentNotFound  = errors.New("agent: agent not found")
+	ErrPluginExists   = errors.New("agent: plugin already assigned")
+	ErrPluginNotFound = errors.New("agent: plugin not assigned")
+)
+
 type Agent struct {
 	agentID      string
 	agentIP      string
 	agentPlugins map[string]struct{}
+	// 容量，cpu 为核数，memory 为字节
+	cpu    float64
+	memory float64
+	labels map[string]string
+	// 最近一次心跳，unix 纳秒
+	lastHeartbeat int64
+}
+
+func NewAgent(agentID string, agentIP string) Agent {
+	return Agent{
+		agentID: agentID,
+		agentIP: agentIP,
+	}
+}
+
+// WithCapacity 设置 agent 容量
+func (a Agent) WithCapacity(cpu float64, memory float64) Agent {
+	a.cpu = cpu
+	a.memory = memory
+	return a
+}
+
+// WithLabels 设置 agent 标签，用于亲和性调度
+func (a Agent) WithLabels(labels map[string]string) Agent {
+	a.labels = make(map[string]string, len(labels))
+	for k, v := range labels {
+		a.labels[k] = v
+	}
+	return a
+}
+
+func (a Agent) AgentID() string { return a.agentID }
+
+func (a Agent) AgentIP() string { return a.agentIP }
+
+func (a Agent) CPU() float64 { return a.cpu }
+
+func (a Agent) Memory() float64 { return a.memory }
+
+func (a Agent) Label(key string) (string, bool) {
+	v, ok := a.labels[key]
+	return v, ok
 }
 
+// Placement 转为调度策略使用的候选 agent
+func (a Agent) Placement() placement.Agent {
+	return placement.Agent{ID: a.agentID, Plugins: len(a.agentPlugins), CPU: a.cpu, Memory: a.memory, Labels: a.labels}
+}
+
+// Plugins 返回已分配到该 agent 的插件，按 ID 排序
+func (a Agent) Plugins() []string {
+	plugins := make([]string, 0, len(a.agentPlugins))
+	for plugin := range a.agentPlugins {
+		plugins = append(plugins, plugin)
+	}
+	sort.Strings(plugins)
+	return plugins
+}
+
+func (a Agent) LastHeartbeat() time.Time { return time.Unix(0, a.lastHeartbeat) }
+
+func (a Agent) PluginCount() int { return len(a.agentPlugins) }
+
+func (a Agent) HasPlugin(plugin string) bool {
+	_, ok := a.agentPlugins[plugin]
+	return ok
+}
+
+// clone 返回副本，避免调用方持有内部 map
+func (a *Agent) clone() Agent {
+	c := *a
+	c.agentPlugins = make(map[string]struct{}, len(a.agentPlugins))
+	for plugin := range a.agentPlugins {
+		c.agentPlugins[plugin] = struct{}{}
+	}
+	c.labels = make(map[string]string, len(a.labels))
+	for k, v := range a.labels {
+		c.labels[k] = v
+	}
+	return c
+}
+
+// EvictFunc agent 心跳超时被驱逐后回调，agent 为驱逐前的快照
+type EvictFunc func(agent Agent)
+
 type Manager struct {
-	lock   lock.Table
-	Agents map[string]Agent
+	// 行锁，rowID 为 agentID，保护单个 agent 记录
+	lock lock.Locker
+	// 保护 agents 本身的增删
+	mu     sync.RWMutex
+	agents map[string]*Agent // key agentID
+	// 心跳租约时长，超过未续约的 agent 被驱逐
+	ttl   time.Duration
+	clock clock.Clock
+
+	hooksMu sync.RWMutex
+	hooks   []EvictFunc
+}
+
+// NewManager locker 为空时使用进程内行锁
+func NewManager(locker lock.Locker, ttl time.Duration) *Manager {
+	if locker == nil {
+		locker = lock.NewTable()
+	}
+	return &Manager{
+		lock:   locker,
+		agents: make(map[string]*Agent),
+		ttl:    ttl,
+		clock:  clock.Real{},
+	}
+}
+
+func (m *Manager) SetClock(c clock.Clock) {
+	m.clock = c
 }
 
-func (*Manager) Register(agent Agent) {}
+// OnEvict 注册驱逐回调，按注册顺序执行
+func (m *Manager) OnEvict(hook EvictFunc) {
+	m.hooksMu.Lock()
+	defer m.hooksMu.Unlock()
+	m.hooks = append(m.hooks, hook)
+}
+
+// Register 注册 agent 并开始心跳租约，重复注册时更新 agentIP、容量和标签并续约，保留已分配的插件
+func (m *Manager) Register(agent Agent) error {
+	if agent.agentID == "" {
+		return ErrInvalidAgent
+	}
+	m.lock.LockRowForWrite(agent.agentID)
+	defer m.lock.UnlockRowForWrite(agent.agentID)
+
+	now := m.clock.Now().UnixNano()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if a, ok := m.agents[agent.agentID]; ok {
+		a.agentIP = agent.agentIP
+		a.cpu = agent.cpu
+		a.memory = agent.memory
+		a.labels = agent.clone().labels
+		a.lastHeartbeat = now
+		return nil
+	}
+	a := agent.clone()
+	a.lastHeartbeat = now
+	m.agents[agent.agentID] = &a
+	return nil
+}
+
+// Heartbeat 续约，已被驱逐的 agent 需要重新注册
+func (m *Manager) Heartbeat(agentID string) error {
+	m.lock.LockRowForWrite(agentID)
+	defer m.lock.UnlockRowForWrite(agentID)
+
+	a, ok := m.load(agentID)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAgentNotFound, agentID)
+	}
+	a.lastHeartbeat = m.clock.Now().UnixNano()
+	return nil
+}
+
+// Alive agent 的租约是否仍然有效
+func (m *Manager) Alive(agent Agent) bool {
+	return m.clock.Now().UnixNano()-agent.lastHeartbeat <= int64(m.ttl)
+}
+
+// UnRegister 注销 agent，返回注销前分配给它的插件
+func (m *Manager) UnRegister(agentID string) ([]string, error) {
+	m.lock.LockRowForWrite(agentID)
+	defer m.lock.UnlockRowForWrite(agentID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.agents[agentID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAgentNotFound, agentID)
+	}
+	delete(m.agents, agentID)
+	return a.Plugins(), nil
+}
 
-func (*Manager) UnRegister(agentID string) {}
+func (m *Manager) Get(agentID string) (Agent, error) {
+	m.lock.LockRowForRead(agentID)
+	defer m.lock.UnlockRowForRead(agentID)
 
-func (*Manager) AddPlugin(agentID string, plugin string) error {
-	panic("implement me")
+	a, ok := m.load(agentID)
+	if !ok {
+		return Agent{}, fmt.Errorf("%w: %s", ErrAgentNotFound, agentID)
+	}
+	return a.clone(), nil
 }
-func (*Manager) RemovePlugin(agentID string, plugin string) error {
-	panic("implement me")
+
+// List 返回所有 agent 的快照，按 agentID 排序
+func (m *Manager) List() []Agent {
+	m.mu.RLock()
+	ids := make([]string, 0, len(m.agents))
+	for id := range m.agents {
+		ids = append(ids, id)
+	}
+	m.mu.RUnlock()
+	sort.Strings(ids)
+
+	agents := make([]Agent, 0, len(ids))
+	for _, id := range ids {
+		if a, err := m.Get(id); err == nil {
+			agents = append(agents, a)
+		}
+	}
+	return agents
+}
+
+func (m *Manager) AddPlugin(agentID string, plugin string) error {
+	m.lock.LockRowForWrite(agentID)
+	defer m.lock.UnlockRowForWrite(agentID)
+
+	a, ok := m.load(agentID)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAgentNotFound, agentID)
+	}
+	if _, ok := a.agentPlugins[plugin]; ok {
+		return fmt.Errorf("%w: %s on %s", ErrPluginExists, plugin, agentID)
+	}
+	a.agentPlugins[plugin] = struct{}{}
+	return nil
+}
+
+func (m *Manager) RemovePlugin(agentID string, plugin string) error {
+	m.lock.LockRowForWrite(agentID)
+	defer m.lock.UnlockRowForWrite(agentID)
+
+	a, ok := m.load(agentID)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAgentNotFound, agentID)
+	}
+	if _, ok := a.agentPlugins[plugin]; !ok {
+		return fmt.Errorf("%w: %s on %s", ErrPluginNotFound, plugin, agentID)
+	}
+	delete(a.agentPlugins, plugin)
+	return nil
+}
+
+// load 调用方需持有 agentID 的行锁
+func (m *Manager) load(agentID string) (*Agent, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	a, ok := m.agents[agentID]
+	return a, ok
+}
+
+// Sweep 驱逐所有租约过期的 agent，返回被驱逐的 agent
+func (m *Manager) Sweep() []Agent {
+	m.mu.RLock()
+	ids := make([]string, 0, len(m.agents))
+	for id := range m.agents {
+		ids = append(ids, id)
+	}
+	m.mu.RUnlock()
+	sort.Strings(ids)
+
+	var evicted []Agent
+	for _, id := range ids {
+		if a, ok := m.evictIfExpired(id); ok {
+			evicted = append(evicted, a)
+		}
+	}
+
+	m.hooksMu.RLock()
+	hooks := m.hooks
+	m.hooksMu.RUnlock()
+	for _, a := range evicted {
+		for _, hook := range hooks {
+			hook(a)
+		}
+	}
+	return evicted
+}
+
+func (m *Manager) evictIfExpired(agentID string) (Agent, bool) {
+	m.lock.LockRowForWrite(agentID)
+	defer m.lock.UnlockRowForWrite(agentID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.agents[agentID]
+	if !ok || m.Alive(*a) {
+		return Agent{}, false
+	}
+	delete(m.agents, agentID)
+	return a.clone(), true
+}
+
+// Run 每隔 interval 执行一次 Sweep，直到 ctx 结束
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Sweep()
+		}
+	}
 }
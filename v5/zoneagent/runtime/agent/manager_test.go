@@ -0,0 +1,175 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"code/platform/internal/clock"
+)
+
+func TestManagerTypedErrors(t *testing.T) {
+	m := NewManager(nil, time.Minute)
+
+	if err := m.Register(NewAgent("", "10.0.0.1")); !errors.Is(err, ErrInvalidAgent) {
+		t.Fatalf("register empty id = %v, want ErrInvalidAgent", err)
+	}
+	if err := m.AddPlugin("a1", "p1"); !errors.Is(err, ErrAgentNotFound) {
+		t.Fatalf("add plugin to unknown agent = %v, want ErrAgentNotFound", err)
+	}
+	if err := m.Heartbeat("a1"); !errors.Is(err, ErrAgentNotFound) {
+		t.Fatalf("heartbeat unknown agent = %v, want ErrAgentNotFound", err)
+	}
+	if _, err := m.UnRegister("a1"); !errors.Is(err, ErrAgentNotFound) {
+		t.Fatalf("unregister unknown agent = %v, want ErrAgentNotFound", err)
+	}
+
+	if err := m.Register(NewAgent("a1", "10.0.0.1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddPlugin("a1", "p1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddPlugin("a1", "p1"); !errors.Is(err, ErrPluginExists) {
+		t.Fatalf("add plugin twice = %v, want ErrPluginExists", err)
+	}
+	if err := m.RemovePlugin("a1", "p2"); !errors.Is(err, ErrPluginNotFound) {
+		t.Fatalf("remove unassigned plugin = %v, want ErrPluginNotFound", err)
+	}
+	if err := m.RemovePlugin("a2", "p1"); !errors.Is(err, ErrAgentNotFound) {
+		t.Fatalf("remove from unknown agent = %v, want ErrAgentNotFound", err)
+	}
+}
+
+func TestManagerReRegisterKeepsPlugins(t *testing.T) {
+	m := NewManager(nil, time.Minute)
+	m.Register(NewAgent("a1", "10.0.0.1"))
+	m.AddPlugin("a1", "p1")
+	m.Register(NewAgent("a1", "10.0.0.2").WithCapacity(4, 1<<30))
+
+	a, err := m.Get("a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.AgentIP() != "10.0.0.2" || a.CPU() != 4 {
+		t.Fatalf("agent not updated: %+v", a)
+	}
+	if !a.HasPlugin("p1") {
+		t.Fatal("re-register dropped assigned plugin")
+	}
+	plugins, err := m.UnRegister("a1")
+	if err != nil || len(plugins) != 1 || plugins[0] != "p1" {
+		t.Fatalf("unregister = %v, %v", plugins, err)
+	}
+}
+
+func TestManagerSweepEvictsExpired(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1000, 0))
+	m := NewManager(nil, 10*time.Second)
+	m.SetClock(fake)
+
+	var evicted []string
+	m.OnEvict(func(a Agent) { evicted = append(evicted, a.AgentID()+":"+fmt.Sprint(a.Plugins())) })
+
+	m.Register(NewAgent("a1", "10.0.0.1"))
+	m.Register(NewAgent("a2", "10.0.0.2"))
+	m.AddPlugin("a1", "p1")
+
+	fake.Advance(8 * time.Second)
+	m.Heartbeat("a2")
+	if got := m.Sweep(); len(got) != 0 {
+		t.Fatalf("sweep before ttl evicted %d agents", len(got))
+	}
+
+	fake.Advance(5 * time.Second)
+	got := m.Sweep()
+	if len(got) != 1 || got[0].AgentID() != "a1" {
+		t.Fatalf("sweep evicted %v, want a1", got)
+	}
+	if len(evicted) != 1 || evicted[0] != "a1:[p1]" {
+		t.Fatalf("hook saw %v", evicted)
+	}
+	if _, err := m.Get("a1"); !errors.Is(err, ErrAgentNotFound) {
+		t.Fatalf("evicted agent still present: %v", err)
+	}
+	if err := m.Heartbeat("a1"); !errors.Is(err, ErrAgentNotFound) {
+		t.Fatalf("heartbeat after eviction = %v, want ErrAgentNotFound", err)
+	}
+}
+
+// 并发执行注册、分配、释放、注销和驱逐，配合 -race 检查数据竞争，并校验结束后的一致性
+func TestManagerConcurrent(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1000, 0))
+	m := NewManager(nil, 10*time.Second)
+	m.SetClock(fake)
+
+	const (
+		agents  = 8
+		plugins = 16
+		rounds  = 200
+	)
+	agentID := func(i int) string { return fmt.Sprintf("a%d", i%agents) }
+	pluginID := func(i int) string { return fmt.Sprintf("p%d", i%plugins) }
+
+	var wg sync.WaitGroup
+	run := func(f func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				f(i)
+			}
+		}()
+	}
+	check := func(err error, allowed ...error) {
+		if err == nil {
+			return
+		}
+		for _, a := range allowed {
+			if errors.Is(err, a) {
+				return
+			}
+		}
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	run(func(i int) { check(m.Register(NewAgent(agentID(i), "10.0.0.1"))) })
+	run(func(i int) { check(m.Heartbeat(agentID(i+3)), ErrAgentNotFound) })
+	run(func(i int) { check(m.AddPlugin(agentID(i), pluginID(i)), ErrAgentNotFound, ErrPluginExists) })
+	run(func(i int) { check(m.RemovePlugin(agentID(i+1), pluginID(i+1)), ErrAgentNotFound, ErrPluginNotFound) })
+	run(func(i int) {
+		_, err := m.UnRegister(agentID(i + 5))
+		check(err, ErrAgentNotFound)
+	})
+	run(func(i int) {
+		if i%20 == 0 {
+			fake.Advance(11 * time.Second)
+		}
+		m.Sweep()
+	})
+	run(func(i int) {
+		for _, a := range m.List() {
+			a.Plugins()
+		}
+		_, err := m.Get(agentID(i))
+		check(err, ErrAgentNotFound)
+	})
+	wg.Wait()
+
+	// 结束后每个 agent 的插件都能逐个释放，且注销后不再可见
+	for _, a := range m.List() {
+		for _, p := range a.Plugins() {
+			if err := m.RemovePlugin(a.AgentID(), p); err != nil {
+				t.Fatalf("remove %s from %s: %v", p, a.AgentID(), err)
+			}
+		}
+		if _, err := m.UnRegister(a.AgentID()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(m.List()); n != 0 {
+		t.Fatalf("%d agents left after unregistering all", n)
+	}
+}
@@ -0,0 +1,52 @@
+package runtime
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"code/platform/internal/metrics"
+	"code/platform/v5/zoneagent/runtime/plugin"
+)
+
+var pluginStates = []plugin.State{
+	plugin.StatePending,
+	plugin.StateScheduled,
+	plugin.StateStarting,
+	plugin.StateRunning,
+	plugin.StateStopping,
+	plugin.StateStopped,
+	plugin.StateFailed,
+	plugin.StateLost,
+}
+
+// RegisterMetrics 注册调度队列、agent 和插件状态指标
+func (r *Runtime) RegisterMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(metrics.NewGaugeFunc("zoneagent_scheduler_queue_depth", "Tasks waiting in the scheduler queue.", nil, func(emit metrics.Emit) {
+		emit(float64(r.Scheduler.Stats().Queued))
+	}))
+	reg.MustRegister(metrics.NewGaugeFunc("zoneagent_scheduler_tasks_processing", "Tasks currently being handled by scheduler workers.", nil, func(emit metrics.Emit) {
+		emit(float64(r.Scheduler.Stats().Processing))
+	}))
+	reg.MustRegister(metrics.NewGaugeFunc("zoneagent_scheduler_tasks_backoff", "Failed tasks waiting for their retry backoff.", nil, func(emit metrics.Emit) {
+		emit(float64(r.Scheduler.Stats().Waiting))
+	}))
+	reg.MustRegister(metrics.NewCounterFunc("zoneagent_scheduler_tasks_total", "Scheduler task outcomes.", []string{"result"}, func(emit metrics.Emit) {
+		stats := r.Scheduler.Stats()
+		emit(float64(stats.Processed), "processed")
+		emit(float64(stats.Failed), "failed")
+		emit(float64(stats.Retried), "retried")
+		emit(float64(stats.DeadLettered), "dead_lettered")
+	}))
+	reg.MustRegister(metrics.NewGaugeFunc("zoneagent_agents", "Registered agents.", nil, func(emit metrics.Emit) {
+		emit(float64(len(r.Agents.List())))
+	}))
+	reg.MustRegister(metrics.NewGaugeFunc("zoneagent_plugins", "Plugin runtimes by state.", []string{"state"}, func(emit metrics.Emit) {
+		counts := make(map[plugin.State]int)
+		r.Plugins.Range(func(p plugin.Plugin) bool {
+			counts[p.Status()]++
+			return true
+		})
+		for _, state := range pluginStates {
+			emit(float64(counts[state]), string(state))
+		}
+	}))
+}
@@ -1,6 +1,24 @@
 package plugin
 
-import "code/platform/v5/lock"
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"code/platform/internal/clock"
+	"code/platform/v5/lock"
+)
+
+var (
+	ErrPluginExists   = errors.New("plugin: plugin already exists")
+	ErrPluginNotFound = errors.New("plugin: plugin not found")
+	// 更新时携带的 lastUpdate 与当前记录不一致，需要重新读取后再更新
+	ErrConflict = errors.New("plugin: update conflict")
+	// 创建时指定的状态不在状态机中
+	ErrInvalidState = errors.New("plugin: invalid state")
+)
 
 type Plugin struct {
 	instanceID string
@@ -9,11 +27,409 @@ type Plugin struct {
 	appName    string
 	agentID    string
 	agentIP    string
-	status     string
+	status     State
+	// 最近一次状态变更的原因和时间，unix 纳秒
+	statusReason string
+	statusAt     int64
+	history      []Transition
+	// 最近一次写入时间，unix 纳秒，同一记录严格递增，用于乐观更新
 	lastUpdate int64
 }
 
+func NewPlugin(instanceID string, version string, appID string, appName string) Plugin {
+	return Plugin{
+		instanceID: instanceID,
+		version:    version,
+		appID:      appID,
+		appName:    appName,
+		status:     StatePending,
+	}
+}
+
+// Key 运行时记录的 key：instanceID + version
+func Key(instanceID string, version string) string {
+	return instanceID + "/" + version
+}
+
+// WithAgent 分配到 agent，agentID 为空表示解除分配
+func (p Plugin) WithAgent(agentID string, agentIP string) Plugin {
+	p.agentID = agentID
+	p.agentIP = agentIP
+	return p
+}
+
+// WithStatus 期望变更到的状态，Update 时校验状态变更是否合法
+func (p Plugin) WithStatus(status State, reason string) Plugin {
+	p.status = status
+	p.statusReason = reason
+	return p
+}
+
+func (p Plugin) Key() string { return Key(p.instanceID, p.version) }
+
+func (p Plugin) InstanceID() string { return p.instanceID }
+
+func (p Plugin) Version() string { return p.version }
+
+func (p Plugin) AppID() string { return p.appID }
+
+func (p Plugin) AppName() string { return p.appName }
+
+func (p Plugin) AgentID() string { return p.agentID }
+
+func (p Plugin) AgentIP() string { return p.agentIP }
+
+func (p Plugin) Status() State { return p.status }
+
+func (p Plugin) StatusReason() string { return p.statusReason }
+
+func (p Plugin) StatusAt() time.Time { return time.Unix(0, p.statusAt) }
+
+func (p Plugin) LastUpdate() int64 { return p.lastUpdate }
+
+// History 最近的状态变更，从旧到新
+func (p Plugin) History() []Transition {
+	return append([]Transition(nil), p.history...)
+}
+
+func (p *Plugin) clone() Plugin {
+	c := *p
+	c.history = p.History()
+	return c
+}
+
 type Manager struct {
-	lock   lock.Table
-	Agents map[string]Plugin
+	// 行锁，rowID 为 Key(instanceID, version)
+	lock  lock.Locker
+	clock clock.Clock
+	// 保护 plugins 和索引
+	mu      sync.RWMutex
+	plugins map[string]*Plugin             // key instanceID + version
+	byAgent map[string]map[string]struct{} // agentID:key
+	byApp   map[string]map[string]struct{} // appID:key
+	events  Events
+}
+
+// NewManager locker 为空时使用进程内行锁
+func NewManager(locker lock.Locker) *Manager {
+	if locker == nil {
+		locker = lock.NewTable()
+	}
+	return &Manager{
+		lock:    locker,
+		clock:   clock.Real{},
+		plugins: make(map[string]*Plugin),
+		byAgent: make(map[string]map[string]struct{}),
+		byApp:   make(map[string]map[string]struct{}),
+	}
+}
+
+func (m *Manager) SetClock(c clock.Clock) {
+	m.clock = c
+}
+
+// Subscribe 订阅插件状态变更事件
+func (m *Manager) Subscribe(l Listener) {
+	m.events.Subscribe(l)
+}
+
+// Create 新增运行时记录，状态为空时置为 pending。初始状态记入历史并发出 From 为空的事件
+func (m *Manager) Create(p Plugin) (Plugin, error) {
+	key := p.Key()
+	c := p.clone()
+	if c.status == "" {
+		c.status = StatePending
+	}
+	if _, ok := transitions[c.status]; !ok {
+		return Plugin{}, fmt.Errorf("%w: %s %q", ErrInvalidState, key, c.status)
+	}
+	reason := c.statusReason
+	if reason == "" {
+		reason = "created"
+	}
+
+	m.lock.LockRowForWrite(key)
+	m.mu.Lock()
+	if _, ok := m.plugins[key]; ok {
+		m.mu.Unlock()
+		m.lock.UnlockRowForWrite(key)
+		return Plugin{}, fmt.Errorf("%w: %s", ErrPluginExists, key)
+	}
+	now := m.clock.Now()
+	t := Transition{To: c.status, Reason: reason, At: now}
+	c.statusReason = reason
+	c.statusAt = now.UnixNano()
+	c.history = []Transition{t}
+	c.lastUpdate = now.UnixNano()
+	m.plugins[key] = &c
+	m.indexLocked(&c)
+	res := c.clone()
+	m.mu.Unlock()
+	m.lock.UnlockRowForWrite(key)
+
+	m.events.emit(Event{InstanceID: c.instanceID, Version: c.version, AgentID: c.agentID, Transition: t})
+	return res, nil
+}
+
+func (m *Manager) Get(instanceID string, version string) (Plugin, error) {
+	key := Key(instanceID, version)
+	m.lock.LockRowForRead(key)
+	defer m.lock.UnlockRowForRead(key)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	p, ok := m.plugins[key]
+	if !ok {
+		return Plugin{}, fmt.Errorf("%w: %s", ErrPluginNotFound, key)
+	}
+	return p.clone(), nil
+}
+
+// Update 乐观更新：p 必须携带读取时的 lastUpdate，期间被其他人改过返回 ErrConflict。
+// 状态与当前不同时按状态机校验，合法则记录变更，释放行锁后发出事件
+func (m *Manager) Update(p Plugin) (Plugin, error) {
+	key := p.Key()
+	m.lock.LockRowForWrite(key)
+	res, ev, err := m.updateLocked(p)
+	m.lock.UnlockRowForWrite(key)
+	if ev != nil {
+		m.events.emit(*ev)
+	}
+	return res, err
+}
+
+// updateLocked 调用方需持有 p.Key() 的行锁，状态有变更时返回事件
+func (m *Manager) updateLocked(p Plugin) (Plugin, *Event, error) {
+	key := p.Key()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cur, ok := m.plugins[key]
+	if !ok {
+		return Plugin{}, nil, fmt.Errorf("%w: %s", ErrPluginNotFound, key)
+	}
+	if cur.lastUpdate != p.lastUpdate {
+		return Plugin{}, nil, fmt.Errorf("%w: %s", ErrConflict, key)
+	}
+
+	next := cur.clone()
+	next.appName = p.appName
+	next.agentID = p.agentID
+	next.agentIP = p.agentIP
+	now := m.clock.Now()
+	var ev *Event
+	if p.status != cur.status {
+		e, err := next.transition(p.status, p.statusReason, now)
+		if err != nil {
+			return Plugin{}, nil, err
+		}
+		ev = &e
+	}
+	next.lastUpdate = nextUpdate(cur.lastUpdate, now)
+
+	m.unindexLocked(cur)
+	*cur = next
+	m.indexLocked(cur)
+	return cur.clone(), ev, nil
+}
+
+// Transition 不比较 lastUpdate 直接变更状态，只受状态机约束，释放行锁后发出事件
+func (m *Manager) Transition(instanceID string, version string, to State, reason string) (Plugin, error) {
+	key := Key(instanceID, version)
+	m.lock.LockRowForWrite(key)
+	res, ev, err := m.transitionLocked(key, to, reason)
+	m.lock.UnlockRowForWrite(key)
+	if err != nil {
+		return Plugin{}, err
+	}
+	m.events.emit(ev)
+	return res, nil
+}
+
+// transitionLocked 调用方需持有 key 的行锁，并在释放行锁后发出返回的事件
+func (m *Manager) transitionLocked(key string, to State, reason string) (Plugin, Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.plugins[key]
+	if !ok {
+		return Plugin{}, Event{}, fmt.Errorf("%w: %s", ErrPluginNotFound, key)
+	}
+	now := m.clock.Now()
+	ev, err := p.transition(to, reason, now)
+	if err != nil {
+		return Plugin{}, Event{}, err
+	}
+	p.lastUpdate = nextUpdate(p.lastUpdate, now)
+	return p.clone(), ev, nil
+}
+
+func (m *Manager) Delete(instanceID string, version string) error {
+	key := Key(instanceID, version)
+	m.lock.LockRowForWrite(key)
+	defer m.lock.UnlockRowForWrite(key)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.plugins[key]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrPluginNotFound, key)
+	}
+	m.unindexLocked(p)
+	delete(m.plugins, key)
+	return nil
+}
+
+// MarkAgentLost agent 失联后把其上未停止的插件置为 lost，返回这些插件，调用方需要重新调度它们。
+// 正在停止的插件随 agent 一起消失，直接置为 stopped，不会返回；
+// pending 和 failed 的插件解除与该 agent 的分配后置为 pending，同样返回
+func (m *Manager) MarkAgentLost(agentID string, reason string) []Plugin {
+	var lost []Plugin
+	for _, p := range m.ListByAgent(agentID) {
+		key := p.Key()
+		m.lock.LockRowForWrite(key)
+		res, ev, ok := m.markLostLocked(key, agentID, reason)
+		m.lock.UnlockRowForWrite(key)
+		if ev != nil {
+			m.events.emit(*ev)
+		}
+		if ok {
+			lost = append(lost, res)
+		}
+	}
+	return lost
+}
+
+// markLostLocked 调用方需持有 key 的行锁。列出之后插件可能已被改动，这里按当前记录判断
+func (m *Manager) markLostLocked(key string, agentID string, reason string) (Plugin, *Event, bool) {
+	m.mu.Lock()
+	p, ok := m.plugins[key]
+	if !ok || p.agentID != agentID {
+		m.mu.Unlock()
+		return Plugin{}, nil, false
+	}
+	switch p.status {
+	case StateStopped, StateLost:
+		m.mu.Unlock()
+		return Plugin{}, nil, false
+	case StatePending, StateFailed:
+		// 状态机不允许变更为 lost，进程已不存在，解除分配后等待重新调度
+		next := p.clone()
+		next.agentID, next.agentIP = "", ""
+		m.mu.Unlock()
+		res, ev, err := m.updateLocked(next.WithStatus(StatePending, reason))
+		return res, ev, err == nil
+	}
+	m.mu.Unlock()
+
+	to := StateLost
+	if p.status == StateStopping {
+		to = StateStopped
+	}
+	res, ev, err := m.transitionLocked(key, to, reason)
+	if err != nil {
+		return Plugin{}, nil, false
+	}
+	return res, &ev, to == StateLost
+}
+
+// List 所有运行时记录的快照，按 key 排序
+func (m *Manager) List() []Plugin {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	plugins := make([]Plugin, 0, len(m.plugins))
+	for _, p := range m.plugins {
+		plugins = append(plugins, p.clone())
+	}
+	sortPlugins(plugins)
+	return plugins
+}
+
+func (m *Manager) ListByAgent(agentID string) []Plugin {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.snapshotLocked(m.byAgent[agentID])
+}
+
+func (m *Manager) ListByApp(appID string) []Plugin {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.snapshotLocked(m.byApp[appID])
+}
+
+// ListByInstance 同一实例的所有版本，升级过程中可能同时存在新旧两个版本
+func (m *Manager) ListByInstance(instanceID string) []Plugin {
+	var plugins []Plugin
+	for _, p := range m.List() {
+		if p.instanceID == instanceID {
+			plugins = append(plugins, p)
+		}
+	}
+	return plugins
+}
+
+// Range 在快照上遍历，fn 返回 false 时停止；遍历期间的上报不会影响快照
+func (m *Manager) Range(fn func(p Plugin) bool) {
+	for _, p := range m.List() {
+		if !fn(p) {
+			return
+		}
+	}
+}
+
+func (m *Manager) snapshotLocked(keys map[string]struct{}) []Plugin {
+	plugins := make([]Plugin, 0, len(keys))
+	for key := range keys {
+		plugins = append(plugins, m.plugins[key].clone())
+	}
+	sortPlugins(plugins)
+	return plugins
+}
+
+func (m *Manager) indexLocked(p *Plugin) {
+	key := p.Key()
+	if p.agentID != "" {
+		addIndex(m.byAgent, p.agentID, key)
+	}
+	if p.appID != "" {
+		addIndex(m.byApp, p.appID, key)
+	}
+}
+
+func (m *Manager) unindexLocked(p *Plugin) {
+	key := p.Key()
+	removeIndex(m.byAgent, p.agentID, key)
+	removeIndex(m.byApp, p.appID, key)
+}
+
+func addIndex(index map[string]map[string]struct{}, id string, key string) {
+	keys, ok := index[id]
+	if !ok {
+		keys = make(map[string]struct{})
+		index[id] = keys
+	}
+	keys[key] = struct{}{}
+}
+
+func removeIndex(index map[string]map[string]struct{}, id string, key string) {
+	keys, ok := index[id]
+	if !ok {
+		return
+	}
+	delete(keys, key)
+	if len(keys) == 0 {
+		delete(index, id)
+	}
+}
+
+func sortPlugins(plugins []Plugin) {
+	sort.Slice(plugins, func(i, j int) bool {
+		return plugins[i].Key() < plugins[j].Key()
+	})
+}
+
+// nextUpdate 时钟回拨或精度不够时也保证 lastUpdate 严格递增
+func nextUpdate(prev int64, now time.Time) int64 {
+	if n := now.UnixNano(); n > prev {
+		return n
+	}
+	return prev + 1
 }
@@ -0,0 +1,155 @@
+package plugin
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"code/platform/internal/clock"
+)
+
+func newTestManager() (*Manager, *[]Event) {
+	m := NewManager(nil)
+	m.SetClock(clock.NewFake(time.Unix(1000, 0)))
+	var events []Event
+	m.Subscribe(func(ev Event) { events = append(events, ev) })
+	return m, &events
+}
+
+func TestCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  State
+		want    State
+		wantErr error
+	}{
+		{"default", "", StatePending, nil},
+		{"explicit", StateRunning, StateRunning, nil},
+		{"unknown", "bogus", "", ErrInvalidState},
+	}
+	for _, tt := range tests {
+		m, events := newTestManager()
+		p, err := m.Create(NewPlugin("i1", "v1", "app", "").WithStatus(tt.status, ""))
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil {
+			if len(*events) != 0 {
+				t.Fatalf("%s: events on rejected create: %+v", tt.name, *events)
+			}
+			continue
+		}
+		if p.Status() != tt.want {
+			t.Fatalf("%s: status = %s, want %s", tt.name, p.Status(), tt.want)
+		}
+		if h := p.History(); len(h) != 1 || h[0].From != "" || h[0].To != tt.want {
+			t.Fatalf("%s: history = %+v", tt.name, h)
+		}
+		if len(*events) != 1 || (*events)[0].To != tt.want || (*events)[0].From != "" {
+			t.Fatalf("%s: events = %+v", tt.name, *events)
+		}
+	}
+
+	m, _ := newTestManager()
+	m.Create(NewPlugin("i1", "v1", "", ""))
+	if _, err := m.Create(NewPlugin("i1", "v1", "", "")); !errors.Is(err, ErrPluginExists) {
+		t.Fatalf("duplicate create: err = %v, want ErrPluginExists", err)
+	}
+}
+
+func TestUpdateConflictAndIllegal(t *testing.T) {
+	m, events := newTestManager()
+	p, _ := m.Create(NewPlugin("i1", "v1", "", ""))
+	*events = nil
+
+	if _, err := m.Update(p.WithStatus(StateRunning, "skip scheduling")); !errors.Is(err, ErrIllegalTransition) {
+		t.Fatalf("illegal update: err = %v, want ErrIllegalTransition", err)
+	}
+	next, err := m.Update(p.WithAgent("a1", "10.0.0.1").WithStatus(StateScheduled, "assigned"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Update(p.WithStatus(StateScheduled, "stale")); !errors.Is(err, ErrConflict) {
+		t.Fatalf("stale update: err = %v, want ErrConflict", err)
+	}
+	if got := m.ListByAgent("a1"); len(got) != 1 || got[0].Key() != next.Key() {
+		t.Fatalf("agent index = %+v", got)
+	}
+	if len(*events) != 1 || (*events)[0].From != StatePending || (*events)[0].To != StateScheduled {
+		t.Fatalf("events = %+v", *events)
+	}
+}
+
+func TestMarkAgentLost(t *testing.T) {
+	tests := []struct {
+		status   State
+		want     State
+		returned bool
+	}{
+		{StatePending, StatePending, true},
+		{StateScheduled, StateLost, true},
+		{StateStarting, StateLost, true},
+		{StateRunning, StateLost, true},
+		{StateFailed, StatePending, true},
+		{StateStopping, StateStopped, false},
+		{StateStopped, StateStopped, false},
+		{StateLost, StateLost, false},
+	}
+	for _, tt := range tests {
+		m, _ := newTestManager()
+		m.Create(NewPlugin("i1", "v1", "", "").WithAgent("a1", "10.0.0.1").WithStatus(tt.status, ""))
+		m.Create(NewPlugin("i2", "v1", "", "").WithAgent("a2", "10.0.0.2").WithStatus(StateRunning, ""))
+
+		lost := m.MarkAgentLost("a1", "agent heartbeat expired")
+		if got := len(lost) == 1; got != tt.returned {
+			t.Errorf("%s: returned %+v, want returned = %v", tt.status, lost, tt.returned)
+		}
+		p, _ := m.Get("i1", "v1")
+		if p.Status() != tt.want {
+			t.Errorf("%s: status = %s, want %s", tt.status, p.Status(), tt.want)
+		}
+		if tt.want == StatePending && (p.AgentID() != "" || len(m.ListByAgent("a1")) != 0) {
+			t.Errorf("%s: still assigned to %q", tt.status, p.AgentID())
+		}
+		if other, _ := m.Get("i2", "v1"); other.Status() != StateRunning {
+			t.Errorf("%s: plugin on another agent changed to %s", tt.status, other.Status())
+		}
+	}
+}
+
+func TestListenerCanReadRow(t *testing.T) {
+	m := NewManager(nil)
+	var seen []State
+	m.Subscribe(func(ev Event) {
+		// 监听者读取同一行不能死锁
+		p, err := m.Get(ev.InstanceID, ev.Version)
+		if err != nil {
+			t.Errorf("get in listener: %v", err)
+			return
+		}
+		seen = append(seen, p.Status())
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p, _ := m.Create(NewPlugin("i1", "v1", "", "").WithAgent("a1", "10.0.0.1"))
+		p, _ = m.Update(p.WithStatus(StateScheduled, "assigned"))
+		m.Transition("i1", "v1", StateRunning, "reported")
+		m.MarkAgentLost("a1", "agent heartbeat expired")
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener deadlocked on the row lock")
+	}
+	want := []State{StatePending, StateScheduled, StateRunning, StateLost}
+	if len(seen) != len(want) {
+		t.Fatalf("listener saw %v, want %v", seen, want)
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Fatalf("listener saw %v, want %v", seen, want)
+		}
+	}
+}
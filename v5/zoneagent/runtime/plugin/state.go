@@ -0,0 +1,124 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// State 插件运行时状态
+type State string
+
+const (
+	// 等待调度
+	StatePending State = "pending"
+	// 已分配 agent，任务已下发
+	StateScheduled State = "scheduled"
+	// agent 正在拉起进程
+	StateStarting State = "starting"
+	StateRunning  State = "running"
+	// 已下发停止任务
+	StateStopping State = "stopping"
+	StateStopped  State = "stopped"
+	// 启动失败或运行中异常退出
+	StateFailed State = "failed"
+	// 所在 agent 失联
+	StateLost State = "lost"
+)
+
+// 每个插件保留的最近状态变更数量
+const maxHistory = 16
+
+var ErrIllegalTransition = errors.New("plugin: illegal state transition")
+
+// running 回到 starting 表示进程退出后由 agent 的 supervisor 重新拉起
+var transitions = map[State][]State{
+	StatePending:   {StateScheduled, StateStopped, StateFailed},
+	StateScheduled: {StatePending, StateStarting, StateRunning, StateStopping, StateFailed, StateLost},
+	StateStarting:  {StateRunning, StateStopping, StateFailed, StateLost},
+	StateRunning:   {StateStarting, StateStopping, StateFailed, StateLost},
+	StateStopping:  {StateStopped, StateFailed, StateLost},
+	StateStopped:   {StatePending},
+	StateFailed:    {StatePending, StateStopping, StateStopped},
+	StateLost:      {StatePending, StateStopped},
+}
+
+// CanTransition from 能否变更为 to，相同状态视为合法（只刷新原因和时间）
+func CanTransition(from State, to State) bool {
+	if from == to {
+		_, ok := transitions[from]
+		return ok
+	}
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Terminal 已停止的插件不再占用 agent
+func (s State) Terminal() bool {
+	return s == StateStopped
+}
+
+type Transition struct {
+	From   State
+	To     State
+	Reason string
+	At     time.Time
+}
+
+// Event 状态变更事件
+type Event struct {
+	InstanceID string
+	Version    string
+	AgentID    string
+	Transition
+}
+
+type Listener func(Event)
+
+// Events 状态变更事件的订阅表，监听者同步执行，不应阻塞
+type Events struct {
+	mu        sync.RWMutex
+	listeners []Listener
+}
+
+func (e *Events) Subscribe(l Listener) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.listeners = append(e.listeners, l)
+}
+
+func (e *Events) emit(ev Event) {
+	e.mu.RLock()
+	listeners := e.listeners
+	e.mu.RUnlock()
+	for _, l := range listeners {
+		l(ev)
+	}
+}
+
+// transition 变更状态并记录历史，非法变更返回 ErrIllegalTransition
+func (p *Plugin) transition(to State, reason string, at time.Time) (Event, error) {
+	from := p.status
+	if !CanTransition(from, to) {
+		return Event{}, fmt.Errorf("%w: %s %s -> %s", ErrIllegalTransition, p.instanceID, from, to)
+	}
+	t := Transition{From: from, To: to, Reason: reason, At: at}
+	p.status = to
+	p.statusReason = reason
+	p.statusAt = at.UnixNano()
+	p.history = append(p.history, t)
+	if len(p.history) > maxHistory {
+		p.history = p.history[len(p.history)-maxHistory:]
+	}
+	return Event{
+		InstanceID: p.instanceID,
+		Version:    p.version,
+		AgentID:    p.agentID,
+		Transition: t,
+	}, nil
+}
@@ -0,0 +1,96 @@
+package plugin
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from State
+		to   State
+		want bool
+	}{
+		{StatePending, StateScheduled, true},
+		{StatePending, StatePending, true},
+		{StatePending, StateRunning, false},
+		{StatePending, StateLost, false},
+		{StateScheduled, StateStarting, true},
+		{StateScheduled, StateRunning, true},
+		{StateScheduled, StateLost, true},
+		{StateStarting, StateRunning, true},
+		{StateStarting, StatePending, false},
+		{StateRunning, StateStarting, true},
+		{StateRunning, StateStopping, true},
+		{StateRunning, StateFailed, true},
+		{StateRunning, StateLost, true},
+		{StateRunning, StateStopped, false},
+		{StateRunning, StateScheduled, false},
+		{StateStopping, StateStopped, true},
+		{StateStopping, StateRunning, false},
+		{StateStopped, StatePending, true},
+		{StateStopped, StateRunning, false},
+		{StateFailed, StatePending, true},
+		{StateFailed, StateRunning, false},
+		{StateFailed, StateLost, false},
+		{StateLost, StatePending, true},
+		{StateLost, StateRunning, false},
+		{"unknown", "unknown", false},
+		{StatePending, "unknown", false},
+	}
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestTransitionHistory(t *testing.T) {
+	at := time.Unix(1000, 0)
+	p := NewPlugin("i1", "v1", "app", "")
+	steps := []struct {
+		to      State
+		wantErr bool
+	}{
+		{StateScheduled, false},
+		{StateRunning, false},
+		{StatePending, true},
+		{StateStopping, false},
+		{StateStopped, false},
+	}
+	for i, step := range steps {
+		ev, err := p.transition(step.to, "step", at.Add(time.Duration(i)*time.Second))
+		if step.wantErr {
+			if !errors.Is(err, ErrIllegalTransition) {
+				t.Fatalf("step %d to %s: err = %v, want ErrIllegalTransition", i, step.to, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("step %d to %s: %v", i, step.to, err)
+		}
+		if ev.To != step.to || ev.InstanceID != "i1" {
+			t.Fatalf("step %d event = %+v", i, ev)
+		}
+	}
+	want := []State{StateScheduled, StateRunning, StateStopping, StateStopped}
+	history := p.History()
+	if len(history) != len(want) {
+		t.Fatalf("history = %+v, want %v", history, want)
+	}
+	for i, tr := range history {
+		if tr.To != want[i] {
+			t.Errorf("history[%d] = %s, want %s", i, tr.To, want[i])
+		}
+	}
+
+	// 只保留最近 maxHistory 条
+	for i := 0; i < maxHistory; i++ {
+		p.transition(StatePending, "again", at)
+		p.transition(StateStopped, "again", at)
+	}
+	if n := len(p.History()); n != maxHistory {
+		t.Fatalf("history length = %d, want %d", n, maxHistory)
+	}
+}
@@ -0,0 +1,43 @@
+// Package reconciler 把 v5 的插件运行时和调度器接到 internal/reconcile
+package reconciler
+
+import (
+	"context"
+
+	"code/platform/internal/reconcile"
+	"code/platform/v5/zoneagent/runtime/plugin"
+	"code/platform/v5/zoneagent/runtime/scheduler"
+)
+
+// Plugins 以 v5 插件运行时作为 Runtimes
+func Plugins(plugins *plugin.Manager) reconcile.Runtimes {
+	return reconcile.RuntimesFunc(func(ctx context.Context) ([]reconcile.Runtime, error) {
+		var runtimes []reconcile.Runtime
+		plugins.Range(func(p plugin.Plugin) bool {
+			switch {
+			case active(p.Status()):
+				runtimes = append(runtimes, reconcile.Runtime{InstanceID: p.InstanceID(), Version: p.Version()})
+			case p.Status() == plugin.StatePending:
+				runtimes = append(runtimes, reconcile.Runtime{InstanceID: p.InstanceID(), Version: p.Version(), Pending: true})
+			}
+			return true
+		})
+		return runtimes, nil
+	})
+}
+
+// Scheduler 把任务转成 ScheduleTask 交给调度器
+func Scheduler(s *scheduler.Scheduler) reconcile.Pusher {
+	return reconcile.PusherFunc(func(task reconcile.Task) {
+		s.Push(scheduler.NewScheduleTask(task.InstanceID, task.Version, scheduler.Action(task.Action)))
+	})
+}
+
+// active 仍占用 agent 或正在启动的运行时
+func active(s plugin.State) bool {
+	switch s {
+	case plugin.StateScheduled, plugin.StateStarting, plugin.StateRunning:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"code/platform/internal/reconcile"
+	"code/platform/v5/zoneagent/runtime/plugin"
+	"code/platform/v5/zoneagent/runtime/scheduler"
+)
+
+func TestPlugins(t *testing.T) {
+	plugins := plugin.NewManager(nil)
+	for _, p := range []plugin.Plugin{
+		plugin.NewPlugin("i1", "v1", "app", "app"),
+		plugin.NewPlugin("i2", "v1", "app", "app").WithStatus(plugin.StateRunning, ""),
+		plugin.NewPlugin("i3", "v1", "app", "app").WithStatus(plugin.StateStopped, ""),
+	} {
+		if _, err := plugins.Create(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := Plugins(plugins).Runtimes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]reconcile.Runtime{
+		"i1": {InstanceID: "i1", Version: "v1", Pending: true},
+		"i2": {InstanceID: "i2", Version: "v1"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("runtimes = %+v, want %+v", got, want)
+	}
+	for _, rt := range got {
+		if want[rt.InstanceID] != rt {
+			t.Errorf("runtime %s = %+v, want %+v", rt.InstanceID, rt, want[rt.InstanceID])
+		}
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	handled := make(chan scheduler.ScheduleTask, 1)
+	s := scheduler.NewScheduler(func(ctx context.Context, task scheduler.ScheduleTask) error {
+		handled <- task
+		return nil
+	}, 0, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx, 1)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	Scheduler(s).Push(reconcile.Task{InstanceID: "i1", Version: "v2", Action: reconcile.ActionUpgrade})
+	select {
+	case task := <-handled:
+		if task.InstanceID() != "i1" || task.Version() != "v2" || task.Action() != scheduler.ActionUpgrade {
+			t.Fatalf("task = %+v, want upgrade i1/v2", task)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("task not scheduled")
+	}
+}
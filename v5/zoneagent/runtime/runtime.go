@@ -0,0 +1,65 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"code/platform/v5/lock"
+	"code/platform/v5/zoneagent/runtime/agent"
+	"code/platform/v5/zoneagent/runtime/plugin"
+	"code/platform/v5/zoneagent/runtime/scheduler"
+)
+
+// Runtime 组装 agent 注册表、插件运行时和调度器
+type Runtime struct {
+	Agents    *agent.Manager
+	Plugins   *plugin.Manager
+	Scheduler *scheduler.Scheduler
+}
+
+func New(locker lock.Locker, agentTTL time.Duration, handler scheduler.Handler, maxRetry int, backoff time.Duration) *Runtime {
+	r := &Runtime{
+		Agents:    agent.NewManager(locker, agentTTL),
+		Plugins:   plugin.NewManager(locker),
+		Scheduler: scheduler.NewScheduler(handler, maxRetry, backoff),
+	}
+	r.Agents.OnEvict(func(a agent.Agent) { r.reschedule(a, "agent heartbeat expired") })
+	r.Scheduler.OnDeadLetter(r.deadLetter)
+	return r
+}
+
+// RemoveAgent agent 主动注销，其上的插件与驱逐时一样重新调度
+func (r *Runtime) RemoveAgent(agentID string) error {
+	a, err := r.Agents.Get(agentID)
+	if err != nil {
+		return err
+	}
+	if _, err := r.Agents.UnRegister(agentID); err != nil {
+		return err
+	}
+	r.reschedule(a, "agent unregistered")
+	return nil
+}
+
+// reschedule agent 不可用后，其上的插件置为 lost 并重新交给调度器，reason 记录为状态变更原因
+func (r *Runtime) reschedule(a agent.Agent, reason string) {
+	for _, p := range r.Plugins.MarkAgentLost(a.AgentID(), reason) {
+		r.Scheduler.Push(scheduler.NewScheduleTask(p.InstanceID(), p.Version(), scheduler.ActionStart))
+	}
+}
+
+// deadLetter 重试耗尽时还没分配到 agent 的插件置为 failed，否则会一直停在 pending，
+// reconciler 把 pending 视为调度中而不再下发。置为 failed 后由 reconciler 下一轮重新启动
+func (r *Runtime) deadLetter(task scheduler.ScheduleTask, cause error) {
+	p, err := r.Plugins.Get(task.InstanceID(), task.Version())
+	if err != nil || p.Status() != plugin.StatePending || p.AgentID() != "" {
+		return
+	}
+	// 期间被新的任务处理过时放弃
+	_, err = r.Plugins.Update(p.WithStatus(plugin.StateFailed, fmt.Sprintf("schedule failed: %v", cause)))
+	if err != nil && !errors.Is(err, plugin.ErrConflict) {
+		log.Printf("runtime: fail %s after dead letter: %v", p.Key(), err)
+	}
+}
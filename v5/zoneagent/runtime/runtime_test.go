@@ -0,0 +1,119 @@
+package runtime
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"code/platform/internal/clock"
+	"code/platform/v5/zoneagent/runtime/agent"
+	"code/platform/v5/zoneagent/runtime/plugin"
+	"code/platform/v5/zoneagent/runtime/scheduler"
+)
+
+type taskLog struct {
+	mu    sync.Mutex
+	tasks []string
+}
+
+func (l *taskLog) handle(ctx context.Context, task scheduler.ScheduleTask) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tasks = append(l.tasks, task.InstanceID()+" "+string(task.Action()))
+	return nil
+}
+
+// place 在 agent 上放一个插件并依次变更状态
+func place(t *testing.T, r *Runtime, instanceID string, agentID string, states ...plugin.State) {
+	t.Helper()
+	p, err := r.Plugins.Create(plugin.NewPlugin(instanceID, "v1", "", "").WithAgent(agentID, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range states {
+		if p, err = r.Plugins.Transition(p.InstanceID(), p.Version(), s, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Agents.AddPlugin(agentID, p.Key()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func status(t *testing.T, r *Runtime, instanceID string) plugin.Plugin {
+	t.Helper()
+	p, err := r.Plugins.Get(instanceID, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func run(t *testing.T, r *Runtime, log *taskLog, want int) []string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Scheduler.Run(ctx, 1)
+		close(done)
+	}()
+	deadline := time.Now().Add(time.Second)
+	for {
+		log.mu.Lock()
+		n := len(log.tasks)
+		log.mu.Unlock()
+		if n >= want || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	<-done
+	return log.tasks
+}
+
+func TestEvictReschedulesRunningButNotStopping(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1000, 0))
+	log := &taskLog{}
+	r := New(nil, 10*time.Second, log.handle, 3, 0)
+	r.Agents.SetClock(fake)
+
+	r.Agents.Register(agent.NewAgent("a1", ""))
+	place(t, r, "i1", "a1", plugin.StateScheduled, plugin.StateRunning)
+	place(t, r, "i2", "a1", plugin.StateScheduled, plugin.StateRunning, plugin.StateStopping)
+
+	fake.Advance(11 * time.Second)
+	if evicted := r.Agents.Sweep(); len(evicted) != 1 {
+		t.Fatalf("evicted %d agents", len(evicted))
+	}
+
+	if p := status(t, r, "i1"); p.Status() != plugin.StateLost || p.StatusReason() != "agent heartbeat expired" {
+		t.Fatalf("i1 = %s (%s), want lost", p.Status(), p.StatusReason())
+	}
+	if p := status(t, r, "i2"); p.Status() != plugin.StateStopped {
+		t.Fatalf("i2 = %s, want stopped", p.Status())
+	}
+	tasks := run(t, r, log, 1)
+	if len(tasks) != 1 || tasks[0] != "i1 start" {
+		t.Fatalf("tasks = %v, want only i1 start", tasks)
+	}
+}
+
+func TestRemoveAgentRecordsUnregister(t *testing.T) {
+	log := &taskLog{}
+	r := New(nil, time.Minute, log.handle, 3, 0)
+	r.Agents.Register(agent.NewAgent("a1", ""))
+	place(t, r, "i1", "a1", plugin.StateScheduled, plugin.StateStarting)
+
+	if err := r.RemoveAgent("a1"); err != nil {
+		t.Fatal(err)
+	}
+	if p := status(t, r, "i1"); p.Status() != plugin.StateLost || p.StatusReason() != "agent unregistered" {
+		t.Fatalf("i1 = %s (%s), want lost by unregister", p.Status(), p.StatusReason())
+	}
+	if tasks := run(t, r, log, 1); len(tasks) != 1 || tasks[0] != "i1 start" {
+		t.Fatalf("tasks = %v", tasks)
+	}
+}
@@ -1,12 +1,269 @@
 package scheduler
 
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type Action string
+
+const (
+	ActionStart   Action = "start"
+	ActionStop    Action = "stop"
+	ActionUpgrade Action = "upgrade"
+)
+
+const maxBackoff = 5 * time.Minute
+
 type ScheduleTask struct {
 	instanceID string
 	version    string
-	action     string
+	action     Action
 	retry      int
 }
 
+func NewScheduleTask(instanceID string, version string, action Action) ScheduleTask {
+	return ScheduleTask{
+		instanceID: instanceID,
+		version:    version,
+		action:     action,
+	}
+}
+
+func (t ScheduleTask) InstanceID() string { return t.instanceID }
+
+func (t ScheduleTask) Version() string { return t.version }
+
+func (t ScheduleTask) Action() Action { return t.action }
+
+// Retry 已失败的次数
+func (t ScheduleTask) Retry() int { return t.retry }
+
+// Handler 执行调度任务，返回错误时按退避时间重试
+type Handler func(ctx context.Context, task ScheduleTask) error
+
+// DeadLetterFunc 任务超过最大重试次数后回调
+type DeadLetterFunc func(task ScheduleTask, err error)
+
+// Scheduler 按 instanceID 去重的任务队列：同一实例排队中只保留最新的任务，
+// 同一实例同一时刻只有一个 worker 在处理
 type Scheduler struct {
-	queue chan ScheduleTask
+	handler    Handler
+	maxRetry   int
+	backoff    time.Duration
+	deadLetter DeadLetterFunc
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// 待处理的 instanceID，与 pending 的 key 一一对应（处理中的除外）
+	queue []string
+	// 每个实例最新的任务
+	pending map[string]ScheduleTask
+	// 正在处理的实例
+	processing map[string]struct{}
+	// 每次 Push 递增，用于丢弃被新任务覆盖的重试，实例空闲后删除
+	gens map[string]uint64
+	// 等待退避的重试任务，每个实例至多一个，Push 时取消
+	timers       map[string]*time.Timer
+	shuttingDown bool
+	stats        Stats
+}
+
+// Stats 队列状态和累计计数
+type Stats struct {
+	// 排队中、处理中、等待退避重试的任务数
+	Queued     int
+	Processing int
+	Waiting    int
+	// 累计处理、失败、重试、进入死信的次数
+	Processed    uint64
+	Failed       uint64
+	Retried      uint64
+	DeadLettered uint64
+}
+
+// NewScheduler backoff 为第一次重试的等待时间，之后每次翻倍，为 0 时立即重试
+func NewScheduler(handler Handler, maxRetry int, backoff time.Duration) *Scheduler {
+	s := &Scheduler{
+		handler:    handler,
+		maxRetry:   maxRetry,
+		backoff:    backoff,
+		pending:    make(map[string]ScheduleTask),
+		processing: make(map[string]struct{}),
+		gens:       make(map[string]uint64),
+		timers:     make(map[string]*time.Timer),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *Scheduler) OnDeadLetter(fn DeadLetterFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadLetter = fn
+}
+
+// Push 入队，覆盖该实例排队中或等待重试的任务
+func (s *Scheduler) Push(task ScheduleTask) {
+	task.retry = 0
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shuttingDown {
+		return
+	}
+	if timer, ok := s.timers[task.instanceID]; ok {
+		timer.Stop()
+		delete(s.timers, task.instanceID)
+	}
+	s.gens[task.instanceID]++
+	s.addLocked(task)
+}
+
+// Len 排队中的任务数量
+func (s *Scheduler) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+func (s *Scheduler) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	stats.Queued = len(s.queue)
+	stats.Processing = len(s.processing)
+	stats.Waiting = len(s.timers)
+	return stats
+}
+
+// Run 启动 workers 个 worker，ctx 结束后不再取新任务，等待处理中的任务完成后返回
+func (s *Scheduler) Run(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for s.processNext(ctx) {
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	s.mu.Lock()
+	s.shuttingDown = true
+	for _, timer := range s.timers {
+		timer.Stop()
+	}
+	s.timers = make(map[string]*time.Timer)
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	wg.Wait()
+}
+
+func (s *Scheduler) addLocked(task ScheduleTask) {
+	if _, ok := s.pending[task.instanceID]; !ok {
+		if _, ok := s.processing[task.instanceID]; !ok {
+			s.queue = append(s.queue, task.instanceID)
+		}
+	}
+	s.pending[task.instanceID] = task
+	s.cond.Signal()
+}
+
+func (s *Scheduler) next() (ScheduleTask, uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.queue) == 0 && !s.shuttingDown {
+		s.cond.Wait()
+	}
+	if s.shuttingDown {
+		return ScheduleTask{}, 0, false
+	}
+	id := s.queue[0]
+	s.queue = s.queue[1:]
+	task := s.pending[id]
+	delete(s.pending, id)
+	s.processing[id] = struct{}{}
+	return task, s.gens[id], true
+}
+
+// done 结束一次处理，失败时安排重试，实例空闲后清理 gens
+func (s *Scheduler) done(task ScheduleTask, gen uint64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Processed++
+	delete(s.processing, task.instanceID)
+	// 处理期间有新任务进来，重新排队
+	if _, ok := s.pending[task.instanceID]; ok {
+		s.queue = append(s.queue, task.instanceID)
+		s.cond.Signal()
+	}
+	if err != nil {
+		s.retryLocked(task, gen, err)
+	}
+	s.pruneLocked(task.instanceID)
+}
+
+func (s *Scheduler) pruneLocked(instanceID string) {
+	if _, ok := s.pending[instanceID]; ok {
+		return
+	}
+	if _, ok := s.processing[instanceID]; ok {
+		return
+	}
+	if _, ok := s.timers[instanceID]; ok {
+		return
+	}
+	delete(s.gens, instanceID)
+}
+
+func (s *Scheduler) processNext(ctx context.Context) bool {
+	task, gen, ok := s.next()
+	if !ok {
+		return false
+	}
+	// 已开始的任务不随 ctx 取消中断
+	err := s.handler(context.WithoutCancel(ctx), task)
+	s.done(task, gen, err)
+	return true
+}
+
+func (s *Scheduler) retryLocked(task ScheduleTask, gen uint64, err error) {
+	s.stats.Failed++
+	if s.shuttingDown || s.gens[task.instanceID] != gen {
+		return
+	}
+	task.retry++
+	if task.retry > s.maxRetry {
+		s.stats.DeadLettered++
+		if s.deadLetter != nil {
+			go s.deadLetter(task, err)
+		}
+		return
+	}
+
+	if s.backoff <= 0 {
+		s.stats.Retried++
+		s.addLocked(task)
+		return
+	}
+	delay := s.backoff << (task.retry - 1)
+	// 左移溢出时同样取上限
+	if delay <= 0 || delay > maxBackoff {
+		delay = maxBackoff
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// 等待期间被新的 Push 取消或已关闭，放弃本次重试
+		if s.timers[task.instanceID] != timer {
+			return
+		}
+		delete(s.timers, task.instanceID)
+		s.stats.Retried++
+		s.addLocked(task)
+	})
+	s.timers[task.instanceID] = timer
 }
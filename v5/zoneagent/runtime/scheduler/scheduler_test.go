@@ -0,0 +1,204 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errFail = errors.New("fail")
+
+// recorder 记录 handler 收到的任务，fail 返回对应任务是否失败
+type recorder struct {
+	mu    sync.Mutex
+	tasks []ScheduleTask
+	fail  func(task ScheduleTask) bool
+	seen  chan ScheduleTask
+}
+
+func newRecorder(fail func(task ScheduleTask) bool) *recorder {
+	return &recorder{fail: fail, seen: make(chan ScheduleTask, 100)}
+}
+
+func (r *recorder) handle(ctx context.Context, task ScheduleTask) error {
+	r.mu.Lock()
+	r.tasks = append(r.tasks, task)
+	r.mu.Unlock()
+	r.seen <- task
+	if r.fail != nil && r.fail(task) {
+		return errFail
+	}
+	return nil
+}
+
+func (r *recorder) wait(t *testing.T) ScheduleTask {
+	t.Helper()
+	select {
+	case task := <-r.seen:
+		return task
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for task")
+		return ScheduleTask{}
+	}
+}
+
+func (r *recorder) expectNone(t *testing.T, d time.Duration) {
+	t.Helper()
+	select {
+	case task := <-r.seen:
+		t.Fatalf("unexpected task %+v", task)
+	case <-time.After(d):
+	}
+}
+
+func runScheduler(t *testing.T, s *Scheduler) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx, 2)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func idle(s *Scheduler) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.gens) == 0 && len(s.pending) == 0 && len(s.processing) == 0 && len(s.timers) == 0
+}
+
+func waitIdle(t *testing.T, s *Scheduler) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !idle(s) {
+		if time.Now().After(deadline) {
+			t.Fatalf("scheduler not idle: %+v", s.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSchedulerDedup(t *testing.T) {
+	rec := newRecorder(nil)
+	s := NewScheduler(rec.handle, 3, 0)
+
+	s.Push(NewScheduleTask("i1", "v1", ActionStart))
+	s.Push(NewScheduleTask("i2", "v1", ActionStart))
+	s.Push(NewScheduleTask("i1", "v2", ActionUpgrade))
+	s.Push(NewScheduleTask("i1", "v2", ActionStop))
+	if n := s.Len(); n != 2 {
+		t.Fatalf("queued = %d, want 2", n)
+	}
+	runScheduler(t, s)
+
+	got := map[string]ScheduleTask{}
+	for i := 0; i < 2; i++ {
+		task := rec.wait(t)
+		got[task.InstanceID()] = task
+	}
+	rec.expectNone(t, 20*time.Millisecond)
+	if task := got["i1"]; task.Action() != ActionStop || task.Version() != "v2" {
+		t.Fatalf("i1 handled %+v, want latest stop v2", task)
+	}
+	if _, ok := got["i2"]; !ok {
+		t.Fatal("i2 not handled")
+	}
+	waitIdle(t, s)
+}
+
+func TestSchedulerZeroBackoffRetriesImmediately(t *testing.T) {
+	rec := newRecorder(func(task ScheduleTask) bool { return task.Retry() < 2 })
+	s := NewScheduler(rec.handle, 3, 0)
+	runScheduler(t, s)
+
+	start := time.Now()
+	s.Push(NewScheduleTask("i1", "v1", ActionStart))
+	for want := 0; want < 3; want++ {
+		if task := rec.wait(t); task.Retry() != want {
+			t.Fatalf("attempt retry = %d, want %d", task.Retry(), want)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("zero backoff retries took %s", elapsed)
+	}
+	waitIdle(t, s)
+	if st := s.Stats(); st.Failed != 2 || st.Retried != 2 || st.Processed != 3 {
+		t.Fatalf("stats = %+v", st)
+	}
+}
+
+func TestSchedulerBackoffDoubles(t *testing.T) {
+	rec := newRecorder(func(task ScheduleTask) bool { return task.Retry() < 2 })
+	s := NewScheduler(rec.handle, 3, 20*time.Millisecond)
+	runScheduler(t, s)
+
+	s.Push(NewScheduleTask("i1", "v1", ActionStart))
+	var at []time.Time
+	for i := 0; i < 3; i++ {
+		rec.wait(t)
+		at = append(at, time.Now())
+	}
+	if d := at[1].Sub(at[0]); d < 20*time.Millisecond {
+		t.Fatalf("first retry after %s, want >= 20ms", d)
+	}
+	if d := at[2].Sub(at[1]); d < 40*time.Millisecond {
+		t.Fatalf("second retry after %s, want >= 40ms", d)
+	}
+	waitIdle(t, s)
+}
+
+func TestSchedulerPushCancelsWaitingRetry(t *testing.T) {
+	rec := newRecorder(func(task ScheduleTask) bool { return task.Version() == "v1" })
+	s := NewScheduler(rec.handle, 3, 50*time.Millisecond)
+	runScheduler(t, s)
+
+	s.Push(NewScheduleTask("i1", "v1", ActionStart))
+	rec.wait(t)
+	// 等待第一次失败登记退避
+	deadline := time.Now().Add(time.Second)
+	for s.Stats().Waiting != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("retry not scheduled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	s.Push(NewScheduleTask("i1", "v2", ActionStart))
+	if task := rec.wait(t); task.Version() != "v2" {
+		t.Fatalf("handled %+v, want v2", task)
+	}
+	rec.expectNone(t, 100*time.Millisecond)
+	waitIdle(t, s)
+}
+
+func TestSchedulerDeadLetter(t *testing.T) {
+	rec := newRecorder(func(ScheduleTask) bool { return true })
+	s := NewScheduler(rec.handle, 2, 0)
+	dead := make(chan ScheduleTask, 1)
+	s.OnDeadLetter(func(task ScheduleTask, err error) {
+		if !errors.Is(err, errFail) {
+			t.Errorf("dead letter err = %v", err)
+		}
+		dead <- task
+	})
+	runScheduler(t, s)
+
+	s.Push(NewScheduleTask("i1", "v1", ActionStart))
+	select {
+	case task := <-dead:
+		if task.Retry() != 3 {
+			t.Fatalf("dead letter retry = %d, want 3", task.Retry())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("task not dead-lettered")
+	}
+	waitIdle(t, s)
+	if st := s.Stats(); st.DeadLettered != 1 || st.Processed != 3 {
+		t.Fatalf("stats = %+v", st)
+	}
+}
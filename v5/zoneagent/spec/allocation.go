@@ -0,0 +1,36 @@
+package spec
+
+import (
+	"code/platform/internal/placement"
+	"code/platform/v5/zoneagent/runtime/plugin"
+)
+
+// Allocation 按 spec 声明的资源累计 agent 上插件的占用，实现 placement.AllocationSource。
+// 已分配且进程可能还在的插件都计入，没有 spec 的实例按 0 计
+type Allocation struct {
+	plugins *plugin.Manager
+	specs   Store
+}
+
+var _ placement.AllocationSource = (*Allocation)(nil)
+
+func NewAllocation(plugins *plugin.Manager, specs Store) *Allocation {
+	return &Allocation{plugins: plugins, specs: specs}
+}
+
+func (a *Allocation) Allocated(agentID string) (cpu float64, memory float64) {
+	for _, p := range a.plugins.ListByAgent(agentID) {
+		switch p.Status() {
+		case plugin.StateScheduled, plugin.StateStarting, plugin.StateRunning, plugin.StateStopping:
+		default:
+			continue
+		}
+		s, err := a.specs.Get(p.InstanceID())
+		if err != nil {
+			continue
+		}
+		cpu += s.Resources.CPU
+		memory += s.Resources.Memory
+	}
+	return cpu, memory
+}
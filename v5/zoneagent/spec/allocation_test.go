@@ -0,0 +1,58 @@
+package spec
+
+import (
+	"testing"
+
+	"code/platform/v5/zoneagent/runtime/plugin"
+)
+
+func TestAllocation(t *testing.T) {
+	store := NewMemoryStore()
+	for _, s := range []Spec{
+		{InstanceID: "i1", Version: "v1", Resources: Resources{CPU: 1, Memory: 100}},
+		{InstanceID: "i2", Version: "v1", Resources: Resources{CPU: 2, Memory: 200}},
+		{InstanceID: "i3", Version: "v1", Resources: Resources{CPU: 4, Memory: 400}},
+		{InstanceID: "i5", Version: "v1", Resources: Resources{CPU: 8, Memory: 800}},
+	} {
+		if _, err := store.Put(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plugins := plugin.NewManager(nil)
+	place := func(instanceID string, agentID string, states ...plugin.State) {
+		p, err := plugins.Create(plugin.NewPlugin(instanceID, "v1", "", "").WithAgent(agentID, ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range states {
+			if p, err = plugins.Transition(p.InstanceID(), p.Version(), s, ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	place("i1", "a1", plugin.StateScheduled, plugin.StateRunning)
+	place("i2", "a1", plugin.StateScheduled)
+	// 已停止的不占用
+	place("i3", "a1", plugin.StateScheduled, plugin.StateStopping, plugin.StateStopped)
+	// 没有 spec 的按 0 计
+	place("i4", "a1", plugin.StateScheduled)
+	// 还在等待调度的不占用
+	place("i5", "a2", plugin.StatePending)
+
+	tests := []struct {
+		agentID     string
+		cpu, memory float64
+	}{
+		{"a1", 3, 300},
+		{"a2", 0, 0},
+		{"a3", 0, 0},
+	}
+	alloc := NewAllocation(plugins, store)
+	for _, tt := range tests {
+		cpu, memory := alloc.Allocated(tt.agentID)
+		if cpu != tt.cpu || memory != tt.memory {
+			t.Errorf("Allocated(%s) = %v, %v, want %v, %v", tt.agentID, cpu, memory, tt.cpu, tt.memory)
+		}
+	}
+}
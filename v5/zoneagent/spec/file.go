@@ -0,0 +1,61 @@
+package spec
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// FileStore 以 JSON 文件持久化的存储，每次变更整体重写文件
+type FileStore struct {
+	*MemoryStore
+	path string
+}
+
+// NewFileStore 文件不存在时从空开始
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{MemoryStore: NewMemoryStore(), path: path}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		var specs []Spec
+		if err := json.Unmarshal(data, &specs); err != nil {
+			return nil, err
+		}
+		for _, spec := range specs {
+			s.specs[spec.InstanceID] = spec
+		}
+	}
+	s.persist = s.write
+	return s, nil
+}
+
+// write 先写临时文件再 rename，避免写到一半时进程退出导致文件损坏
+func (s *FileStore) write(specs map[string]Spec) error {
+	list := make([]Spec, 0, len(specs))
+	for _, spec := range specs {
+		list = append(list, spec)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].InstanceID < list[j].InstanceID })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,89 @@
+package spec
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "specs.json")
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Spec{
+		InstanceID: "i1",
+		AppID:      "app",
+		Version:    "v1",
+		Enabled:    true,
+		Resources:  Resources{CPU: 0.5, Memory: 1 << 30},
+		Placement:  Placement{Selector: map[string]string{"zone": "west"}, Preferred: map[string]string{"disk": "ssd"}},
+	}
+	if want, err = s.Put(want); err != nil {
+		t.Fatal(err)
+	}
+	i2, _ := s.Put(Spec{InstanceID: "i2", Version: "v1"})
+	if err := s.Delete("i2", i2.Generation); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := reopened.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("reopened list = %+v, want only i1", list)
+	}
+	got := list[0]
+	if got.InstanceID != want.InstanceID || got.AppID != want.AppID || got.Version != want.Version ||
+		!got.Enabled || got.Resources != want.Resources || got.Generation != want.Generation ||
+		got.Placement.Selector["zone"] != "west" || got.Placement.Preferred["disk"] != "ssd" {
+		t.Fatalf("reopened spec = %+v, want %+v", got, want)
+	}
+	// 重新打开后继续按 generation 更新
+	got.Enabled = false
+	if _, err := reopened.Put(got); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileStoreWriteFailureRollsBack(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileStore(filepath.Join(dir, "specs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Put(Spec{InstanceID: "i1", Version: "v1"}); err != nil {
+		t.Fatal(err)
+	}
+	// 目录被删除后写临时文件失败
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Put(Spec{InstanceID: "i2", Version: "v1"}); err == nil {
+		t.Fatal("put succeeded without a writable directory")
+	}
+	if _, err := s.Get("i2"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("failed put kept in memory: err = %v", err)
+	}
+	if err := s.Delete("i1", 1); err == nil {
+		t.Fatal("delete succeeded without a writable directory")
+	}
+	if _, err := s.Get("i1"); err != nil {
+		t.Fatalf("failed delete removed i1: %v", err)
+	}
+}
+
+func TestFileStoreCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "specs.json")
+	os.WriteFile(path, []byte("{"), 0o644)
+	if _, err := NewFileStore(path); err == nil {
+		t.Fatal("opened a corrupt file")
+	}
+}
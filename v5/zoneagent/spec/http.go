@@ -0,0 +1,116 @@
+package spec
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// NewHandler 期望状态的 HTTP CRUD 接口：
+//
+//	GET    /specs              列表，?watch=true 时以 NDJSON 持续输出变更
+//	GET    /specs/{id}         查询
+//	PUT    /specs/{id}         新建或更新，body 中的 generation 为读到的值，新建为 0
+//	DELETE /specs/{id}?generation=N
+func NewHandler(store Store) http.Handler {
+	h := &handler{store: store}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /specs", h.list)
+	mux.HandleFunc("GET /specs/{id}", h.get)
+	mux.HandleFunc("PUT /specs/{id}", h.put)
+	mux.HandleFunc("DELETE /specs/{id}", h.delete)
+	return mux
+}
+
+type handler struct {
+	store Store
+}
+
+func (h *handler) list(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("watch") == "true" {
+		h.watch(w, r)
+		return
+	}
+	specs, err := h.store.List()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, specs)
+}
+
+func (h *handler) watch(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	events := h.store.Watch(r.Context())
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	enc := json.NewEncoder(w)
+	for ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func (h *handler) get(w http.ResponseWriter, r *http.Request) {
+	spec, err := h.store.Get(r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, spec)
+}
+
+func (h *handler) put(w http.ResponseWriter, r *http.Request) {
+	var spec Spec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	spec.InstanceID = r.PathValue("id")
+	spec, err := h.store.Put(spec)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, spec)
+}
+
+func (h *handler) delete(w http.ResponseWriter, r *http.Request) {
+	generation, err := strconv.ParseInt(r.URL.Query().Get("generation"), 10, 64)
+	if err != nil {
+		http.Error(w, "generation is required", http.StatusBadRequest)
+		return
+	}
+	if err := h.store.Delete(r.PathValue("id"), generation); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, ErrConflict):
+		code = http.StatusConflict
+	case errors.Is(err, ErrInvalid):
+		code = http.StatusBadRequest
+	}
+	http.Error(w, err.Error(), code)
+}
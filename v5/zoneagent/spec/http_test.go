@@ -0,0 +1,111 @@
+package spec
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func do(t *testing.T, srv *httptest.Server, method string, path string, body any) (*http.Response, Spec) {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req, _ := http.NewRequest(method, srv.URL+path, &buf)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var spec Spec
+	if resp.StatusCode == http.StatusOK {
+		json.NewDecoder(resp.Body).Decode(&spec)
+	}
+	return resp, spec
+}
+
+func TestHandler(t *testing.T) {
+	srv := httptest.NewServer(NewHandler(NewMemoryStore()))
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		code   int
+	}{
+		{"get missing", http.MethodGet, "/specs/i1", nil, http.StatusNotFound},
+		{"invalid body", http.MethodPut, "/specs/i1", "not a spec", http.StatusBadRequest},
+		{"missing version", http.MethodPut, "/specs/i1", Spec{}, http.StatusBadRequest},
+		{"create", http.MethodPut, "/specs/i1", Spec{Version: "v1", Enabled: true}, http.StatusOK},
+		{"stale update", http.MethodPut, "/specs/i1", Spec{Version: "v2"}, http.StatusConflict},
+		{"update", http.MethodPut, "/specs/i1", Spec{Version: "v2", Generation: 1}, http.StatusOK},
+		{"get", http.MethodGet, "/specs/i1", nil, http.StatusOK},
+		{"delete without generation", http.MethodDelete, "/specs/i1", nil, http.StatusBadRequest},
+		{"stale delete", http.MethodDelete, "/specs/i1?generation=1", nil, http.StatusConflict},
+		{"delete", http.MethodDelete, "/specs/i1?generation=2", nil, http.StatusNoContent},
+		{"get deleted", http.MethodGet, "/specs/i1", nil, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		resp, spec := do(t, srv, tt.method, tt.path, tt.body)
+		if resp.StatusCode != tt.code {
+			t.Fatalf("%s: status = %d, want %d", tt.name, resp.StatusCode, tt.code)
+		}
+		// id 取自路径
+		if resp.StatusCode == http.StatusOK && spec.InstanceID != "i1" {
+			t.Fatalf("%s: spec = %+v", tt.name, spec)
+		}
+	}
+
+	do(t, srv, http.MethodPut, "/specs/i2", Spec{Version: "v1"})
+	resp, err := srv.Client().Get(srv.URL + "/specs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var list []Spec
+	json.NewDecoder(resp.Body).Decode(&list)
+	if len(list) != 1 || list[0].InstanceID != "i2" {
+		t.Fatalf("list = %+v", list)
+	}
+}
+
+func TestHandlerWatch(t *testing.T) {
+	srv := httptest.NewServer(NewHandler(NewMemoryStore()))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/specs?watch=true", nil)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("content type = %q", ct)
+	}
+
+	// 响应头返回时订阅已建立
+	do(t, srv, http.MethodPut, "/specs/i1", Spec{Version: "v1"})
+	do(t, srv, http.MethodDelete, "/specs/i1?generation=1", nil)
+	scanner := bufio.NewScanner(resp.Body)
+	for _, want := range []EventType{EventPut, EventDelete} {
+		if !scanner.Scan() {
+			t.Fatalf("stream ended before %s: %v", want, scanner.Err())
+		}
+		var ev Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.Type != want || ev.Spec.InstanceID != "i1" {
+			t.Fatalf("event = %+v, want %s i1", ev, want)
+		}
+	}
+}
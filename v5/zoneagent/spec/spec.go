@@ -0,0 +1,261 @@
+package spec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"code/platform/internal/placement"
+	"code/platform/internal/reconcile"
+)
+
+var (
+	ErrNotFound = errors.New("spec: not found")
+	// 写入时携带的 generation 与当前不一致
+	ErrConflict = errors.New("spec: generation conflict")
+	ErrInvalid  = errors.New("spec: invalid spec")
+)
+
+type Resources struct {
+	// 核数
+	CPU float64 `json:"cpu"`
+	// 字节
+	Memory float64 `json:"memory"`
+}
+
+type Placement struct {
+	Selector  map[string]string `json:"selector,omitempty"`
+	Preferred map[string]string `json:"preferred,omitempty"`
+}
+
+// Spec 插件实例的期望状态
+type Spec struct {
+	InstanceID string    `json:"instance_id"`
+	AppID      string    `json:"app_id"`
+	Version    string    `json:"version"`
+	Enabled    bool      `json:"enabled"`
+	Resources  Resources `json:"resources"`
+	Placement  Placement `json:"placement"`
+	// 由存储维护，每次修改加一；写入时需携带读到的值，新建时为 0
+	Generation int64 `json:"generation"`
+}
+
+// Request 转为调度的资源需求和约束
+func (s Spec) Request() placement.Request {
+	return placement.Request{
+		InstanceID: s.InstanceID,
+		AppID:      s.AppID,
+		CPU:        s.Resources.CPU,
+		Memory:     s.Resources.Memory,
+		Selector:   s.Placement.Selector,
+		Preferred:  s.Placement.Preferred,
+	}
+}
+
+func (s Spec) validate() error {
+	if s.InstanceID == "" || s.Version == "" {
+		return fmt.Errorf("%w: instance_id and version are required", ErrInvalid)
+	}
+	return nil
+}
+
+type EventType string
+
+const (
+	EventPut    EventType = "put"
+	EventDelete EventType = "delete"
+)
+
+type Event struct {
+	Type EventType `json:"type"`
+	Spec Spec      `json:"spec"`
+}
+
+// Store 插件实例期望状态的存储
+type Store interface {
+	Get(instanceID string) (Spec, error)
+	List() ([]Spec, error)
+	// Put 新建或更新，spec.Generation 必须等于当前值（新建为 0），返回写入后的 spec
+	Put(spec Spec) (Spec, error)
+	// Delete generation 必须等于当前值
+	Delete(instanceID string, generation int64) error
+	// Watch 返回之后发生的变更，ctx 结束时关闭。消费过慢时通道被关闭，需要重新 List 后再 Watch
+	Watch(ctx context.Context) <-chan Event
+}
+
+// Source 把 Store 中启用的实例作为 reconciler 的期望状态
+func Source(store Store) reconcile.Source {
+	return reconcile.SourceFunc(func(ctx context.Context) ([]reconcile.Desired, error) {
+		specs, err := store.List()
+		if err != nil {
+			return nil, err
+		}
+		var desired []reconcile.Desired
+		for _, s := range specs {
+			if !s.Enabled {
+				continue
+			}
+			desired = append(desired, reconcile.Desired{InstanceID: s.InstanceID, Version: s.Version, AppID: s.AppID})
+		}
+		return desired, nil
+	})
+}
+
+const watchBuffer = 64
+
+// MemoryStore 进程内存储
+type MemoryStore struct {
+	mu    sync.RWMutex
+	specs map[string]Spec // key instanceID
+	// val 在订阅被移除时关闭，结束等待 ctx 的 goroutine
+	watchers map[chan Event]chan struct{}
+	// 变更提交前调用，返回错误时放弃本次变更，FileStore 用它落盘
+	persist func(specs map[string]Spec) error
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		specs:    make(map[string]Spec),
+		watchers: make(map[chan Event]chan struct{}),
+	}
+}
+
+func (s *MemoryStore) Get(instanceID string) (Spec, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	spec, ok := s.specs[instanceID]
+	if !ok {
+		return Spec{}, fmt.Errorf("%w: %s", ErrNotFound, instanceID)
+	}
+	return copySpec(spec), nil
+}
+
+func (s *MemoryStore) List() ([]Spec, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	specs := make([]Spec, 0, len(s.specs))
+	for _, spec := range s.specs {
+		specs = append(specs, copySpec(spec))
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].InstanceID < specs[j].InstanceID })
+	return specs, nil
+}
+
+func (s *MemoryStore) Put(spec Spec) (Spec, error) {
+	if err := spec.validate(); err != nil {
+		return Spec{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, ok := s.specs[spec.InstanceID]
+	if (!ok && spec.Generation != 0) || (ok && cur.Generation != spec.Generation) {
+		return Spec{}, fmt.Errorf("%w: %s", ErrConflict, spec.InstanceID)
+	}
+	spec = copySpec(spec)
+	spec.Generation++
+	if err := s.commitLocked(spec.InstanceID, &spec); err != nil {
+		return Spec{}, err
+	}
+	s.notifyLocked(Event{Type: EventPut, Spec: copySpec(spec)})
+	return copySpec(spec), nil
+}
+
+func (s *MemoryStore) Delete(instanceID string, generation int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, ok := s.specs[instanceID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, instanceID)
+	}
+	if cur.Generation != generation {
+		return fmt.Errorf("%w: %s", ErrConflict, instanceID)
+	}
+	if err := s.commitLocked(instanceID, nil); err != nil {
+		return err
+	}
+	s.notifyLocked(Event{Type: EventDelete, Spec: cur})
+	return nil
+}
+
+func (s *MemoryStore) Watch(ctx context.Context) <-chan Event {
+	ch := make(chan Event, watchBuffer)
+	dropped := make(chan struct{})
+	s.mu.Lock()
+	s.watchers[ch] = dropped
+	s.mu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-dropped:
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.unwatchLocked(ch)
+	}()
+	return ch
+}
+
+// unwatchLocked 移除订阅并关闭通道，已移除时忽略
+func (s *MemoryStore) unwatchLocked(ch chan Event) {
+	dropped, ok := s.watchers[ch]
+	if !ok {
+		return
+	}
+	delete(s.watchers, ch)
+	close(dropped)
+	close(ch)
+}
+
+// commitLocked spec 为空表示删除
+func (s *MemoryStore) commitLocked(instanceID string, spec *Spec) error {
+	prev, existed := s.specs[instanceID]
+	if spec == nil {
+		delete(s.specs, instanceID)
+	} else {
+		s.specs[instanceID] = *spec
+	}
+	if s.persist == nil {
+		return nil
+	}
+	if err := s.persist(s.specs); err != nil {
+		if existed {
+			s.specs[instanceID] = prev
+		} else {
+			delete(s.specs, instanceID)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *MemoryStore) notifyLocked(ev Event) {
+	for ch := range s.watchers {
+		select {
+		case ch <- ev:
+		default:
+			// 消费过慢，关闭通道让调用方重新同步
+			s.unwatchLocked(ch)
+		}
+	}
+}
+
+func copySpec(s Spec) Spec {
+	s.Placement.Selector = copyLabels(s.Placement.Selector)
+	s.Placement.Preferred = copyLabels(s.Placement.Preferred)
+	return s
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+	c := make(map[string]string, len(labels))
+	for k, v := range labels {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,120 @@
+package spec
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore()
+	if _, err := s.Put(Spec{InstanceID: "i1"}); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("put without version: err = %v, want ErrInvalid", err)
+	}
+	if _, err := s.Put(Spec{InstanceID: "i1", Version: "v1", Generation: 3}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("create with generation: err = %v, want ErrConflict", err)
+	}
+
+	labels := map[string]string{"zone": "west"}
+	created, err := s.Put(Spec{InstanceID: "i1", Version: "v1", Placement: Placement{Selector: labels}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Generation != 1 {
+		t.Fatalf("generation = %d, want 1", created.Generation)
+	}
+	// 返回值和存储互不影响
+	labels["zone"] = "east"
+	created.Placement.Selector["zone"] = "north"
+	got, err := s.Get("i1")
+	if err != nil || got.Placement.Selector["zone"] != "west" {
+		t.Fatalf("get = %+v, %v, want selector zone=west", got, err)
+	}
+
+	if _, err := s.Put(Spec{InstanceID: "i1", Version: "v2"}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("stale put: err = %v, want ErrConflict", err)
+	}
+	got.Version = "v2"
+	updated, err := s.Put(got)
+	if err != nil || updated.Generation != 2 {
+		t.Fatalf("update = %+v, %v, want generation 2", updated, err)
+	}
+	s.Put(Spec{InstanceID: "i0", Version: "v1"})
+	list, _ := s.List()
+	if len(list) != 2 || list[0].InstanceID != "i0" || list[1].Version != "v2" {
+		t.Fatalf("list = %+v", list)
+	}
+
+	if err := s.Delete("i1", 1); !errors.Is(err, ErrConflict) {
+		t.Fatalf("stale delete: err = %v, want ErrConflict", err)
+	}
+	if err := s.Delete("i1", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("i1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get deleted: err = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete("i1", 2); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("delete twice: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryStoreWatch(t *testing.T) {
+	s := NewMemoryStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	events := s.Watch(ctx)
+
+	sp, _ := s.Put(Spec{InstanceID: "i1", Version: "v1"})
+	s.Delete("i1", sp.Generation)
+	for _, want := range []EventType{EventPut, EventDelete} {
+		select {
+		case ev := <-events:
+			if ev.Type != want || ev.Spec.InstanceID != "i1" {
+				t.Fatalf("event = %+v, want %s i1", ev, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no %s event", want)
+		}
+	}
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatal("unexpected event after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed after cancel")
+	}
+}
+
+func TestMemoryStoreDropsSlowWatcher(t *testing.T) {
+	s := NewMemoryStore()
+	before := runtime.NumGoroutine()
+	// ctx 不结束，订阅只会因为消费过慢被移除
+	events := s.Watch(context.Background())
+	for i := 0; i <= watchBuffer; i++ {
+		sp, _ := s.Get("i1")
+		if _, err := s.Put(Spec{InstanceID: "i1", Version: "v1", Generation: sp.Generation}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n := 0
+	for range events {
+		n++
+	}
+	if n != watchBuffer {
+		t.Fatalf("received %d events before close, want %d", n, watchBuffer)
+	}
+
+	// 等待 ctx 的 goroutine 随订阅一起退出
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines = %d, want %d after the watcher was dropped", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package supervisor
+
+import (
+	"os"
+	"os/exec"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// 没有进程组和 SIGTERM，直接结束
+func terminate(p *os.Process) error {
+	return p.Kill()
+}
+
+func kill(p *os.Process) error {
+	return p.Kill()
+}
@@ -0,0 +1,54 @@
+package supervisor
+
+import (
+	"sync"
+	"time"
+)
+
+// cpuSample 进程上一次采样时的累计 CPU 时间
+type cpuSample struct {
+	cpu time.Duration
+	at  time.Time
+}
+
+// sampler 采样进程的 CPU 和内存，CPU 为两次采样之间平均占用的核数，首次采样为 0
+type sampler struct {
+	mu   sync.Mutex
+	last map[int]cpuSample // key pid
+}
+
+func newSampler() *sampler {
+	return &sampler{last: make(map[int]cpuSample)}
+}
+
+// sample 汇总一组进程的 CPU 核数和常驻内存字节数，已退出的进程忽略。
+// 不在 pids 中的进程的上次采样被丢弃
+func (s *sampler) sample(pids [][]int) (cpu []float64, memory []float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	cpu = make([]float64, len(pids))
+	memory = make([]float64, len(pids))
+	seen := make(map[int]bool)
+	for i, group := range pids {
+		for _, pid := range group {
+			total, rss, err := readStat(pid)
+			if err != nil {
+				continue
+			}
+			seen[pid] = true
+			memory[i] += rss
+			// pid 被复用时累计时间会变小，视为首次采样
+			if last, ok := s.last[pid]; ok && total >= last.cpu && now.After(last.at) {
+				cpu[i] += float64(total-last.cpu) / float64(now.Sub(last.at))
+			}
+			s.last[pid] = cpuSample{cpu: total, at: now}
+		}
+	}
+	for pid := range s.last {
+		if !seen[pid] {
+			delete(s.last, pid)
+		}
+	}
+	return cpu, memory
+}
@@ -0,0 +1,45 @@
+//go:build linux
+
+package supervisor
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// /proc 中的 CPU 时间以 USER_HZ 为单位，Linux 上固定为 100
+const clockTicks = 100
+
+// readStat 从 /proc/{pid}/stat 读取累计 CPU 时间和常驻内存字节数
+func readStat(pid int) (cpu time.Duration, rss float64, err error) {
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return 0, 0, err
+	}
+	// 进程名可能包含空格和括号，从最后一个 ')' 之后开始按空格切分，第一个字段为 state
+	i := strings.LastIndexByte(string(data), ')')
+	if i < 0 {
+		return 0, 0, fmt.Errorf("supervisor: malformed /proc/%d/stat", pid)
+	}
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 22 {
+		return 0, 0, fmt.Errorf("supervisor: malformed /proc/%d/stat", pid)
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	pages, err := strconv.ParseUint(fields[21], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	cpu = time.Duration(utime+stime) * time.Second / clockTicks
+	return cpu, float64(pages) * float64(os.Getpagesize()), nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package supervisor
+
+import (
+	"errors"
+	"time"
+)
+
+// 没有 /proc，不采样
+func readStat(pid int) (time.Duration, float64, error) {
+	return 0, 0, errors.ErrUnsupported
+}
@@ -0,0 +1,140 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var ErrSpecNotFound = errors.New("supervisor: spec not found")
+
+// ProcessSpec 一个需要常驻的进程
+type ProcessSpec struct {
+	// 同一插件内唯一，用于日志文件名
+	Name    string   `json:"name"`
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+	Dir     string   `json:"dir,omitempty"`
+	// 追加到 agent 自身环境变量之后
+	Env []string `json:"env,omitempty"`
+}
+
+// PluginSpec 插件在 agent 上运行的全部进程，第一个进程的 pid 作为插件 pid 上报
+type PluginSpec struct {
+	InstanceID string        `json:"instance_id"`
+	Version    string        `json:"version"`
+	Processes  []ProcessSpec `json:"processes"`
+}
+
+func (s PluginSpec) validate() error {
+	if len(s.Processes) == 0 {
+		return fmt.Errorf("supervisor: %s/%s has no process", s.InstanceID, s.Version)
+	}
+	names := make(map[string]bool, len(s.Processes))
+	for _, p := range s.Processes {
+		if p.Name == "" || p.Command == "" {
+			return fmt.Errorf("supervisor: %s/%s: process name and command are required", s.InstanceID, s.Version)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("supervisor: %s/%s: duplicate process %q", s.InstanceID, s.Version, p.Name)
+		}
+		names[p.Name] = true
+	}
+	return nil
+}
+
+// HostConfig 插件宿主进程的启动参数，对应 k8s 部署中 host 容器的命令行
+type HostConfig struct {
+	// host 可执行文件，例如 /usr/local/plugin-host-pkg/nodejs/v1.0/bin/host
+	Binary          string
+	ConfPath        string
+	HostID          string
+	HostTimeoutSec  int
+	PlatformAddress string
+	PluginPath      string
+}
+
+// HostProcess 插件宿主进程
+func HostProcess(c HostConfig) ProcessSpec {
+	return ProcessSpec{
+		Name:    "host",
+		Command: c.Binary,
+		Args: []string{
+			"--conf_path=" + c.ConfPath,
+			"--host_id=" + c.HostID,
+			"--host_timeout_sec=" + strconv.Itoa(c.HostTimeoutSec),
+			"--platform_address=" + c.PlatformAddress,
+			"--plugin_path=" + c.PluginPath,
+		},
+	}
+}
+
+// StandaloneConfig 独立服务进程的启动参数，对应 k8s 部署中 standalonesvc 容器的命令行
+type StandaloneConfig struct {
+	PluginPath string
+	Port       int
+	Args       string
+	MySQL      string
+	Volume     string
+	Secret     string
+}
+
+// StandaloneProcess 在插件 workspace 下执行 start.sh。
+// start.sh 拉起服务后即退出，因此与 k8s 中一样之后 sleep 常驻，停止时按进程组结束
+func StandaloneProcess(c StandaloneConfig) ProcessSpec {
+	start := strings.Join([]string{
+		"sh start.sh start",
+		"--port=" + strconv.Itoa(c.Port),
+		"--args=" + shellQuote(c.Args),
+		"--mysql=" + shellQuote(c.MySQL),
+		"--volume=" + shellQuote(c.Volume),
+		"--secret=" + shellQuote(c.Secret),
+	}, " ")
+	return ProcessSpec{
+		Name:    "standalone",
+		Command: "/bin/bash",
+		Args:    []string{"-c", start + " && exec sleep infinity"},
+		Dir:     filepath.Join(c.PluginPath, "workspace"),
+	}
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Resolver 查询插件的进程规格
+type Resolver interface {
+	Resolve(instanceID string, version string) (PluginSpec, error)
+}
+
+// ResolverFunc 函数形式的 Resolver
+type ResolverFunc func(instanceID string, version string) (PluginSpec, error)
+
+func (f ResolverFunc) Resolve(instanceID string, version string) (PluginSpec, error) {
+	return f(instanceID, version)
+}
+
+// DirResolver 从 {dir}/{instanceID}/{version}.json 读取规格
+type DirResolver string
+
+func (d DirResolver) Resolve(instanceID string, version string) (PluginSpec, error) {
+	path := filepath.Join(string(d), filepath.Base(instanceID), filepath.Base(version)+".json")
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return PluginSpec{}, fmt.Errorf("%w: %s/%s", ErrSpecNotFound, instanceID, version)
+	}
+	if err != nil {
+		return PluginSpec{}, err
+	}
+	var spec PluginSpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return PluginSpec{}, fmt.Errorf("supervisor: %s: %w", path, err)
+	}
+	spec.InstanceID = instanceID
+	spec.Version = version
+	return spec, nil
+}
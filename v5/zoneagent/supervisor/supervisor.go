@@ -0,0 +1,388 @@
+// Package supervisor 在 zone agent 所在机器上直接以进程运行插件，不依赖 Kubernetes：
+// 按规格拉起宿主和独立服务进程，收集输出，记录 pid，崩溃后按退避重启
+package supervisor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code/platform/v5/zoneagent/api"
+	"code/platform/v5/zoneagent/runtime/plugin"
+)
+
+// Config 为零值的字段使用默认值
+type Config struct {
+	Resolver Resolver
+	// 进程输出写到 {LogDir}/{instanceID}_{version}_{name}.log，为空时写入 agent 自身日志
+	LogDir string
+	// 首次重启前的等待，之后每次翻倍，默认 1s，最长 MaxBackoff，默认 1m
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// 连续崩溃超过该次数后不再重启，插件上报为 failed 交给 manager 重新调度。
+	// 默认 5，小于 0 表示一直重启
+	MaxRestarts int
+	// 运行超过该时间视为稳定，连续崩溃计数清零，默认 1m
+	StableAfter time.Duration
+	// 停止时发送 SIGTERM 后等待退出的时间，超时后 SIGKILL，默认 10s
+	StopTimeout time.Duration
+}
+
+func (c *Config) defaults() {
+	if c.Backoff == 0 {
+		c.Backoff = time.Second
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = time.Minute
+	}
+	if c.MaxRestarts == 0 {
+		c.MaxRestarts = 5
+	}
+	if c.StableAfter == 0 {
+		c.StableAfter = time.Minute
+	}
+	if c.StopTimeout == 0 {
+		c.StopTimeout = 10 * time.Second
+	}
+}
+
+type process struct {
+	spec ProcessSpec
+	// 以下字段由 Supervisor.mu 保护
+	pid    int
+	status string
+	reason string
+}
+
+type instance struct {
+	spec   PluginSpec
+	procs  []*process
+	cancel context.CancelFunc
+	// 所有进程的 goroutine 退出后关闭
+	done chan struct{}
+	// 由 Supervisor.mu 保护。停止中的实例在进程退出后才移除
+	stopping bool
+}
+
+// Supervisor 实现 node.Processes
+type Supervisor struct {
+	config Config
+
+	sampler *sampler
+
+	mu        sync.Mutex
+	instances map[string]*instance // key plugin.Key
+}
+
+func New(config Config) *Supervisor {
+	config.defaults()
+	return &Supervisor{config: config, sampler: newSampler(), instances: make(map[string]*instance)}
+}
+
+// Start 按规格拉起插件的全部进程，已在运行时直接返回。
+// 正在停止时先等待进程退出，避免同时运行两份
+func (s *Supervisor) Start(ctx context.Context, instanceID string, version string) error {
+	key := plugin.Key(instanceID, version)
+	if running, err := s.waitStopped(ctx, key); running || err != nil {
+		return err
+	}
+
+	spec, err := s.config.Resolver.Resolve(instanceID, version)
+	if err != nil {
+		return err
+	}
+	spec.InstanceID = instanceID
+	spec.Version = version
+	if err := spec.validate(); err != nil {
+		return err
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	inst := &instance{spec: spec, cancel: cancel, done: make(chan struct{})}
+	for _, ps := range spec.Processes {
+		inst.procs = append(inst.procs, &process{spec: ps, status: api.StatusStarting})
+	}
+	s.mu.Lock()
+	if _, ok := s.instances[key]; ok {
+		s.mu.Unlock()
+		cancel()
+		return nil
+	}
+	s.instances[key] = inst
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, p := range inst.procs {
+		wg.Add(1)
+		go func(p *process) {
+			defer wg.Done()
+			s.supervise(runCtx, inst, p)
+		}(p)
+	}
+	go func() {
+		wg.Wait()
+		s.mu.Lock()
+		if inst.stopping {
+			s.remove(key, inst)
+		}
+		s.mu.Unlock()
+		close(inst.done)
+	}()
+	return nil
+}
+
+// waitStopped 等待正在停止的实例退出，实例仍在运行时返回 true
+func (s *Supervisor) waitStopped(ctx context.Context, key string) (bool, error) {
+	for {
+		s.mu.Lock()
+		inst, ok := s.instances[key]
+		stopping := ok && inst.stopping
+		s.mu.Unlock()
+		if !ok {
+			return false, nil
+		}
+		if !stopping {
+			return true, nil
+		}
+		select {
+		case <-inst.done:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+}
+
+// Stop 结束插件的全部进程，等待退出或 ctx 结束。ctx 先结束时实例仍在停止，进程退出后移除
+func (s *Supervisor) Stop(ctx context.Context, instanceID string, version string) error {
+	key := plugin.Key(instanceID, version)
+	s.mu.Lock()
+	inst, ok := s.instances[key]
+	if ok {
+		inst.stopping = true
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	inst.cancel()
+	select {
+	case <-inst.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	// 进程已全部放弃重启的实例不会再经过退出处理，这里移除
+	s.mu.Lock()
+	s.remove(key, inst)
+	s.mu.Unlock()
+	return nil
+}
+
+// remove 调用方持有 s.mu，实例已被替换时不删除
+func (s *Supervisor) remove(key string, inst *instance) {
+	if s.instances[key] == inst {
+		delete(s.instances, key)
+	}
+}
+
+// Close 停止所有插件
+func (s *Supervisor) Close() {
+	s.mu.Lock()
+	instances := make(map[string]*instance, len(s.instances))
+	for key, inst := range s.instances {
+		inst.stopping = true
+		instances[key] = inst
+	}
+	s.mu.Unlock()
+	for _, inst := range instances {
+		inst.cancel()
+	}
+	for key, inst := range instances {
+		<-inst.done
+		s.mu.Lock()
+		s.remove(key, inst)
+		s.mu.Unlock()
+	}
+}
+
+// List 各插件的状态：有进程放弃重启为 failed，全部运行为 running，否则为 starting。
+// pid 为第一个进程的 pid，CPU 和内存为插件全部进程之和
+func (s *Supervisor) List() []api.PluginReport {
+	s.mu.Lock()
+	reports := make([]api.PluginReport, 0, len(s.instances))
+	pids := make([][]int, 0, len(s.instances))
+	for _, inst := range s.instances {
+		pr := api.PluginReport{
+			InstanceID: inst.spec.InstanceID,
+			Version:    inst.spec.Version,
+			Status:     api.StatusRunning,
+		}
+		if pid := inst.procs[0].pid; pid > 0 {
+			pr.PID = strconv.Itoa(pid)
+		}
+		for _, p := range inst.procs {
+			switch {
+			case p.status == api.StatusFailed:
+				pr.Status, pr.Reason = api.StatusFailed, p.spec.Name+": "+p.reason
+			case p.status != api.StatusRunning && pr.Status == api.StatusRunning:
+				pr.Status, pr.Reason = api.StatusStarting, p.spec.Name+": "+p.reason
+			}
+		}
+		var group []int
+		for _, p := range inst.procs {
+			if p.pid > 0 {
+				group = append(group, p.pid)
+			}
+		}
+		reports = append(reports, pr)
+		pids = append(pids, group)
+	}
+	s.mu.Unlock()
+
+	cpu, memory := s.sampler.sample(pids)
+	for i := range reports {
+		reports[i].CPU, reports[i].Memory = cpu[i], memory[i]
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return plugin.Key(reports[i].InstanceID, reports[i].Version) < plugin.Key(reports[j].InstanceID, reports[j].Version)
+	})
+	return reports
+}
+
+// supervise 运行进程直到 ctx 结束，异常退出后按退避重启
+func (s *Supervisor) supervise(ctx context.Context, inst *instance, p *process) {
+	failures := 0
+	backoff := s.config.Backoff
+	for {
+		started := time.Now()
+		err := s.runOnce(ctx, inst, p)
+		if ctx.Err() != nil {
+			s.setStatus(p, 0, api.StatusStopped, "stopped")
+			return
+		}
+		if time.Since(started) >= s.config.StableAfter {
+			failures = 0
+			backoff = s.config.Backoff
+		}
+		failures++
+		reason := exitReason(err)
+		log.Printf("supervisor: %s/%s %s: %s", inst.spec.InstanceID, inst.spec.Version, p.spec.Name, reason)
+		if s.config.MaxRestarts > 0 && failures > s.config.MaxRestarts {
+			s.setStatus(p, 0, api.StatusFailed, fmt.Sprintf("%s, gave up after %d restarts", reason, s.config.MaxRestarts))
+			return
+		}
+		s.setStatus(p, 0, api.StatusStarting, fmt.Sprintf("%s, restarting in %s", reason, backoff))
+
+		select {
+		case <-ctx.Done():
+			s.setStatus(p, 0, api.StatusStopped, "stopped")
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, s.config.MaxBackoff)
+	}
+}
+
+// runOnce 启动进程并等待退出；ctx 结束时先 SIGTERM，超时后 SIGKILL
+func (s *Supervisor) runOnce(ctx context.Context, inst *instance, p *process) error {
+	out, err := s.output(inst.spec, p.spec)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	cmd := exec.Command(p.spec.Command, p.spec.Args...)
+	cmd.Dir = p.spec.Dir
+	cmd.Env = append(os.Environ(), p.spec.Env...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	// 输出管道被残留的后代进程占用时不无限等待
+	cmd.WaitDelay = s.config.StopTimeout
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	s.setStatus(p, cmd.Process.Pid, api.StatusRunning, "")
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	select {
+	case err := <-exited:
+		return err
+	case <-ctx.Done():
+	}
+	terminate(cmd.Process)
+	select {
+	case err := <-exited:
+		return err
+	case <-time.After(s.config.StopTimeout):
+	}
+	kill(cmd.Process)
+	return <-exited
+}
+
+func (s *Supervisor) setStatus(p *process, pid int, status string, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p.pid = pid
+	p.status = status
+	p.reason = reason
+}
+
+// output 进程 stdout/stderr 的去向
+func (s *Supervisor) output(spec PluginSpec, ps ProcessSpec) (io.WriteCloser, error) {
+	if s.config.LogDir == "" {
+		return &logWriter{prefix: fmt.Sprintf("[%s/%s %s] ", spec.InstanceID, spec.Version, ps.Name)}, nil
+	}
+	name := strings.NewReplacer("/", "_", string(filepath.Separator), "_").Replace(
+		fmt.Sprintf("%s_%s_%s.log", spec.InstanceID, spec.Version, ps.Name))
+	return os.OpenFile(filepath.Join(s.config.LogDir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+}
+
+func exitReason(err error) string {
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return "exited"
+	case errors.As(err, &exitErr):
+		return exitErr.ProcessState.String()
+	}
+	return err.Error()
+}
+
+// logWriter 按行写入标准日志
+type logWriter struct {
+	prefix string
+	buf    []byte
+}
+
+func (w *logWriter) Write(data []byte) (int, error) {
+	w.buf = append(w.buf, data...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		log.Print(w.prefix + string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(data), nil
+}
+
+func (w *logWriter) Close() error {
+	if len(w.buf) > 0 {
+		log.Print(w.prefix + string(w.buf))
+		w.buf = nil
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package supervisor
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"code/platform/v5/zoneagent/api"
+	"code/platform/v5/zoneagent/runtime/plugin"
+)
+
+// shell 以单个 sh 进程运行 script 的插件规格
+func shell(script string) Resolver {
+	return ResolverFunc(func(instanceID string, version string) (PluginSpec, error) {
+		return PluginSpec{Processes: []ProcessSpec{{Name: "main", Command: "/bin/sh", Args: []string{"-c", script}}}}, nil
+	})
+}
+
+func waitReport(t *testing.T, s *Supervisor, cond func(api.PluginReport) bool) api.PluginReport {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		for _, pr := range s.List() {
+			if cond(pr) {
+				return pr
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no matching report in %+v", s.List())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestListSamplesProcesses(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("sampling reads /proc")
+	}
+	s := New(Config{Resolver: shell("while :; do :; done")})
+	defer s.Close()
+	if err := s.Start(context.Background(), "i1", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	waitReport(t, s, func(pr api.PluginReport) bool { return pr.Status == api.StatusRunning })
+
+	time.Sleep(200 * time.Millisecond)
+	pr := waitReport(t, s, func(pr api.PluginReport) bool { return pr.CPU > 0 })
+	if pr.CPU < 0.2 || pr.CPU > float64(runtime.NumCPU())+0.5 {
+		t.Fatalf("cpu = %.2f cores for a busy loop", pr.CPU)
+	}
+	if pr.Memory <= 0 {
+		t.Fatalf("memory = %v, want resident bytes", pr.Memory)
+	}
+}
+
+func TestStartWaitsForStop(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs /bin/sh and SIGTERM")
+	}
+	// 忽略 SIGTERM，停止要等到 StopTimeout 后 SIGKILL
+	s := New(Config{Resolver: shell("trap '' TERM; while :; do sleep 0.01; done"), StopTimeout: 300 * time.Millisecond})
+	defer s.Close()
+	ctx := context.Background()
+	if err := s.Start(ctx, "i1", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	first := waitReport(t, s, func(pr api.PluginReport) bool { return pr.Status == api.StatusRunning })
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- s.Stop(ctx, "i1", "v1") }()
+	deadline := time.Now().Add(5 * time.Second)
+	for !stopping(s, plugin.Key("i1", "v1")) {
+		if time.Now().After(deadline) {
+			t.Fatal("instance not stopping")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := s.Start(ctx, "i1", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	// 进程已被回收，signal 0 失败
+	pid, _ := strconv.Atoi(first.PID)
+	if p, err := os.FindProcess(pid); err == nil && p.Signal(syscall.Signal(0)) == nil {
+		t.Fatalf("Start returned while the previous process %d is alive", pid)
+	}
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+	second := waitReport(t, s, func(pr api.PluginReport) bool { return pr.Status == api.StatusRunning })
+	if second.PID == first.PID {
+		t.Fatalf("pid %s unchanged, want a new process", second.PID)
+	}
+	if reports := s.List(); len(reports) != 1 {
+		t.Fatalf("reports = %+v, want one instance", reports)
+	}
+}
+
+func stopping(s *Supervisor, key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst, ok := s.instances[key]
+	return ok && inst.stopping
+}
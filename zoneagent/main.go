@@ -1,5 +1,53 @@
 package main
 
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	goruntime "runtime"
+	"strconv"
+	"syscall"
+	"time"
+
+	"code/platform/v5/zoneagent/api"
+	"code/platform/v5/zoneagent/node"
+	"code/platform/v5/zoneagent/supervisor"
+)
+
 func main() {
+	hostname, _ := os.Hostname()
+	manager := flag.String("manager", "http://127.0.0.1:8080", "zonemanager 地址")
+	agentID := flag.String("id", hostname, "agent id")
+	agentIP := flag.String("ip", "127.0.0.1", "agent 对外地址")
+	cpu := flag.Float64("cpu", float64(goruntime.NumCPU()), "可分配的 cpu 核数")
+	memory := flag.Float64("memory", 0, "可分配的内存字节数")
+	specDir := flag.String("specs", "/data/plugin/specs", "插件进程规格目录，{instanceID}/{version}.json")
+	logDir := flag.String("logs", "", "插件输出目录，为空时写入 agent 日志")
+	interval := flag.Duration("interval", 10*time.Second, "默认上报间隔")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	procs := supervisor.New(supervisor.Config{
+		Resolver: supervisor.DirResolver(*specDir),
+		LogDir:   *logDir,
+	})
+	defer procs.Close()
+
+	client := api.NewClient(*manager, nil)
+	agent := node.New(*agentID, client, procs, api.RegisterRequest{
+		IP:     *agentIP,
+		CPU:    *cpu,
+		Memory: *memory,
+	}, *interval)
+	agent.SetSelfMetric(func() api.Process {
+		return api.Process{PID: strconv.Itoa(os.Getpid())}
+	})
 
+	log.Printf("zoneagent %s: connecting to %s", *agentID, *manager)
+	agent.Run(ctx)
+	log.Printf("zoneagent %s: stopping plugins", *agentID)
 }
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.etcd.io/etcd/clientv3"
+
+	"code/platform/v5/lock"
+	"code/platform/v5/lock/etcdkv"
+	"code/platform/v5/zoneagent/manager"
+	"code/platform/v5/zoneagent/spec"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "agent 接口、/specs 和 /metrics 的监听地址")
+	specFile := flag.String("specs", "/data/plugin/specs.json", "插件实例期望状态文件，为空时只保存在内存")
+	agentTTL := flag.Duration("agent-ttl", 30*time.Second, "agent 超过该时间没有上报视为失联")
+	reconcileInterval := flag.Duration("reconcile-interval", 30*time.Second, "期望状态对账间隔")
+	etcd := flag.String("etcd", "", "etcd 地址，逗号分隔；非空时运行时行锁由各副本经 etcd 租约互斥，为空时为进程内的锁")
+	lockTTL := flag.Duration("lock-ttl", 10*time.Second, "行锁会话租约时长，进程异常退出后锁在该时间内释放")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var specs spec.Store = spec.NewMemoryStore()
+	if *specFile != "" {
+		store, err := spec.NewFileStore(*specFile)
+		if err != nil {
+			log.Fatalf("zonemanager: load specs from %s: %v", *specFile, err)
+		}
+		specs = store
+	}
+
+	var locker lock.Locker
+	if *etcd != "" {
+		client, err := clientv3.New(clientv3.Config{
+			Endpoints:   strings.Split(*etcd, ","),
+			DialTimeout: 5 * time.Second,
+		})
+		if err != nil {
+			log.Fatalf("zonemanager: connect etcd %s: %v", *etcd, err)
+		}
+		defer client.Close()
+		hostname, _ := os.Hostname()
+		table, err := lock.NewLeaseTable(etcdkv.New(client), "/zonemanager/locks/", hostname+"-"+strconv.Itoa(os.Getpid()), *lockTTL)
+		if err != nil {
+			log.Fatalf("zonemanager: create lease table: %v", err)
+		}
+		defer table.Close()
+		locker = table
+	}
+
+	m := manager.New(manager.Config{
+		Locker:            locker,
+		AgentTTL:          *agentTTL,
+		Specs:             specs,
+		Desired:           spec.Source(specs),
+		ReconcileInterval: *reconcileInterval,
+	})
+	server := &http.Server{Addr: *addr, Handler: m.Handler()}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Run(ctx)
+	}()
+
+	log.Printf("zonemanager: listening on %s", *addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("zonemanager: %v", err)
+	}
+	<-done
+}